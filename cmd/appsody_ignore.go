@@ -0,0 +1,166 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// appsodyIgnoreFile lists the project files that are not extracted, built or synced, with the syntax of .dockerignore
+const appsodyIgnoreFile = ".appsodyignore"
+
+// ignorePattern is a line of .appsodyignore, an exception when it starts with !
+type ignorePattern struct {
+	pattern   string
+	regex     *regexp.Regexp
+	exception bool
+}
+
+// ignoreRules are the patterns of .appsodyignore, the last pattern that matches a path decides if it is ignored
+type ignoreRules struct {
+	patterns   []ignorePattern
+	exceptions bool
+}
+
+// loadIgnoreRules reads the .appsodyignore file of the project directory. There are no rules without the file.
+func loadIgnoreRules(projectDir string) (*ignoreRules, error) {
+	rules := &ignoreRules{}
+	ignoreFile := filepath.Join(projectDir, appsodyIgnoreFile)
+	file, err := os.Open(ignoreFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return rules, nil
+		}
+		return nil, errors.Errorf("Could not read %s: %v", ignoreFile, err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pattern := ignorePattern{}
+		if strings.HasPrefix(line, "!") {
+			pattern.exception = true
+			rules.exceptions = true
+			line = strings.TrimSpace(line[1:])
+		}
+		line = strings.TrimPrefix(path.Clean(filepath.ToSlash(line)), "/")
+		if line == "" || line == "." {
+			continue
+		}
+		pattern.pattern = line
+		pattern.regex, err = ignorePatternRegex(line)
+		if err != nil {
+			return nil, errors.Errorf("Invalid pattern %s at line %d of %s: %v", line, lineNumber, ignoreFile, err)
+		}
+		rules.patterns = append(rules.patterns, pattern)
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, errors.Errorf("Could not read %s: %v", ignoreFile, err)
+	}
+	Debug.log("Patterns of ", ignoreFile, ": ", len(rules.patterns))
+	return rules, nil
+}
+
+// ignorePatternRegex turns a .dockerignore pattern into a regular expression: * and ? do not match a /,
+// ** matches any number of directories
+func ignorePatternRegex(pattern string) (*regexp.Regexp, error) {
+	var regex strings.Builder
+	regex.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch char := pattern[i]; char {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					// **/ also matches no directory
+					i++
+					regex.WriteString("(.*/)?")
+				} else {
+					regex.WriteString(".*")
+				}
+			} else {
+				regex.WriteString("[^/]*")
+			}
+		case '?':
+			regex.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				return nil, errors.New("unterminated [")
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			regex.WriteString("[" + class + "]")
+			i += end
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				regex.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+		default:
+			regex.WriteString(regexp.QuoteMeta(string(char)))
+		}
+	}
+	regex.WriteString("$")
+	return regexp.Compile(regex.String())
+}
+
+// ignored reports whether the path, relative to the project directory with / separators, is ignored.
+// A pattern that matches a directory also matches its content.
+func (rules *ignoreRules) ignored(projectPath string) bool {
+	if rules == nil || len(rules.patterns) == 0 {
+		return false
+	}
+	ignored := false
+	for _, pattern := range rules.patterns {
+		if pattern.exception != ignored {
+			// the pattern cannot change the result
+			continue
+		}
+		if pattern.matches(projectPath) {
+			ignored = !pattern.exception
+		}
+	}
+	return ignored
+}
+
+// matches reports whether the pattern matches the path or one of its parent directories
+func (pattern ignorePattern) matches(projectPath string) bool {
+	for candidate := projectPath; candidate != "." && candidate != "/" && candidate != ""; candidate = path.Dir(candidate) {
+		if pattern.regex.MatchString(candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipDir reports whether the content of an ignored directory can be skipped,
+// which is not the case when an exception may include some of it
+func (rules *ignoreRules) skipDir(projectPath string) bool {
+	return !rules.exceptions && rules.ignored(projectPath)
+}
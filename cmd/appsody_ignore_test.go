@@ -0,0 +1,55 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd/cmdtest"
+)
+
+func TestBuildShowContext(t *testing.T) {
+	project, cleanup := newTestProject(t, "context-project", "test/context-stack:0.1",
+		`{"Id": "sha256:2abc", "Config": {"Env": ["APPSODY_MOUNTS=.:/project/user-app", "APPSODY_PROJECT_DIR=/project"]}}`)
+	defer cleanup()
+	files := map[string]string{
+		".appsodyignore":            "# dependencies and secrets\nnode_modules\n!node_modules/keep.js\n**/*.env\n/test/fixtures\n",
+		"app.js":                    "console.log('app')\n",
+		"secret.env":                "PASSWORD=secret\n",
+		"config/local.env":          "TOKEN=secret\n",
+		"node_modules/lib/index.js": "module.exports = {}\n",
+		"node_modules/keep.js":      "module.exports = {}\n",
+		"test/fixtures/data.json":   "{}\n",
+		"test/app.test.js":          "// test\n",
+	}
+	project.writeFiles(t, files)
+
+	output, err := cmdtest.RunAppsodyCmd(project.appsodyArgs("build", "--dryrun", "--show-context"), project.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, included := range []string{"user-app/app.js", "user-app/node_modules/keep.js", "user-app/test/app.test.js", "user-app/.appsodyignore", "5 files"} {
+		if !strings.Contains(output, included) {
+			t.Errorf("Expected the build context to include %s. CLI output:\n%s", included, output)
+		}
+	}
+	expected := "Excluded by .appsodyignore: user-app/config/local.env, user-app/node_modules/lib/index.js, user-app/secret.env, user-app/test/fixtures/data.json"
+	if !strings.Contains(output, expected) {
+		t.Errorf("Expected %s. CLI output:\n%s", expected, output)
+	}
+	if strings.Contains(output, "docker build") {
+		t.Errorf("Expected --show-context not to build the image. CLI output:\n%s", output)
+	}
+}
@@ -16,9 +16,11 @@ package cmd
 
 import (
 	"path/filepath"
-	"regexp"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/gosuri/uitable"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -26,22 +28,23 @@ import (
 type buildCommandConfig struct {
 	*RootCommandConfig
 	tag                string
+	tagStrategy        string
 	dockerBuildOptions string
-}
-
-func checkDockerBuildOptions(options []string) error {
-	buildOptionsTest := "(^((-t)|(--tag)|(-f)|(--file))((=?$)|(=.*)))"
-
-	blackListedBuildOptionsRegexp := regexp.MustCompile(buildOptionsTest)
-	for _, value := range options {
-		isInBlackListed := blackListedBuildOptionsRegexp.MatchString(value)
-		if isInBlackListed {
-			return errors.Errorf("%s is not allowed in --docker-options", value)
-
-		}
-	}
-	return nil
-
+	platforms          string
+	push               bool
+	registry           string
+	registryUsername   string
+	passwordStdin      bool
+	metadataFile       string
+	output             string
+	showContext        bool
+	sbom               []string
+	buildArgs          []string
+	target             string
+	// the images to tag the build with, computed from tag and tagStrategy when empty
+	images []string
+	// the Git information of the project read to compute images, nil when it is not available
+	gitInfo *GitInfo
 }
 
 func newBuildCmd(rootConfig *RootCommandConfig) *cobra.Command {
@@ -57,7 +60,19 @@ func newBuildCmd(rootConfig *RootCommandConfig) *cobra.Command {
 	}
 
 	buildCmd.PersistentFlags().StringVarP(&config.tag, "tag", "t", "", "Docker image name and optionally a tag in the 'name:tag' format")
+	addTagStrategyFlag(buildCmd, &config.tagStrategy)
+	buildCmd.PersistentFlags().StringVar(&config.platforms, "platform", "", "Comma separated list of the platforms to build the image for, for example linux/amd64,linux/arm64. The images of the platforms are combined in a manifest list.")
+	buildCmd.PersistentFlags().BoolVar(&config.push, "push", false, "Push the image to its registry, as a manifest list when building for several platforms. The credentials are the ones of docker login, unless --registry-username is set.")
+	buildCmd.PersistentFlags().StringVar(&config.registry, "registry", "", "The registry to prefix the image with, when it has no registry. Defaults to the registry of .appsody-config.yaml.")
+	buildCmd.PersistentFlags().StringVar(&config.registryUsername, "registry-username", "", "The user name to push the image with, the password is read from stdin with --password-stdin")
+	buildCmd.PersistentFlags().BoolVar(&config.passwordStdin, "password-stdin", false, "Read the password to push the image with from stdin")
+	addBuildArgFlags(buildCmd, &config.buildArgs, &config.target)
 	buildCmd.PersistentFlags().StringVar(&config.dockerBuildOptions, "docker-options", "", "Specify the docker build options to use.  Value must be in \"\".")
+	buildCmd.PersistentFlags().StringVar(&config.metadataFile, "metadata-file", "", "Also write the metadata of the build, such as the images, their digest, the stack and the Git information, to this JSON file. It is always written to $HOME/.appsody/build/<project>.json.")
+	buildCmd.PersistentFlags().StringVar(&config.output, "output", "", "Also write the image to a file: type=docker-archive,dest=<file> for a docker save archive, or type=oci,dest=<directory> for an OCI image layout. Load it with appsody image load.")
+	buildCmd.PersistentFlags().StringArrayVar(&config.sbom, "sbom", nil, "Also write an SBOM of the image, with the stack and the packages of the package-lock.json, package.json, pom.xml, go.mod and requirements.txt files of the build context: spdx-json=<file> or cyclonedx-json=<file>. Can be repeated. It is always written next to the build metadata, to $HOME/.appsody/build/<project>.<spdx|cyclonedx>.json.")
+	buildCmd.PersistentFlags().BoolVar(&config.showContext, "show-context", false, "List the files of the build context, without the ones .appsodyignore excludes, instead of building the image")
+	addPullPolicyFlag(buildCmd, rootConfig)
 
 	buildCmd.AddCommand(newBuildDeleteCmd(config))
 	buildCmd.AddCommand(newSetupCmd(config))
@@ -69,6 +84,65 @@ func build(config *buildCommandConfig) error {
 	// 1. appsody Extract
 	// 2. docker build -t <project name> -f Dockerfile ./extracted
 
+	start := time.Now()
+	if (config.registryUsername != "" || config.passwordStdin) && !config.push {
+		return errors.New("The --registry-username and --password-stdin flags can only be used with --push")
+	}
+	if config.registryUsername != "" && !config.passwordStdin {
+		return errors.New("The password of --registry-username must be given on stdin with --password-stdin")
+	}
+	if config.passwordStdin && config.registryUsername == "" {
+		return errors.New("The --password-stdin flag requires --registry-username")
+	}
+	images, gitInfo := config.images, config.gitInfo
+	if len(images) == 0 {
+		var err error
+		gitInfo = getProjectGitInfo()
+		images, err = getBuildImages(config.RootCommandConfig, gitInfo, config.tag, config.tagStrategy, config.registry)
+		if err != nil {
+			return err
+		}
+	}
+	// the credentials of a previous command run in the same process do not apply
+	explicitCredentials = map[string]registryCredentials{}
+	// the engine commands log in with the credentials in a temporary docker config, removed after the push
+	defer removeLoginConfig()
+	if config.registryUsername != "" {
+		password, err := readPasswordStdin()
+		if err != nil {
+			return err
+		}
+		for _, image := range images {
+			registry := registryOf(image)
+			explicitCredentials[registry] = registryCredentials{Username: config.registryUsername, Password: password, ServerAddress: registry}
+		}
+	}
+	platforms, err := parsePlatforms(config.platforms)
+	if err != nil {
+		return err
+	}
+	output, err := parseBuildOutput(config.output)
+	if err != nil {
+		return err
+	}
+	sbomRequests, err := parseSBOMRequests(config.sbom)
+	if err != nil {
+		return err
+	}
+	buildArgs, buildArgValues, target, err := getBuildArgs(config.RootCommandConfig, config.buildArgs, config.target)
+	if err != nil {
+		return err
+	}
+	if output != nil && len(platforms) > 0 {
+		return errors.New("The --output flag cannot be used with --platform, the images of several platforms are not exported")
+	}
+	if len(platforms) > 0 {
+		err = checkStackPlatforms(config.RootCommandConfig, platforms)
+		if err != nil {
+			return err
+		}
+	}
+
 	extractConfig := &extractCommandConfig{RootCommandConfig: config.RootCommandConfig}
 	extractErr := extract(extractConfig)
 	if extractErr != nil {
@@ -79,21 +153,33 @@ func build(config *buildCommandConfig) error {
 	if perr != nil {
 		return errors.Errorf("%v", perr)
 	}
+	if config.showContext {
+		return showBuildContext(config.RootCommandConfig, projectName)
+	}
 	extractDir := filepath.Join(getHome(config.RootCommandConfig), "extract", projectName)
 	dockerfile := filepath.Join(extractDir, "Dockerfile")
-	buildImage := projectName //Lowercased
-	// If a tag is specified, change the buildImage
-	if config.tag != "" {
-		buildImage = config.tag
+	buildImage := images[0]
+	labels, err := getImageLabels(config.RootCommandConfig, gitInfo, buildImage)
+	if err != nil {
+		return err
+	}
+	if target != "" && !config.Dryrun {
+		err = checkDockerfileTarget(dockerfile, target)
+		if err != nil {
+			return err
+		}
+	}
+	var sbomPackages []inventoryPackage
+	if len(sbomRequests) > 0 {
+		sbomPackages, err = getSBOMInventory(config.RootCommandConfig, extractDir)
+		if err != nil {
+			return err
+		}
 	}
-	//cmdName := "docker"
-	cmdArgs := []string{"-t", buildImage}
+	cmdArgs := append(labelArgs(labels), buildArgs...)
 
 	if config.dockerBuildOptions != "" {
-		dockerBuildOptions := strings.TrimPrefix(config.dockerBuildOptions, " ")
-		dockerBuildOptions = strings.TrimSuffix(dockerBuildOptions, " ")
-		options := strings.Split(dockerBuildOptions, " ")
-		err := checkDockerBuildOptions(options)
+		options, err := parseDockerOptions(config.dockerBuildOptions, dockerBuildFlags)
 		if err != nil {
 			return err
 		}
@@ -102,13 +188,151 @@ func build(config *buildCommandConfig) error {
 	}
 	cmdArgs = append(cmdArgs, "-f", dockerfile, extractDir)
 	Debug.log("final cmd args", cmdArgs)
-	execError := DockerBuild(cmdArgs, DockerLog, config.Verbose, config.Dryrun)
+	engine, engineErr := getContainerEngine(config.RootCommandConfig)
+	if engineErr != nil {
+		return engineErr
+	}
+	metadata := newBuildMetadata(config.RootCommandConfig, gitInfo, projectName, images, cmdArgs, labels)
+	metadata.Platforms = platforms
+	defer useBuildArgValues(buildArgValues)()
+	logPhase(phaseBuilding, buildImage)
+	if len(platforms) > 0 {
+		digest, execError := engine.BuildPlatforms(cmdArgs, images, platforms, config.push, DockerLog, config.Verbose, config.Dryrun)
+		if execError != nil {
+			return execError
+		}
+		if !config.Dryrun {
+			Info.log("Built docker image ", strings.Join(images, ", "), " for ", strings.Join(platforms, ", "))
+		}
+		if config.push {
+			for _, image := range images {
+				logPushed(image, digest, config.Dryrun)
+				metadata.Pushed = append(metadata.Pushed, pushedImage{Image: image, Digest: digest})
+			}
+			metadata.Digest = digest
+		}
+		metadata.SBOM, err = writeSBOMs(config.RootCommandConfig, sbomRequests, metadata, sbomPackages)
+		if err != nil {
+			return err
+		}
+		return writeBuildMetadata(config.RootCommandConfig, metadata, start, config.metadataFile)
+	}
+
+	var tagArgs []string
+	for _, image := range images {
+		tagArgs = append(tagArgs, "-t", image)
+	}
+	execError := engine.Build(append(tagArgs, cmdArgs...), DockerLog, config.Verbose, config.Dryrun)
 
 	if execError != nil {
 		return execError
 	}
 	if !config.Dryrun {
-		Info.log("Built docker image ", buildImage)
+		Info.log("Built docker image ", strings.Join(images, ", "))
+		invalidateImageCache(config.RootCommandConfig, images...)
+		metadata.ImageID, err = engine.ImageID(buildImage)
+		if err != nil {
+			Warning.log("Could not get the ID of the image ", buildImage, ": ", err)
+		}
+	}
+	if output != nil {
+		err = engine.Export(images, output.outputType, output.dest, config.Dryrun)
+		if err != nil {
+			return errors.Errorf("Could not export the image to %s: %v", output.dest, err)
+		}
+		if !config.Dryrun {
+			Info.log("Exported docker image ", buildImage, " to ", output.dest)
+		}
+		metadata.Output = output.dest
+	}
+	if config.push {
+		for _, image := range images {
+			err = engine.Login(registryOf(image), config.Dryrun)
+			if err != nil {
+				return err
+			}
+			digest, err := pushWithRetries(image, func() (string, error) { return engine.Push(image, config.Dryrun) })
+			if err != nil {
+				return err
+			}
+			logPushed(image, digest, config.Dryrun)
+			metadata.Pushed = append(metadata.Pushed, pushedImage{Image: image, Digest: digest})
+			if image == buildImage {
+				metadata.Digest = digest
+			}
+		}
+	}
+	metadata.SBOM, err = writeSBOMs(config.RootCommandConfig, sbomRequests, metadata, sbomPackages)
+	if err != nil {
+		return err
+	}
+	return writeBuildMetadata(config.RootCommandConfig, metadata, start, config.metadataFile)
+}
+
+func logPushed(image string, digest string, dryrun bool) {
+	if dryrun {
+		return
+	}
+	if digest == "" {
+		Info.log("Pushed ", image)
+		return
+	}
+	Info.log("Pushed ", image, " with digest ", digest)
+}
+
+// showBuildContext lists the files of the extracted project, which is the build context.
+// With --dryrun the project is not extracted, so only the files of the project are listed.
+func showBuildContext(config *RootCommandConfig, projectName string) error {
+	containerProjectDir, err := getExtractDir(config)
+	if err != nil {
+		return err
+	}
+	volumeMaps, err := getVolumeArgs(config)
+	if err != nil {
+		return err
+	}
+	localFiles, ignoredFiles, err := scanProjectMounts(config, volumeMaps, containerProjectDir)
+	if err != nil {
+		return err
+	}
+	files := make(map[string]extractedFile)
+	if config.Dryrun {
+		Info.log("Dry Run - The project is not extracted, the files of the stack are not listed")
+		for path, file := range localFiles {
+			files[path] = file.extractedFile
+		}
+	} else {
+		manifest := readExtractManifest(getExtractManifestFile(config, projectName))
+		if manifest == nil {
+			return errors.Errorf("Could not read the files of the extracted project %s", projectName)
+		}
+		files = manifest.Files
+	}
+
+	var paths []string
+	for path, file := range files {
+		if !file.Mode.IsDir() {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	table := uitable.New()
+	table.MaxColWidth = 80
+	table.AddRow("FILE", "FROM", "SIZE")
+	var total int64
+	for _, path := range paths {
+		from := "stack"
+		if files[path].Local {
+			from = "project"
+		}
+		table.AddRow(path, from, formatBytes(files[path].Size))
+		total += files[path].Size
+	}
+	Info.log("Build context of ", projectName, ":\n", table)
+	Info.logf("%d files, %s", len(paths), formatBytes(total))
+	if len(ignoredFiles) > 0 {
+		sort.Strings(ignoredFiles)
+		Info.logf("Excluded by %s: %s", appsodyIgnoreFile, strings.Join(ignoredFiles, ", "))
 	}
 	return nil
 }
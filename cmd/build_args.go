@@ -0,0 +1,199 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// stackBuildArgsLabel lists the build args the Dockerfile of a stack accepts, as a JSON array.
+// appsody stack package sets it from the build-args of stack.yaml.
+const stackBuildArgsLabel = "dev.appsody.stack.buildargs"
+
+// StackBuildArg is a build arg the Dockerfile of a stack accepts
+type StackBuildArg struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description" json:"description,omitempty"`
+}
+
+var buildArgName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// a FROM line of a Dockerfile that names its stage
+var dockerfileStage = regexp.MustCompile(`(?i)^\s*FROM\s+.*\s+AS\s+(\S+)\s*$`)
+
+func addBuildArgFlags(cmd *cobra.Command, buildArgs *[]string, target *string) {
+	cmd.PersistentFlags().StringArrayVar(buildArgs, "build-arg", nil, "A build arg of the Dockerfile of the stack in the KEY=VALUE format, or KEY to take its value from the environment. Can be repeated. Overrides the buildArgs of .appsody-config.yaml.")
+	cmd.PersistentFlags().StringVar(target, "target", "", "The stage of the Dockerfile of the stack to build. Overrides the target of .appsody-config.yaml.")
+}
+
+// getBuildArgs returns the --build-arg and --target options of the build, from the project config and the flags,
+// after checking the build args against the ones the stack declares, and the target stage. The options only name
+// the build args, which the engine reads from its environment, so that the values, which may be secrets, are not
+// logged with the command: the values to set in the environment are returned by name.
+func getBuildArgs(config *RootCommandConfig, flagArgs []string, target string) ([]string, map[string]string, string, error) {
+	projectConfig, err := getProjectConfig(config)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	buildArgs := make(map[string]string)
+	values := make(map[string]string)
+	for name, value := range projectConfig.BuildArgs {
+		buildArgs[name] = name + "=" + value
+		values[name] = value
+	}
+	for _, buildArg := range flagArgs {
+		nameValue := strings.SplitN(buildArg, "=", 2)
+		buildArgs[nameValue[0]] = buildArg
+		if len(nameValue) == 2 {
+			values[nameValue[0]] = nameValue[1]
+		} else {
+			// the value is already in the environment
+			delete(values, nameValue[0])
+		}
+	}
+	if target == "" {
+		target = projectConfig.Target
+	}
+	if len(buildArgs) == 0 && target == "" {
+		return nil, nil, "", nil
+	}
+
+	var names []string
+	for name := range buildArgs {
+		if !buildArgName.MatchString(name) {
+			return nil, nil, "", errors.Errorf("Invalid build arg %s, its name must only have letters, digits and underscores", buildArgs[name])
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		err = checkStackBuildArgs(config, names)
+		if err != nil {
+			return nil, nil, "", err
+		}
+	}
+	var args []string
+	for _, name := range names {
+		args = append(args, "--build-arg", name)
+	}
+	if target != "" {
+		args = append(args, "--target", target)
+	}
+	return args, values, target, nil
+}
+
+// useBuildArgValues sets the values of the build args in the environment of the engine commands run after it,
+// and returns the function that restores the environment
+func useBuildArgValues(values map[string]string) func() {
+	previous := make(map[string]*string)
+	for name, value := range values {
+		if previousValue, found := os.LookupEnv(name); found {
+			previous[name] = &previousValue
+		} else {
+			previous[name] = nil
+		}
+		os.Setenv(name, value)
+	}
+	return func() {
+		for name, value := range previous {
+			if value == nil {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, *value)
+			}
+		}
+	}
+}
+
+// getStackBuildArgs returns the build args the stack declares, nil when it does not declare them
+func getStackBuildArgs(stackImage *ImageInspect) ([]StackBuildArg, error) {
+	label, found := stackImage.Config.Labels[stackBuildArgsLabel]
+	if !found {
+		return nil, nil
+	}
+	var stackBuildArgs []StackBuildArg
+	err := json.Unmarshal([]byte(label), &stackBuildArgs)
+	if err != nil {
+		return nil, errors.Errorf("The %s label of the stack image is not valid: %v", stackBuildArgsLabel, err)
+	}
+	return stackBuildArgs, nil
+}
+
+// checkStackBuildArgs returns an error if the stack declares the build args it accepts and one of the names is not
+func checkStackBuildArgs(config *RootCommandConfig, names []string) error {
+	stackImage, err := inspectStackImage(config)
+	if err != nil {
+		return err
+	}
+	stackBuildArgs, err := getStackBuildArgs(stackImage)
+	if err != nil {
+		return err
+	}
+	if stackBuildArgs == nil {
+		Debug.log("The stack does not declare the build args it accepts")
+		return nil
+	}
+	accepted := make(map[string]bool)
+	var acceptedNames []string
+	for _, stackBuildArg := range stackBuildArgs {
+		accepted[stackBuildArg.Name] = true
+		acceptedNames = append(acceptedNames, stackBuildArg.Name)
+	}
+	var unknown []string
+	for _, name := range names {
+		if !accepted[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		projectConfig, _ := getProjectConfig(config)
+		if len(acceptedNames) == 0 {
+			return errors.Errorf("The stack %s does not accept the build args %s, it accepts no build arg", projectConfig.Platform, strings.Join(unknown, ", "))
+		}
+		return errors.Errorf("The stack %s does not accept the build args %s. Accepted build args: %s", projectConfig.Platform, strings.Join(unknown, ", "), strings.Join(acceptedNames, ", "))
+	}
+	return nil
+}
+
+// checkDockerfileTarget returns an error if the Dockerfile has no stage named target
+func checkDockerfileTarget(dockerfile string, target string) error {
+	file, err := os.Open(dockerfile)
+	if err != nil {
+		return errors.Errorf("Could not read the stages of %s: %v", dockerfile, err)
+	}
+	defer file.Close()
+	var stages []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if match := dockerfileStage.FindStringSubmatch(scanner.Text()); match != nil {
+			if strings.EqualFold(match[1], target) {
+				return nil
+			}
+			stages = append(stages, match[1])
+		}
+	}
+	if len(stages) == 0 {
+		return errors.Errorf("The --target %s cannot be built, the Dockerfile of the stack has no named stages", target)
+	}
+	return errors.Errorf("The Dockerfile of the stack has no stage %s. Stages: %s", target, strings.Join(stages, ", "))
+}
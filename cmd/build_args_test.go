@@ -0,0 +1,76 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd/cmdtest"
+)
+
+func TestBuildArgs(t *testing.T) {
+	project, cleanup := newTestProject(t, "build-args-project", "test/args-stack:0.1",
+		`{"Id": "sha256:3abc", "Config": {"Env": ["APPSODY_MOUNTS=.:/project/user-app", "APPSODY_PROJECT_DIR=/project"], "Labels": {"dev.appsody.stack.id": "args-stack", "dev.appsody.stack.buildargs": "[{\"name\": \"NPM_REGISTRY\", \"description\": \"The npm registry to install from\"}, {\"name\": \"NODE_ENV\"}]"}}}`)
+	defer cleanup()
+	project.writeFiles(t, map[string]string{
+		".appsody-config.yaml": "stack: test/args-stack:0.1\nbuildArgs:\n  NPM_REGISTRY: https://npm.example.com\n  NODE_ENV: test\ntarget: prod\n",
+	})
+
+	// the flag overrides the value of the project config
+	output, err := cmdtest.RunAppsodyCmd(project.appsodyArgs("build", "--dryrun", "--build-arg", "NODE_ENV=production"), project.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "--build-arg NODE_ENV --build-arg NPM_REGISTRY --target prod -f"
+	if !strings.Contains(output, expected) || strings.Contains(output, "production") {
+		t.Errorf("Expected the build to have %s, without the values. CLI output:\n%s", expected, output)
+	}
+
+	// the engine reads the values of the build args from its environment
+	project.writePreviousExtract(t, "sha256:3abc", map[string]string{"Dockerfile": "FROM scratch AS prod\n"})
+	restorePath := project.installFakeDocker(t, `echo "build env: NODE_ENV=$NODE_ENV NPM_REGISTRY=$NPM_REGISTRY"`+"\n")
+	defer restorePath()
+	output, err = cmdtest.RunAppsodyCmd(project.appsodyArgs("build", "--build-arg", "NODE_ENV=production"), project.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "build env: NODE_ENV=production NPM_REGISTRY=https://npm.example.com"
+	if !strings.Contains(output, expected) {
+		t.Errorf("Expected the docker command to have %s. CLI output:\n%s", expected, output)
+	}
+	if _, found := os.LookupEnv("NPM_REGISTRY"); found {
+		t.Error("Expected the environment to be restored after the build")
+	}
+
+	output, err = cmdtest.RunAppsodyCmdExec(project.appsodyArgs("build", "--dryrun", "--build-arg", "FOO=1"), project.dir)
+	if err == nil {
+		t.Fatalf("Expected an error for a build arg the stack does not accept. CLI output:\n%s", output)
+	}
+	expected = "The stack test/args-stack:0.1 does not accept the build args FOO. Accepted build args: NPM_REGISTRY, NODE_ENV"
+	if !strings.Contains(output, expected) {
+		t.Errorf("Expected %s. CLI output:\n%s", expected, output)
+	}
+
+	output, err = cmdtest.RunAppsodyCmd(project.appsodyArgs("stack", "describe"), project.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, described := range []string{"Stack image: test/args-stack:0.1", "dev.appsody.stack.id: args-stack", "NPM_REGISTRY", "The npm registry to install from", "NODE_ENV"} {
+		if !strings.Contains(output, described) {
+			t.Errorf("Expected stack describe to show %s. CLI output:\n%s", described, output)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// buildMetadata is what appsody build records about a build of a project, so that deploy and CI steps
+// can use the exact references of the images instead of deriving them from the project name
+type buildMetadata struct {
+	Project        string            `json:"project"`
+	Image          string            `json:"image"`
+	Tags           []string          `json:"tags"`
+	Images         []string          `json:"images"`
+	ImageID        string            `json:"imageID,omitempty"`
+	Digest         string            `json:"digest,omitempty"`
+	Platforms      []string          `json:"platforms,omitempty"`
+	Pushed         []pushedImage     `json:"pushed,omitempty"`
+	Output         string            `json:"output,omitempty"`
+	SBOM           []sbomFile        `json:"sbom,omitempty"`
+	ProjectVersion string            `json:"projectVersion,omitempty"`
+	Stack          stackMetadata     `json:"stack"`
+	Git            *gitMetadata      `json:"git,omitempty"`
+	BuildArgs      []string          `json:"buildArgs"` // the names only, the values may be secrets
+	Labels         map[string]string `json:"labels,omitempty"`
+	BuildTime      string            `json:"buildTime"`
+	Duration       string            `json:"duration"`
+	DurationSecs   float64           `json:"durationSeconds"`
+}
+
+// pushedImage is an image pushed by appsody build, the digest is empty when the engine does not report it
+type pushedImage struct {
+	Image  string `json:"image"`
+	Digest string `json:"digest,omitempty"`
+}
+
+// stackMetadata identifies the stack image the project was built from, the digest is empty when the stack image
+// was never pulled from a registry
+type stackMetadata struct {
+	Image   string `json:"image"`
+	Digest  string `json:"digest,omitempty"`
+	ImageID string `json:"imageID,omitempty"`
+	ID      string `json:"id,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+// gitMetadata is the Git information of the project when it was built
+type gitMetadata struct {
+	Branch      string `json:"branch,omitempty"`
+	Upstream    string `json:"upstream,omitempty"`
+	RemoteURL   string `json:"remoteURL,omitempty"`
+	Commit      string `json:"commit,omitempty"`
+	CommitDate  string `json:"commitDate,omitempty"`
+	ChangesMade bool   `json:"changesMade"`
+}
+
+func getBuildMetadataFile(config *RootCommandConfig, projectName string) string {
+	return filepath.Join(getHome(config), "build", projectName+".json")
+}
+
+// buildArgNames returns the sorted names of the --build-arg flags of the build command args
+func buildArgNames(args []string) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for i, arg := range args {
+		var buildArg string
+		if arg == "--build-arg" && i+1 < len(args) {
+			buildArg = args[i+1]
+		} else if strings.HasPrefix(arg, "--build-arg=") {
+			buildArg = strings.TrimPrefix(arg, "--build-arg=")
+		} else {
+			continue
+		}
+		if name := strings.SplitN(buildArg, "=", 2)[0]; !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newBuildMetadata returns the metadata of the build of the images with the args of the build command and labels,
+// before it runs
+func newBuildMetadata(config *RootCommandConfig, gitInfo *GitInfo, projectName string, images []string, buildArgs []string, labels map[string]string) buildMetadata {
+	metadata := buildMetadata{
+		Project:   projectName,
+		Image:     images[0],
+		Images:    images,
+		BuildArgs: buildArgNames(buildArgs),
+		Labels:    labels,
+		BuildTime: time.Now().UTC().Format(time.RFC3339),
+	}
+	for _, image := range images {
+		_, tag := splitImageTag(image)
+		metadata.Tags = append(metadata.Tags, tag)
+	}
+	metadata.Tags = uniqueStrings(metadata.Tags)
+
+	projectConfig, err := getProjectConfig(config)
+	if err == nil {
+		metadata.ProjectVersion = projectConfig.Version
+		metadata.Stack.Image = projectConfig.Platform
+	}
+	metadata.Stack.ID = labels[stackIDLabel]
+	metadata.Stack.Version = labels[stackVersionLabel]
+	stackImage, err := inspectStackImage(config)
+	if err == nil {
+		metadata.Stack.ImageID = stackImage.ID
+		if len(stackImage.RepoDigests) > 0 {
+			metadata.Stack.Digest = stackImage.RepoDigests[0]
+		}
+	}
+	if gitInfo != nil {
+		metadata.Git = &gitMetadata{
+			Branch:      gitInfo.Branch,
+			Upstream:    gitInfo.Upstream,
+			RemoteURL:   stripURLCredentials(strings.TrimSpace(gitInfo.RemoteURL)),
+			Commit:      gitInfo.Commit.SHA,
+			CommitDate:  gitInfo.Commit.Date,
+			ChangesMade: gitInfo.ChangesMade,
+		}
+	}
+	return metadata
+}
+
+// writeBuildMetadata writes the metadata of the build to $HOME/.appsody/build/<project>.json,
+// and to metadataFile when it is set
+func writeBuildMetadata(config *RootCommandConfig, metadata buildMetadata, start time.Time, metadataFile string) error {
+	duration := time.Since(start)
+	metadata.Duration = duration.Round(time.Millisecond).String()
+	metadata.DurationSecs = duration.Seconds()
+	metadataFiles := []string{getBuildMetadataFile(config, metadata.Project)}
+	if metadataFile != "" {
+		metadataFiles = append(metadataFiles, metadataFile)
+	}
+	if config.Dryrun {
+		Info.log("Dry Run - Skip writing build metadata file ", strings.Join(metadataFiles, ", "))
+		return nil
+	}
+	metadataBytes, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	for _, file := range metadataFiles {
+		err = os.MkdirAll(filepath.Dir(file), os.ModePerm)
+		if err == nil {
+			err = ioutil.WriteFile(file, metadataBytes, 0644)
+		}
+		if err != nil {
+			return errors.Errorf("Could not write the build metadata file %s: %v", file, err)
+		}
+		Info.log("Wrote the build metadata file ", file)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd/cmdtest"
+)
+
+func TestBuildPush(t *testing.T) {
+	project, cleanup := newTestProject(t, "push-project", "test/push-stack:0.1", "")
+	defer cleanup()
+
+	// the password is read from stdin
+	passwordFile := filepath.Join(project.home, "password")
+	err := ioutil.WriteFile(passwordFile, []byte("secret\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin, err := os.Open(passwordFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	oldStdin := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = oldStdin }()
+
+	output, err := cmdtest.RunAppsodyCmd(project.appsodyArgs("build", "--dryrun", "--push", "--registry", "registry.example.com", "--tag-strategy", "latest", "--registry-username", "builder", "--password-stdin"), project.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"-t registry.example.com/push-project:latest", "Dry run - skipping push of image registry.example.com/push-project:latest", "Dry Run - Skip writing build metadata file " + filepath.Join(project.home, "build", "push-project.json")} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %s. CLI output:\n%s", expected, output)
+		}
+	}
+
+	// the password of --registry-username is only read from stdin
+	output, err = cmdtest.RunAppsodyCmdExec(project.appsodyArgs("build", "--dryrun", "--push", "--registry-username", "builder"), project.dir)
+	if err == nil {
+		t.Fatalf("Expected the build with --registry-username and without --password-stdin to fail. CLI output:\n%s", output)
+	}
+	expected := "must be given on stdin with --password-stdin"
+	if !strings.Contains(output, expected) {
+		t.Errorf("Expected %s. CLI output:\n%s", expected, output)
+	}
+}
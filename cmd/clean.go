@@ -0,0 +1,378 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type cleanCommandConfig struct {
+	*RootCommandConfig
+	project bool
+	all     bool
+	dryRun  bool
+}
+
+// cleanArtifact is something the CLI left behind that clean can remove
+type cleanArtifact struct {
+	description string
+	size        int64
+	remove      func(dryrun bool) error
+}
+
+// cleanInUse is what the running containers use, and must not be removed
+type cleanInUse struct {
+	// the project names of the running dev containers, mapped to the container name
+	projects map[string]string
+	// the running container IDs and names, and the images they run
+	containers map[string]bool
+	images     map[string]string
+}
+
+func newCleanCmd(rootConfig *RootCommandConfig) *cobra.Command {
+	config := &cleanCommandConfig{RootCommandConfig: rootConfig}
+	var cleanCmd = &cobra.Command{
+		Use:   "clean",
+		Short: "Remove the local artifacts created by the Appsody CLI",
+		Long: `Remove the local artifacts the Appsody CLI creates and leaves behind: the extracted projects in $HOME/.appsody/extract, the .appsody_init working directories, the dev.local stack and project images, the <project>-extract containers left by failed extract runs and, with --all, the downloaded deployment configuration.
+
+By default, or with --project, only the artifacts of the current project are removed. With --all, the artifacts of every project are removed. Nothing used by a running dev container is removed.`,
+		Example: `  appsody clean --dry-run
+  Lists the artifacts of the current project that would be removed, and the space they use.
+
+  appsody clean --all
+  Removes the artifacts of all the projects.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				return errors.Errorf("Unexpected argument %s. Use --project or --all to select what to clean.", args[0])
+			}
+			if config.project && config.all {
+				return errors.New("Use either --project or --all, not both")
+			}
+			config.Dryrun = config.Dryrun || config.dryRun
+			return clean(config)
+		},
+	}
+	cleanCmd.PersistentFlags().BoolVar(&config.project, "project", false, "Remove the artifacts of the current project (the default)")
+	cleanCmd.PersistentFlags().BoolVar(&config.all, "all", false, "Remove the artifacts of all the projects")
+	cleanCmd.PersistentFlags().BoolVar(&config.dryRun, "dry-run", false, "List what would be removed without removing it")
+	return cleanCmd
+}
+
+func clean(config *cleanCommandConfig) error {
+	engine, err := getContainerEngine(config.RootCommandConfig)
+	if err != nil {
+		return err
+	}
+	inUse, err := getCleanInUse(engine)
+	if err != nil {
+		return errors.Errorf("Could not list the running containers, nothing was removed: %v", err)
+	}
+
+	var projectNames []string
+	var projectDirs []string
+	projectName := ""
+	projectDir, projectErr := getProjectDir(config.RootCommandConfig)
+	if projectErr == nil {
+		projectName, err = getProjectName(config.RootCommandConfig)
+		if err != nil {
+			return err
+		}
+		projectNames = append(projectNames, projectName)
+		projectDirs = append(projectDirs, projectDir)
+	} else if !config.all {
+		return errors.Errorf("%v Use --all to clean the artifacts of all the projects.", projectErr)
+	}
+	if config.all {
+		extractNames, extractErr := listExtractedProjects(config.RootCommandConfig)
+		if extractErr != nil {
+			return extractErr
+		}
+		projectNames = append(projectNames, extractNames...)
+		// the project directories the CLI knows about are the ones that used a dependency volume
+		usage, usageErr := loadVolumeUsage(config.RootCommandConfig)
+		if usageErr != nil {
+			Warning.log(usageErr)
+		}
+		for _, used := range usage {
+			projectDirs = append(projectDirs, used.ProjectDir)
+		}
+	}
+
+	var artifacts []cleanArtifact
+	artifacts = append(artifacts, extractDirArtifacts(config.RootCommandConfig, uniqueStrings(projectNames), inUse)...)
+	artifacts = append(artifacts, initDirArtifacts(config.RootCommandConfig, uniqueStrings(projectDirs), inUse)...)
+
+	extractContainers, err := extractContainerArtifacts(engine, projectName, config.all, inUse)
+	if err != nil {
+		return err
+	}
+	artifacts = append(artifacts, extractContainers...)
+
+	var repositories []string
+	if config.all {
+		repositories = []string{"dev.local/*"}
+	} else {
+		repositories = []string{"dev.local/" + projectName}
+		if projectConfig, configErr := getProjectConfig(config.RootCommandConfig); configErr == nil && strings.HasPrefix(projectConfig.Platform, "dev.local/") {
+			stackRepository, _ := splitImageTag(projectConfig.Platform)
+			repositories = append(repositories, stackRepository)
+		}
+	}
+	images, err := imageArtifacts(engine, repositories, inUse)
+	if err != nil {
+		return err
+	}
+	artifacts = append(artifacts, images...)
+
+	if config.all {
+		deployConfigDir := filepath.Join(getHome(config.RootCommandConfig), "deploy")
+		if exists, _ := Exists(deployConfigDir); exists {
+			artifacts = append(artifacts, dirArtifact("the downloaded deployment configuration "+deployConfigDir, deployConfigDir))
+		}
+	}
+
+	if len(artifacts) == 0 {
+		Info.log("There is nothing to clean")
+		return nil
+	}
+	var reclaimed int64
+	failed := 0
+	for _, artifact := range artifacts {
+		if config.Dryrun {
+			Info.logf("Dry Run - Would remove %s (%s)", artifact.description, formatBytes(artifact.size))
+			reclaimed += artifact.size
+			continue
+		}
+		err = artifact.remove(config.Dryrun)
+		if err != nil {
+			Warning.logf("Could not remove %s: %v", artifact.description, err)
+			failed++
+			continue
+		}
+		Info.logf("Removed %s (%s)", artifact.description, formatBytes(artifact.size))
+		reclaimed += artifact.size
+	}
+	if config.Dryrun {
+		Info.log("Dry Run - ", formatBytes(reclaimed), " would be reclaimed")
+		return nil
+	}
+	Info.log("Reclaimed ", formatBytes(reclaimed))
+	if failed > 0 {
+		return errors.Errorf("%d of the artifacts could not be removed", failed)
+	}
+	return nil
+}
+
+// getCleanInUse finds the running containers, the images they run and the projects of the running dev containers
+func getCleanInUse(engine ContainerEngine) (*cleanInUse, error) {
+	inUse := &cleanInUse{projects: map[string]string{}, containers: map[string]bool{}, images: map[string]string{}}
+	containers, err := engine.ListContainers(false)
+	if err != nil {
+		return nil, err
+	}
+	for _, container := range containers {
+		inUse.containers[container.ID] = true
+		for _, name := range strings.Split(container.Names, ",") {
+			inUse.containers[name] = true
+			if strings.Contains(container.Command, "appsody-controller") && strings.HasSuffix(name, "-dev") {
+				inUse.projects[strings.TrimSuffix(name, "-dev")] = name
+			}
+		}
+		inUse.images[container.Image] = container.Names
+	}
+	return inUse, nil
+}
+
+// imageInUse returns the container that runs the image, or ""
+func (inUse *cleanInUse) imageInUse(image ImageInfo) string {
+	for _, reference := range []string{image.Repository + ":" + image.Tag, image.ID, strings.TrimPrefix(image.ID, "sha256:")} {
+		if container, found := inUse.images[reference]; found {
+			return container
+		}
+	}
+	if image.Tag == "latest" {
+		return inUse.images[image.Repository]
+	}
+	return ""
+}
+
+func listExtractedProjects(config *RootCommandConfig) ([]string, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(getHome(config), "extract"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Errorf("Could not read the extract directory: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		// the hidden directories are the staging directories of extract
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func extractDirArtifacts(config *RootCommandConfig, projectNames []string, inUse *cleanInUse) []cleanArtifact {
+	var artifacts []cleanArtifact
+	for _, projectName := range projectNames {
+		extractDir := filepath.Join(getHome(config), "extract", projectName)
+		if exists, _ := Exists(extractDir); !exists {
+			continue
+		}
+		if container, found := inUse.projects[projectName]; found {
+			Info.logf("Skipping the extracted project %s, it is in use by the running dev container %s", extractDir, container)
+			continue
+		}
+		artifact := dirArtifact("the extracted project "+extractDir, extractDir)
+		removeDir := artifact.remove
+		manifestFile := getExtractManifestFile(config, projectName)
+		artifact.remove = func(dryrun bool) error {
+			err := removeDir(dryrun)
+			if err == nil && !dryrun {
+				// without its directory, the manifest of the extract is of no use
+				_ = os.Remove(manifestFile)
+			}
+			return err
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	return artifacts
+}
+
+func initDirArtifacts(config *RootCommandConfig, projectDirs []string, inUse *cleanInUse) []cleanArtifact {
+	var artifacts []cleanArtifact
+	for _, projectDir := range projectDirs {
+		initDir := filepath.Join(projectDir, ".appsody_init")
+		if exists, _ := Exists(initDir); !exists {
+			continue
+		}
+		projectName := strings.ReplaceAll(strings.ToLower(filepath.Base(projectDir)), "_", "-")
+		if container, found := inUse.projects[projectName]; found {
+			Info.logf("Skipping the init working directory %s, it is in use by the running dev container %s", initDir, container)
+			continue
+		}
+		artifacts = append(artifacts, dirArtifact("the init working directory "+initDir, initDir))
+	}
+	return artifacts
+}
+
+// extractContainerArtifacts finds the containers left behind by failed extract runs,
+// the ones of the project, or all of them if all is set
+func extractContainerArtifacts(engine ContainerEngine, projectName string, all bool, inUse *cleanInUse) ([]cleanArtifact, error) {
+	containers, err := engine.ListContainers(true)
+	if err != nil {
+		return nil, errors.Errorf("Could not list the containers: %v", err)
+	}
+	var artifacts []cleanArtifact
+	for _, container := range containers {
+		for _, name := range strings.Split(container.Names, ",") {
+			if !strings.HasSuffix(name, "-extract") || (!all && name != projectName+"-extract") {
+				continue
+			}
+			if inUse.containers[container.ID] || inUse.containers[name] {
+				Info.logf("Skipping the extract container %s, it is running", name)
+				continue
+			}
+			containerName := name
+			artifacts = append(artifacts, cleanArtifact{
+				description: "the extract container " + containerName,
+				remove: func(dryrun bool) error {
+					return engine.Remove(containerName, dryrun)
+				},
+			})
+		}
+	}
+	return artifacts, nil
+}
+
+// imageArtifacts finds the local images of the repositories. The size of an image is
+// only counted once, with its first tag, as it is only reclaimed when its last tag is removed.
+func imageArtifacts(engine ContainerEngine, repositories []string, inUse *cleanInUse) ([]cleanArtifact, error) {
+	var artifacts []cleanArtifact
+	counted := map[string]bool{}
+	for _, repository := range repositories {
+		images, err := engine.ListImages(repository)
+		if err != nil {
+			return nil, err
+		}
+		for _, image := range images {
+			reference := image.Repository + ":" + image.Tag
+			if container := inUse.imageInUse(image); container != "" {
+				Info.logf("Skipping the image %s, it is in use by the running container %s", reference, container)
+				continue
+			}
+			size := image.Size
+			if counted[image.ID] {
+				size = 0
+			}
+			counted[image.ID] = true
+			artifacts = append(artifacts, cleanArtifact{
+				description: "the image " + reference,
+				size:        size,
+				remove: func(dryrun bool) error {
+					return engine.RemoveImage(reference, dryrun)
+				},
+			})
+		}
+	}
+	return artifacts, nil
+}
+
+func dirArtifact(description string, dir string) cleanArtifact {
+	return cleanArtifact{
+		description: description,
+		size:        dirSize(dir),
+		remove: func(dryrun bool) error {
+			if dryrun {
+				Info.log("Dry Run - Skipping removal of ", dir)
+				return nil
+			}
+			return os.RemoveAll(dir)
+		},
+	}
+}
+
+// dirSize returns the total size of the files in the directory, ignoring the ones it cannot read
+func dirSize(dir string) int64 {
+	var size int64
+	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, value := range values {
+		if value != "" && !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,112 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/appsody/appsody/cmd/cmdtest"
+)
+
+func TestCleanAll(t *testing.T) {
+	home, err := ioutil.TempDir("", "appsody-clean")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	configFile := filepath.Join(home, "config.yaml")
+	err = ioutil.WriteFile(configFile, []byte("home: "+home+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, project := range []string{"running-project", "old-project"} {
+		err = os.MkdirAll(filepath.Join(home, "extract", project), os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(home, "extract", project, "Dockerfile"), []byte("FROM scratch\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var lock sync.Mutex
+	var removed []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("all") == "" {
+			_, _ = w.Write([]byte(`[
+				{"Id": "aaaa", "Names": ["/running-project-dev"], "Image": "dev.local/my-stack:SNAPSHOT", "Command": "/.appsody/appsody-controller --mode=run", "Status": "Up 2 minutes"}
+			]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[
+			{"Id": "aaaa", "Names": ["/running-project-dev"], "Image": "dev.local/my-stack:SNAPSHOT", "Command": "/.appsody/appsody-controller --mode=run", "Status": "Up 2 minutes"},
+			{"Id": "bbbb", "Names": ["/old-project-extract"], "Image": "appsody/nodejs:0.3", "Command": "/bin/bash", "Status": "Created"}
+		]`))
+	})
+	mux.HandleFunc("/images/json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[
+			{"Id": "sha256:1111", "RepoTags": ["dev.local/my-stack:SNAPSHOT"], "Size": 1048576},
+			{"Id": "sha256:2222", "RepoTags": ["dev.local/old-project:latest"], "Size": 2097152}
+		]`))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		lock.Lock()
+		removed = append(removed, r.URL.Path)
+		lock.Unlock()
+		if strings.HasPrefix(r.URL.Path, "/images/") {
+			_, _ = w.Write([]byte(`[]`))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	dockerHost, cleanup := startFakeDockerDaemon(t, mux)
+	defer cleanup()
+	oldDockerHost := os.Getenv("DOCKER_HOST")
+	os.Setenv("DOCKER_HOST", dockerHost)
+	defer os.Setenv("DOCKER_HOST", oldDockerHost)
+
+	output, err := cmdtest.RunAppsodyCmd([]string{"clean", "--config", configFile, "--engine", "docker-api", "--all"}, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	sort.Strings(removed)
+	expected := []string{"/containers/old-project-extract", "/images/dev.local/old-project:latest"}
+	if strings.Join(removed, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected %v to be removed, but removed %v. CLI output:\n%s", expected, removed, output)
+	}
+	if _, err := os.Stat(filepath.Join(home, "extract", "old-project")); err == nil {
+		t.Errorf("Expected the extracted old-project to be removed. CLI output:\n%s", output)
+	}
+	if _, err := os.Stat(filepath.Join(home, "extract", "running-project")); err != nil {
+		t.Errorf("Expected the extracted running-project to be kept. CLI output:\n%s", output)
+	}
+	if !strings.Contains(output, "Reclaimed 2.0MB") {
+		t.Errorf("Expected the reclaimed space to be reported. CLI output:\n%s", output)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ContainerEngine is the set of container operations the CLI needs from a container engine.
+// All the commands go through this interface, so the engine can be selected with --engine
+// or the engine setting of the appsody config file.
+type ContainerEngine interface {
+	// Name returns the name the engine is selected with
+	Name() string
+	// Command returns the executable used to talk to the engine
+	Command() string
+	// CheckAvailable returns an error if the engine is not installed or not running
+	CheckAvailable() error
+	// RunAndListen starts a container (the args follow 'run') and streams its output to the logger
+	RunAndListen(args []string, logger appsodylogger, interactive bool, verbose bool, dryrun bool) (*exec.Cmd, error)
+	// RunOutput runs a container to completion (the args follow 'run') and returns its output
+	RunOutput(args []string) (string, error)
+	// Build builds an image (the args follow 'build')
+	Build(args []string, logger appsodylogger, verbose bool, dryrun bool) error
+	// BuildPlatforms builds the image for each of the platforms as a manifest list tagged with the images
+	// (the args follow 'build', without tags). The manifest list is pushed to the registries of the images when push is set,
+	// and its digest returned when it is known.
+	BuildPlatforms(args []string, images []string, platforms []string, push bool, logger appsodylogger, verbose bool, dryrun bool) (string, error)
+	// InspectImage returns the configuration of a local image
+	InspectImage(image string) (*ImageInspect, error)
+	// ImageID returns the ID of a local image, which changes when the image is pulled or built again
+	ImageID(image string) (string, error)
+	// ListImages lists the local images of the repository, which can contain * wildcards such as dev.local/*
+	ListImages(repository string) ([]ImageInfo, error)
+	// RemoveImage removes a local image or tag
+	RemoveImage(image string, dryrun bool) error
+	// ImageExists reports whether the image is available locally
+	ImageExists(image string) bool
+	// Create creates a container without starting it (the args follow 'create')
+	Create(args []string, dryrun bool) error
+	// Cp copies files out of a container, source is in the <container>:<path> form
+	Cp(source string, dest string, dryrun bool) error
+	// Remove forcibly removes a container
+	Remove(container string, dryrun bool) error
+	// ListContainers lists the running containers, or all the containers if all is set
+	ListContainers(all bool) ([]ContainerInfo, error)
+	// Stop stops a running container
+	Stop(container string, dryrun bool) error
+	// Pull pulls an image from its registry
+	Pull(image string, dryrun bool) error
+	// Tag adds a tag to a local image
+	Tag(image string, tag string, dryrun bool) error
+	// Push pushes an image to its registry and returns its digest, which is empty when it is not known
+	Push(image string, dryrun bool) (string, error)
+	// Login logs in to the registry with the credentials given on the command line, if any
+	Login(registry string, dryrun bool) error
+	// Export writes the built images to dest, as a docker-archive file or an OCI image layout directory
+	Export(images []string, outputType string, dest string, dryrun bool) error
+	// Load loads the images of a docker-archive file or an OCI image layout directory and returns their names,
+	// or their IDs when they have no name
+	Load(source string, dryrun bool) ([]string, error)
+	// ListVolumes lists the volumes
+	ListVolumes() ([]VolumeInfo, error)
+	// InspectVolume returns the volume, or nil when it does not exist
+	InspectVolume(name string) (*VolumeInfo, error)
+	// VolumeSizes returns the disk usage of the volumes, as reported by the engine
+	VolumeSizes() (map[string]string, error)
+	// CreateVolume creates a volume with the given labels
+	CreateVolume(name string, labels map[string]string, dryrun bool) error
+	// RemoveVolume removes a volume, which fails if a container uses it
+	RemoveVolume(name string, dryrun bool) error
+}
+
+// ImageInspect is the subset of the image inspect output the CLI uses
+type ImageInspect struct {
+	ID          string      `json:"Id"`
+	RepoTags    []string    `json:"RepoTags"`
+	RepoDigests []string    `json:"RepoDigests"`
+	Config      ImageConfig `json:"Config"`
+}
+
+// ImageConfig holds the configuration an image was built with
+type ImageConfig struct {
+	Env          []string            `json:"Env"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+	Labels       map[string]string   `json:"Labels"`
+}
+
+// ImageInfo describes a local image, Size is in bytes
+type ImageInfo struct {
+	ID         string
+	Repository string
+	Tag        string
+	Size       int64
+}
+
+// ContainerInfo describes a container
+type ContainerInfo struct {
+	ID      string
+	Image   string
+	Status  string
+	Names   string
+	Command string
+}
+
+// VolumeInfo describes a volume
+type VolumeInfo struct {
+	Name       string            `json:"Name"`
+	Labels     map[string]string `json:"Labels"`
+	Mountpoint string            `json:"Mountpoint"`
+}
+
+const (
+	engineDocker    = "docker"
+	enginePodman    = "podman"
+	engineDockerAPI = "docker-api"
+)
+
+var supportedEngines = []string{engineDocker, enginePodman, engineDockerAPI}
+
+// getContainerEngine returns the engine selected with --engine, the engine config setting,
+// or buildah when running the experimental Kubernetes path
+func getContainerEngine(config *RootCommandConfig) (ContainerEngine, error) {
+	if config.Buildah {
+		return &buildahEngine{}, nil
+	}
+	if config.engine != nil {
+		return config.engine, nil
+	}
+	engineName := config.Engine
+	if engineName == "" && config.CliConfig != nil {
+		engineName = config.CliConfig.GetString("engine")
+	}
+	if engineName == "" {
+		engineName = engineDocker
+	}
+	switch strings.ToLower(engineName) {
+	case engineDocker:
+		config.engine = &cliEngine{name: engineDocker, command: "docker"}
+	case enginePodman:
+		config.engine = &cliEngine{name: enginePodman, command: "podman"}
+	case engineDockerAPI:
+		engine, err := NewDockerAPIEngine(os.Getenv("DOCKER_HOST"))
+		if err != nil {
+			return nil, err
+		}
+		config.engine = engine
+	default:
+		return nil, errors.Errorf("Unsupported container engine %s. Use one of: %s", engineName, strings.Join(supportedEngines, ", "))
+	}
+	Debug.log("Using container engine ", config.engine.Name())
+	return config.engine, nil
+}
+
+// envVars returns the environment variables of the image as a map
+func (image *ImageInspect) envVars() map[string]string {
+	envVars := make(map[string]string, len(image.Config.Env))
+	for _, envVar := range image.Config.Env {
+		nameValuePair := strings.SplitN(envVar, "=", 2)
+		if len(nameValuePair) == 2 {
+			envVars[nameValuePair[0]] = nameValuePair[1]
+		} else {
+			envVars[nameValuePair[0]] = ""
+		}
+	}
+	return envVars
+}
+
+// exposedPorts returns the exposed port numbers of the image, without the protocol
+func (image *ImageInspect) exposedPorts() []string {
+	portValues := make([]string, 0, len(image.Config.ExposedPorts))
+	for port := range image.Config.ExposedPorts {
+		portValues = append(portValues, strings.Split(port, "/")[0])
+	}
+	return portValues
+}
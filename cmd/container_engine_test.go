@@ -0,0 +1,36 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd/cmdtest"
+)
+
+func TestUnsupportedEngine(t *testing.T) {
+
+	args := []string{"ps", "--engine", "rkt"}
+	output, err := cmdtest.RunAppsodyCmdExec(args, ".")
+
+	if err == nil {
+		t.Error("Expected an error when using an unsupported container engine")
+	}
+	if !strings.Contains(output, "Unsupported container engine rkt. Use one of: docker, podman") {
+		t.Error("String \"Unsupported container engine rkt. Use one of: docker, podman\" not found in output")
+	} else {
+		t.Log("Found the correct error string")
+	}
+}
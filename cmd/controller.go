@@ -0,0 +1,454 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CONTROLLERVERSION is the version of the appsody-controller shipped next to the CLI executable.
+// It is set at build time from the CONTROLLER_VERSION of the Makefile.
+var CONTROLLERVERSION = "0.2.4"
+
+// The stack image declares the controller versions it works with in this label,
+// or in the APPSODY_CONTROLLER_VERSION environment variable.
+const controllerVersionLabel = "dev.appsody.controller.version"
+
+const controllerBinary = "appsody-controller"
+
+// controllerSemver is a major.minor.patch version and its pre-release, build metadata is ignored
+type controllerSemver struct {
+	numbers    [3]int
+	prerelease string
+}
+
+func parseControllerVersion(version string) (controllerSemver, error) {
+	semver, given, err := parsePartialVersion(strings.TrimSpace(version))
+	if err != nil || given != 3 {
+		return semver, errors.Errorf("%s is not a major.minor.patch version", version)
+	}
+	return semver, nil
+}
+
+func (v controllerSemver) compare(other controllerSemver) int {
+	for i := range v.numbers {
+		if v.numbers[i] != other.numbers[i] {
+			if v.numbers[i] < other.numbers[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return comparePrereleases(v.prerelease, other.prerelease)
+}
+
+// comparePrereleases orders pre-releases as semver does: a version without a pre-release is higher
+// than its pre-releases, and the dot separated identifiers are compared in turn, numerically when
+// they are numbers, with numbers lower than the other identifiers
+func comparePrereleases(a string, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+	aIdentifiers, bIdentifiers := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aIdentifiers) && i < len(bIdentifiers); i++ {
+		aNumber, aErr := strconv.Atoi(aIdentifiers[i])
+		bNumber, bErr := strconv.Atoi(bIdentifiers[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if aNumber != bNumber {
+				if aNumber < bNumber {
+					return -1
+				}
+				return 1
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		case aIdentifiers[i] != bIdentifiers[i]:
+			if aIdentifiers[i] < bIdentifiers[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(aIdentifiers) < len(bIdentifiers):
+		return -1
+	case len(aIdentifiers) > len(bIdentifiers):
+		return 1
+	}
+	return 0
+}
+
+// versionComparator is a single condition of a version range, such as >=0.2.4.
+// named is set when the range names the pre-release of the version.
+type versionComparator struct {
+	operator string
+	version  controllerSemver
+	named    bool
+}
+
+func (c versionComparator) matches(v controllerSemver) bool {
+	result := v.compare(c.version)
+	switch c.operator {
+	case ">":
+		return result > 0
+	case ">=":
+		return result >= 0
+	case "<":
+		return result < 0
+	case "<=":
+		return result <= 0
+	}
+	return result == 0
+}
+
+// prereleaseIdentifier is an identifier of a pre-release, numbers have no leading zero
+var prereleaseIdentifier = regexp.MustCompile(`^(0|[1-9][0-9]*|[0-9]*[A-Za-z-][0-9A-Za-z-]*)$`)
+
+// parsePartialVersion parses 1, 1.2, 1.2.3, 1.2.3-beta.1 or the x wildcard forms 1.x and 1.2.x,
+// and returns the version with the missing parts set to 0 and the number of parts given.
+// Only a full version can have a pre-release.
+func parsePartialVersion(version string) (controllerSemver, int, error) {
+	var semver controllerSemver
+	version = strings.TrimPrefix(version, "v")
+	if index := strings.Index(version, "+"); index >= 0 {
+		version = version[:index]
+	}
+	if index := strings.Index(version, "-"); index >= 0 {
+		semver.prerelease = version[index+1:]
+		version = version[:index]
+		for _, identifier := range strings.Split(semver.prerelease, ".") {
+			if !prereleaseIdentifier.MatchString(identifier) {
+				return semver, 0, errors.Errorf("%s-%s is not a valid version", version, semver.prerelease)
+			}
+		}
+	}
+	parts := strings.Split(version, ".")
+	if len(parts) > 3 || version == "" {
+		return semver, 0, errors.Errorf("%s is not a valid version", version)
+	}
+	given := 0
+	for i, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			// the parts after a wildcard are wildcards too
+			for _, rest := range parts[i+1:] {
+				if rest != "x" && rest != "X" && rest != "*" {
+					return semver, 0, errors.Errorf("%s is not a valid version", version)
+				}
+			}
+			break
+		}
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 || (len(part) > 1 && part[0] == '0') {
+			return semver, 0, errors.Errorf("%s is not a valid version", version)
+		}
+		semver.numbers[i] = number
+		given++
+	}
+	if semver.prerelease != "" && given != 3 {
+		return semver, 0, errors.Errorf("%s-%s is not a valid version, only a major.minor.patch version can have a pre-release", version, semver.prerelease)
+	}
+	return semver, given, nil
+}
+
+// nextVersion returns the lowest version above every version that starts with the first given parts of v.
+// It is the lowest pre-release of that version, so that its pre-releases are below the limit as well.
+func nextVersion(v controllerSemver, given int) controllerSemver {
+	var next controllerSemver
+	copy(next.numbers[:given], v.numbers[:given])
+	next.numbers[given-1]++
+	next.prerelease = "0"
+	return next
+}
+
+// parseVersionTerm turns one term of a range into comparators. It supports
+// the comparison operators, exact and partial versions (0.2, 0.2.x), ^ and ~.
+func parseVersionTerm(term string) ([]versionComparator, error) {
+	operator := ""
+	for _, op := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(term, op) {
+			operator = op
+			term = strings.TrimSpace(strings.TrimPrefix(term, op))
+			break
+		}
+	}
+	version, given, err := parsePartialVersion(term)
+	if err != nil {
+		return nil, err
+	}
+	named := func(operator string) versionComparator {
+		return versionComparator{operator: operator, version: version, named: version.prerelease != ""}
+	}
+	limit := func(operator string, version controllerSemver) versionComparator {
+		return versionComparator{operator: operator, version: version}
+	}
+	if given == 0 {
+		// *, x and X match any version, < and > a wildcard match none
+		if operator == "<" || operator == ">" {
+			return []versionComparator{limit("<", controllerSemver{prerelease: "0"})}, nil
+		}
+		return nil, nil
+	}
+	switch operator {
+	case ">", ">=", "<", "<=":
+		if given < 3 && (operator == ">" || operator == "<=") {
+			// >1.2 means >=1.3.0 and <=1.2 means <1.3.0
+			next := nextVersion(version, given)
+			if operator == ">" {
+				next.prerelease = ""
+				return []versionComparator{limit(">=", next)}, nil
+			}
+			return []versionComparator{limit("<", next)}, nil
+		}
+		if given < 3 && operator == "<" {
+			// <1.2 excludes the pre-releases of 1.2.0
+			version.prerelease = "0"
+			return []versionComparator{limit("<", version)}, nil
+		}
+		return []versionComparator{named(operator)}, nil
+	case "^":
+		// changes that do not modify the left-most non-zero part
+		upToPart := 1
+		for upToPart < given && version.numbers[upToPart-1] == 0 {
+			upToPart++
+		}
+		return []versionComparator{named(">="), limit("<", nextVersion(version, upToPart))}, nil
+	case "~":
+		// patch level changes if a minor version is given, minor level changes if not
+		upToPart := 2
+		if given < 2 {
+			upToPart = 1
+		}
+		return []versionComparator{named(">="), limit("<", nextVersion(version, upToPart))}, nil
+	}
+	if given == 3 {
+		return []versionComparator{named("=")}, nil
+	}
+	return []versionComparator{named(">="), limit("<", nextVersion(version, given))}, nil
+}
+
+// controllerVersionMatches reports whether version satisfies the range. A range is a list of
+// alternatives separated by ||, each one a list of terms separated by spaces or commas,
+// for example ">=0.2.4 <0.3.0 || ^1.0.0".
+// As with npm, a pre-release only satisfies an alternative that names a pre-release of the same
+// major.minor.patch version, so that >=0.2.4 does not select 0.3.0-rc.1.
+func controllerVersionMatches(versionRange string, version string) (bool, error) {
+	semver, err := parseControllerVersion(version)
+	if err != nil {
+		return false, err
+	}
+	// every alternative is parsed, so that an invalid range is reported whatever the version
+	matched := false
+	for _, alternative := range strings.Split(versionRange, "||") {
+		// allow a space between an operator and its version
+		for _, op := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+			alternative = strings.Replace(alternative, op+" ", op, -1)
+		}
+		matches := true
+		prereleaseAllowed := semver.prerelease == ""
+		for _, term := range strings.FieldsFunc(alternative, func(r rune) bool { return r == ' ' || r == ',' }) {
+			comparators, err := parseVersionTerm(term)
+			if err != nil {
+				return false, errors.Errorf("Invalid controller version range %s: %v", versionRange, err)
+			}
+			for _, comparator := range comparators {
+				if !comparator.matches(semver) {
+					matches = false
+				}
+				if comparator.named && comparator.version.numbers == semver.numbers {
+					prereleaseAllowed = true
+				}
+			}
+		}
+		if matches && prereleaseAllowed {
+			matched = true
+		}
+	}
+	return matched, nil
+}
+
+func getControllersDir(config *RootCommandConfig) string {
+	return filepath.Join(getHome(config), "controllers")
+}
+
+// installedControllerVersions returns the versions in the controller store, highest first
+func installedControllerVersions(config *RootCommandConfig) ([]string, error) {
+	entries, err := ioutil.ReadDir(getControllersDir(config))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Errorf("Could not read the controller store: %v", err)
+	}
+	var versions []string
+	for _, entry := range entries {
+		if _, parseErr := parseControllerVersion(entry.Name()); parseErr != nil || !entry.IsDir() {
+			continue
+		}
+		exists, existsErr := Exists(filepath.Join(getControllersDir(config), entry.Name(), controllerBinary))
+		if existsErr == nil && exists {
+			versions = append(versions, entry.Name())
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		vi, _ := parseControllerVersion(versions[i])
+		vj, _ := parseControllerVersion(versions[j])
+		return vi.compare(vj) > 0
+	})
+	return versions, nil
+}
+
+// installBundledController copies the controller shipped next to the CLI executable into the store,
+// replacing a previous copy of the same version if the binaries differ
+func installBundledController(config *RootCommandConfig) error {
+	executable, _ := os.Executable()
+	binaryLocation, err := filepath.Abs(filepath.Dir(executable))
+	Debug.log("Binary location ", binaryLocation)
+	if err != nil {
+		return errors.New("fatal error - can't retrieve the binary path... exiting")
+	}
+	sourceController := filepath.Join(binaryLocation, controllerBinary)
+	sourceExists, existsErr := Exists(sourceController)
+	if existsErr != nil {
+		return existsErr
+	}
+	if !sourceExists {
+		Debug.log("The binary controller could not be found in ", binaryLocation)
+		return nil
+	}
+	destController := filepath.Join(getControllersDir(config), CONTROLLERVERSION, controllerBinary)
+	destExists, existsErr := Exists(destController)
+	if existsErr != nil {
+		return existsErr
+	}
+	if destExists {
+		checksumMatch, checksumErr := checksum256TestFile(sourceController, destController)
+		if checksumErr != nil {
+			return checksumErr
+		}
+		if checksumMatch {
+			return nil
+		}
+	}
+	if config.Dryrun {
+		Info.logf("Dry Run - Skipping copy of controller binary from %s to %s", sourceController, destController)
+		return nil
+	}
+	Debug.log("Installing controller ", CONTROLLERVERSION, " from ", sourceController)
+	err = os.MkdirAll(filepath.Dir(destController), os.ModePerm)
+	if err != nil {
+		return errors.Errorf("Cannot create the controller store - exiting: %v", err)
+	}
+	copyError := CopyFile(sourceController, destController)
+	if copyError != nil {
+		return errors.Errorf("Cannot retrieve controller - exiting: %v", copyError)
+	}
+	// Making the controller executable in case CopyFile loses permissions
+	chmodErr := os.Chmod(destController, 0755)
+	if chmodErr != nil {
+		return errors.Errorf("Cannot make the controller  executable - exiting: %v", chmodErr)
+	}
+	return nil
+}
+
+// getMountedController returns the controller to run in the dev container, the APPSODY_MOUNT_CONTROLLER
+// environment variable if it is set, or the controller of the store that suits the stack
+func getMountedController(config *RootCommandConfig) (string, error) {
+	if controller := os.Getenv("APPSODY_MOUNT_CONTROLLER"); controller != "" {
+		Debug.log("Overriding appsody-controller mount with APPSODY_MOUNT_CONTROLLER env variable: ", controller)
+		return controller, nil
+	}
+	return getController(config)
+}
+
+// getStackControllerRange returns the controller versions required by the stack, or "" if it does not say
+func getStackControllerRange(config *RootCommandConfig) (string, error) {
+	stackImage, err := inspectStackImage(config)
+	if err != nil {
+		return "", err
+	}
+	if versionRange := stackImage.Config.Labels[controllerVersionLabel]; versionRange != "" {
+		return versionRange, nil
+	}
+	return GetEnvVar("APPSODY_CONTROLLER_VERSION", config)
+}
+
+// getController returns the path of the controller to mount in the dev container. The controller
+// is the highest version in the store that satisfies the range declared by the stack, the bundled
+// version when the stack does not declare one.
+func getController(config *RootCommandConfig) (string, error) {
+	err := installBundledController(config)
+	if err != nil {
+		return "", err
+	}
+	versionRange, err := getStackControllerRange(config)
+	if err != nil {
+		return "", err
+	}
+	versions, err := installedControllerVersions(config)
+	if err != nil {
+		return "", err
+	}
+	Debug.log("Installed controller versions: ", versions)
+	Debug.log("Controller versions required by the stack: ", versionRange)
+	if versionRange == "" {
+		for _, version := range versions {
+			if version == CONTROLLERVERSION {
+				return filepath.Join(getControllersDir(config), version, controllerBinary), nil
+			}
+		}
+		if len(versions) > 0 {
+			Debug.log("The bundled controller ", CONTROLLERVERSION, " is not installed, using version ", versions[0])
+			return filepath.Join(getControllersDir(config), versions[0], controllerBinary), nil
+		}
+		versionRange = "*"
+	}
+	for _, version := range versions {
+		matches, matchErr := controllerVersionMatches(versionRange, version)
+		if matchErr != nil {
+			return "", matchErr
+		}
+		if matches {
+			Debug.log("Using controller version ", version)
+			return filepath.Join(getControllersDir(config), version, controllerBinary), nil
+		}
+	}
+	if config.Dryrun && len(versions) == 0 {
+		return filepath.Join(getControllersDir(config), CONTROLLERVERSION, controllerBinary), nil
+	}
+	projectConfig, _ := getProjectConfig(config)
+	available := "none"
+	if len(versions) > 0 {
+		available = strings.Join(versions, ", ")
+	}
+	return "", errors.Errorf("The stack %s requires appsody-controller %s, but no compatible version is installed (available: %s). Install a compatible controller as %s or upgrade the Appsody CLI.",
+		projectConfig.Platform, versionRange, available, filepath.Join(getControllersDir(config), "<version>", controllerBinary))
+}
@@ -0,0 +1,108 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd"
+)
+
+func TestControllerVersionMatches(t *testing.T) {
+	var tests = []struct {
+		versionRange string
+		matching     []string
+		notMatching  []string
+	}{
+		// exact and partial versions
+		{"0.2.4", []string{"0.2.4", "v0.2.4", "0.2.4+build.7"}, []string{"0.2.3", "0.2.5", "0.2.4-rc.1"}},
+		{"=0.2.4", []string{"0.2.4"}, []string{"0.2.5"}},
+		{"0.2", []string{"0.2.0", "0.2.99"}, []string{"0.1.9", "0.3.0", "0.3.0-rc.1"}},
+		{"1", []string{"1.0.0", "1.9.9"}, []string{"0.9.9", "2.0.0"}},
+		// x-ranges
+		{"0.2.x", []string{"0.2.0", "0.2.7"}, []string{"0.3.0"}},
+		{"1.X", []string{"1.0.0", "1.5.2"}, []string{"2.0.0"}},
+		{"1.*.*", []string{"1.2.3"}, []string{"2.0.0"}},
+		{"*", []string{"0.0.1", "9.9.9"}, []string{"1.0.0-rc.1"}},
+		{"", []string{"0.2.4"}, nil},
+		// caret ranges
+		{"^0.2.4", []string{"0.2.4", "0.2.9"}, []string{"0.2.3", "0.3.0", "0.3.0-rc.1"}},
+		{"^1.2.3", []string{"1.2.3", "1.9.0"}, []string{"1.2.2", "2.0.0", "2.0.0-alpha"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4", "0.1.0"}},
+		{"^0.0", []string{"0.0.0", "0.0.9"}, []string{"0.1.0"}},
+		{"^1.2.x", []string{"1.2.0", "1.9.9"}, []string{"1.1.9", "2.0.0"}},
+		{"^ 0.2.4", []string{"0.2.5"}, []string{"0.3.0"}},
+		// tilde ranges
+		{"~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.2.2", "1.3.0"}},
+		{"~1.2", []string{"1.2.0", "1.2.9"}, []string{"1.3.0"}},
+		{"~1", []string{"1.0.0", "1.9.0"}, []string{"2.0.0"}},
+		{"~0.2.4", []string{"0.2.4", "0.2.5"}, []string{"0.3.0"}},
+		// comparators
+		{">=0.2.4 <0.3.0", []string{"0.2.4", "0.2.10"}, []string{"0.2.3", "0.3.0"}},
+		{">=0.2.4, <0.3.0", []string{"0.2.4"}, []string{"0.3.0"}},
+		{">= 0.2.4 < 0.3", []string{"0.2.4"}, []string{"0.3.0", "0.3.0-rc.1"}},
+		{">0.2.4", []string{"0.2.5", "1.0.0"}, []string{"0.2.4"}},
+		{">0.2", []string{"0.3.0"}, []string{"0.2.9"}},
+		{"<=0.2", []string{"0.2.9", "0.1.0"}, []string{"0.3.0"}},
+		{"<=0.2.4", []string{"0.2.4"}, []string{"0.2.5"}},
+		{"<0.2", []string{"0.1.9"}, []string{"0.2.0"}},
+		{"<*", nil, []string{"0.0.0", "1.0.0"}},
+		{"<0.3.0 || ^1.0.0", []string{"0.2.4", "1.5.0"}, []string{"0.3.0", "2.0.0"}},
+		// pre-releases only match a range that names a pre-release of the same version
+		{">=0.3.0-rc.1", []string{"0.3.0-rc.1", "0.3.0-rc.2", "0.3.0-rc.10", "0.3.0", "0.4.0"}, []string{"0.3.0-rc.0", "0.3.0-beta", "0.4.0-rc.1"}},
+		{"^0.3.0-beta.2", []string{"0.3.0-beta.2", "0.3.0-beta.11", "0.3.0-rc", "0.3.1"}, []string{"0.3.0-beta.1", "0.3.1-rc.1", "0.4.0"}},
+		{"0.3.0-rc.1", []string{"0.3.0-rc.1"}, []string{"0.3.0-rc.2", "0.3.0"}},
+		{">=0.3.0-alpha <0.3.0", []string{"0.3.0-alpha", "0.3.0-alpha.1", "0.3.0-beta"}, []string{"0.3.0"}},
+		{">=0.3.0-1 <0.3.0", []string{"0.3.0-1", "0.3.0-2", "0.3.0-alpha"}, []string{"0.3.0-0"}},
+	}
+	for _, test := range tests {
+		for _, version := range test.matching {
+			matches, err := cmd.ControllerVersionMatches(test.versionRange, version)
+			if err != nil || !matches {
+				t.Errorf("Expected %s to satisfy %q, got %t %v", version, test.versionRange, matches, err)
+			}
+		}
+		for _, version := range test.notMatching {
+			matches, err := cmd.ControllerVersionMatches(test.versionRange, version)
+			if err != nil || matches {
+				t.Errorf("Expected %s not to satisfy %q, got %t %v", version, test.versionRange, matches, err)
+			}
+		}
+	}
+}
+
+func TestControllerVersionMatchesInvalid(t *testing.T) {
+	var tests = []struct {
+		versionRange string
+		version      string
+		err          string
+	}{
+		{"0.2.4", "0.2", "0.2 is not a major.minor.patch version"},
+		{"0.2.4", "latest", "latest is not a major.minor.patch version"},
+		{"0.2.4", "0.2.04", "0.2.04 is not a major.minor.patch version"},
+		{"0.2.4", "0.2.4-rc..1", "0.2.4-rc..1 is not a major.minor.patch version"},
+		{">=abc", "0.2.4", "Invalid controller version range >=abc"},
+		{"0.2.4.1", "0.2.4", "Invalid controller version range 0.2.4.1"},
+		{"1.x.2", "0.2.4", "Invalid controller version range 1.x.2"},
+		{"^0.2-rc.1", "0.2.4", "only a major.minor.patch version can have a pre-release"},
+		{"<0.3.0 || ~", "0.2.4", "Invalid controller version range <0.3.0 || ~"},
+	}
+	for _, test := range tests {
+		matches, err := cmd.ControllerVersionMatches(test.versionRange, test.version)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Expected the error %s matching %s against %q, got %t %v", test.err, test.version, test.versionRange, matches, err)
+		}
+	}
+}
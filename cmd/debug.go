@@ -23,12 +23,22 @@ func newDebugCmd(rootConfig *RootCommandConfig) *cobra.Command {
 		Short: "Run the local Appsody environment in debug mode",
 		Long:  `This starts a docker based continuous build environment for your project with debugging enabled.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-
+			err := applyRunProfile(cmd, config)
+			if err != nil {
+				return err
+			}
+			if config.ide != "" {
+				ideErr := checkIDE(config.ide)
+				if ideErr != nil {
+					return ideErr
+				}
+			}
 			Info.log("Running debug environment")
 			return commonCmd(config, "debug")
 		},
 	}
 
 	addDevCommonFlags(debugCmd, config)
+	debugCmd.PersistentFlags().StringVar(&config.ide, "ide", "", "Write a debug configuration for the IDE (vscode or intellij) into the project, attached to the published debug port.")
 	return debugCmd
 }
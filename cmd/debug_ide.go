@@ -0,0 +1,309 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ideVSCode   = "vscode"
+	ideIntelliJ = "intellij"
+)
+
+var supportedIDEs = []string{ideVSCode, ideIntelliJ}
+
+// The debuggers an IDE configuration can be generated for
+const (
+	debuggerNode   = "node"
+	debuggerJava   = "java"
+	debuggerPython = "python"
+)
+
+// well known debug ports, used when the stack does not set APPSODY_DEBUG_PORT
+var defaultDebugPorts = map[string]string{
+	"9229": debuggerNode,
+	"5005": debuggerJava,
+	"7777": debuggerJava,
+	"8000": debuggerJava,
+	"5678": debuggerPython,
+}
+
+// ideDebugTarget is what the generated configuration attaches to
+type ideDebugTarget struct {
+	name       string
+	debugger   string
+	hostPort   int
+	remoteRoot string
+}
+
+func checkIDE(ide string) error {
+	for _, supportedIDE := range supportedIDEs {
+		if ide == supportedIDE {
+			return nil
+		}
+	}
+	return errors.Errorf("The IDE %s is not supported. Use one of: %s", ide, strings.Join(supportedIDEs, ", "))
+}
+
+// the stack image names of the debuggers
+var (
+	nodeStackName   = regexp.MustCompile(`node|express|loopback`)
+	javaStackName   = regexp.MustCompile(`java|spring|microprofile|quarkus|liberty`)
+	pythonStackName = regexp.MustCompile(`python|flask|django`)
+)
+
+// guessDebugger guesses the debugger from the stack image name, then from the debug port
+func guessDebugger(stackImage string, debugPort string) string {
+	stackName := strings.ToLower(stackImage)
+	if index := strings.LastIndex(stackName, "/"); index >= 0 {
+		stackName = stackName[index+1:]
+	}
+	switch {
+	case nodeStackName.MatchString(stackName):
+		return debuggerNode
+	case javaStackName.MatchString(stackName):
+		return debuggerJava
+	case pythonStackName.MatchString(stackName):
+		return debuggerPython
+	}
+	return defaultDebugPorts[debugPort]
+}
+
+// getProjectContainerDir returns the container directory the project directory is mounted to
+func getProjectContainerDir(config *RootCommandConfig) (string, error) {
+	stackMounts, err := GetEnvVar("APPSODY_MOUNTS", config)
+	if err != nil {
+		return "", err
+	}
+	for _, mount := range strings.Split(stackMounts, ";") {
+		if strings.HasPrefix(mount, ".:") {
+			return strings.TrimPrefix(mount, ".:"), nil
+		}
+	}
+	return GetEnvVar("APPSODY_PROJECT_DIR", config)
+}
+
+// getDebugTarget works out the debug port of the stack and the host port it is published to.
+// It returns no target when the debug port is published by --publish-all, as docker only assigns its host port when the container starts.
+func getDebugTarget(config *devCommonConfig) (*ideDebugTarget, error) {
+	projectConfig, err := getProjectConfig(config.RootCommandConfig)
+	if err != nil {
+		return nil, err
+	}
+	debugPort, err := GetEnvVar("APPSODY_DEBUG_PORT", config.RootCommandConfig)
+	if err != nil {
+		return nil, err
+	}
+	if debugPort == "" {
+		exposedPorts, portsErr := getExposedPorts(config.RootCommandConfig)
+		if portsErr != nil {
+			return nil, portsErr
+		}
+		for _, port := range exposedPorts {
+			if _, found := defaultDebugPorts[port]; found {
+				debugPort = port
+				break
+			}
+		}
+	}
+	if debugPort == "" {
+		return nil, errors.Errorf("Could not determine the debug port of the stack %s: it does not set APPSODY_DEBUG_PORT or expose a well known debug port", projectConfig.Platform)
+	}
+	Debug.log("Debug port of the stack: ", debugPort)
+	hostPort := ""
+	for _, mapping := range config.portMappings {
+		ports := strings.Split(mapping, ":")
+		if len(ports) >= 2 && ports[len(ports)-1] == debugPort {
+			hostPort = ports[len(ports)-2]
+		}
+	}
+	if hostPort == "" && config.publishAllPorts {
+		Warning.logf("Not writing the %s debug configuration: the debug port %s is published to a random host port with --publish-all. Publish it with --publish <host port>:%s, or find its host port with docker port %s %s", config.ide, debugPort, debugPort, config.containerName, debugPort)
+		return nil, nil
+	}
+	if hostPort == "" {
+		return nil, errors.Errorf("The debug port %s is not published to a known host port. Publish it with --publish <host port>:%s", debugPort, debugPort)
+	}
+	hostPortNumber, err := strconv.Atoi(hostPort)
+	if err != nil {
+		return nil, errors.Errorf("The debug port %s is published to an invalid host port %s", debugPort, hostPort)
+	}
+	debugger := guessDebugger(projectConfig.Platform, debugPort)
+	if debugger == "" {
+		return nil, errors.Errorf("Could not determine the language of the stack %s to generate a debug configuration", projectConfig.Platform)
+	}
+	remoteRoot, err := getProjectContainerDir(config.RootCommandConfig)
+	if err != nil {
+		return nil, err
+	}
+	projectName, err := getProjectName(config.RootCommandConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &ideDebugTarget{
+		name:       "Appsody: Attach to " + projectName,
+		debugger:   debugger,
+		hostPort:   hostPortNumber,
+		remoteRoot: remoteRoot,
+	}, nil
+}
+
+// writeIDEConfig writes the debug configuration of the IDE into the project directory
+func writeIDEConfig(config *devCommonConfig) error {
+	target, err := getDebugTarget(config)
+	if err != nil || target == nil {
+		return err
+	}
+	projectDir, err := getProjectDir(config.RootCommandConfig)
+	if err != nil {
+		return err
+	}
+	var configFile string
+	var content []byte
+	if config.ide == ideVSCode {
+		configFile = filepath.Join(projectDir, ".vscode", "launch.json")
+		content, err = vscodeLaunchConfig(configFile, target)
+	} else {
+		configFile = filepath.Join(projectDir, ".idea", "runConfigurations", "Appsody_Debug.xml")
+		content, err = intellijRunConfig(target)
+	}
+	if err != nil {
+		return err
+	}
+	if config.Dryrun {
+		Info.log("Dry Run - Skipping write of the debug configuration ", configFile)
+		return nil
+	}
+	err = os.MkdirAll(filepath.Dir(configFile), os.ModePerm)
+	if err != nil {
+		return errors.Errorf("Could not create the directory for %s: %v", configFile, err)
+	}
+	err = ioutil.WriteFile(configFile, content, 0644)
+	if err != nil {
+		return errors.Errorf("Could not write the debug configuration %s: %v", configFile, err)
+	}
+	Info.logf("Wrote the %s debug configuration \"%s\" to %s, attaching to localhost:%d", config.ide, target.name, configFile, target.hostPort)
+	return nil
+}
+
+// vscodeLaunchConfig adds the debug configuration to the launch.json file, replacing
+// a configuration with the same name and keeping the others
+func vscodeLaunchConfig(launchFile string, target *ideDebugTarget) ([]byte, error) {
+	launch := map[string]interface{}{"version": "0.2.0"}
+	existing, err := ioutil.ReadFile(launchFile)
+	if err == nil {
+		err = json.Unmarshal(existing, &launch)
+		if err != nil {
+			return nil, errors.Errorf("Could not update %s, it is not valid JSON (comments are not supported): %v", launchFile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Errorf("Could not read %s: %v", launchFile, err)
+	}
+
+	configuration := map[string]interface{}{
+		"name":    target.name,
+		"request": "attach",
+	}
+	switch target.debugger {
+	case debuggerNode:
+		configuration["type"] = "node"
+		configuration["address"] = "localhost"
+		configuration["port"] = target.hostPort
+		configuration["localRoot"] = "${workspaceFolder}"
+		configuration["remoteRoot"] = target.remoteRoot
+		configuration["restart"] = true
+	case debuggerJava:
+		configuration["type"] = "java"
+		configuration["hostName"] = "localhost"
+		configuration["port"] = target.hostPort
+	case debuggerPython:
+		configuration["type"] = "python"
+		configuration["connect"] = map[string]interface{}{"host": "localhost", "port": target.hostPort}
+		configuration["pathMappings"] = []interface{}{
+			map[string]interface{}{"localRoot": "${workspaceFolder}", "remoteRoot": target.remoteRoot},
+		}
+	}
+
+	configurations, _ := launch["configurations"].([]interface{})
+	replaced := false
+	for i, existingConfiguration := range configurations {
+		if entry, ok := existingConfiguration.(map[string]interface{}); ok && entry["name"] == target.name {
+			configurations[i] = configuration
+			replaced = true
+		}
+	}
+	if !replaced {
+		configurations = append(configurations, configuration)
+	}
+	launch["configurations"] = configurations
+	content, err := json.MarshalIndent(launch, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append(content, '\n'), nil
+}
+
+func xmlEscape(value string) string {
+	var buffer bytes.Buffer
+	_ = xml.EscapeText(&buffer, []byte(value))
+	return buffer.String()
+}
+
+// intellijRunConfig returns a remote debug run configuration for IntelliJ IDEA
+func intellijRunConfig(target *ideDebugTarget) ([]byte, error) {
+	var configuration string
+	switch target.debugger {
+	case debuggerJava:
+		configuration = fmt.Sprintf(`  <configuration default="false" name="%s" type="Remote">
+    <option name="USE_SOCKET_TRANSPORT" value="true" />
+    <option name="SERVER_MODE" value="false" />
+    <option name="SHMEM_ADDRESS" />
+    <option name="HOST" value="localhost" />
+    <option name="PORT" value="%d" />
+    <option name="AUTO_RESTART" value="false" />
+    <RunnerSettings RunnerId="Debug">
+      <option name="DEBUG_PORT" value="%d" />
+      <option name="LOCAL" value="false" />
+    </RunnerSettings>
+    <method v="2" />
+  </configuration>
+`, xmlEscape(target.name), target.hostPort, target.hostPort)
+	case debuggerNode:
+		configuration = fmt.Sprintf(`  <configuration default="false" name="%s" type="ChromiumRemoteDebugType" factoryName="Chromium Remote" port="%d" restartOnDisconnect="true">
+    <mappings>
+      <list>
+        <mapping local-file="$PROJECT_DIR$" url="file://%s" />
+      </list>
+    </mappings>
+    <method v="2" />
+  </configuration>
+`, xmlEscape(target.name), target.hostPort, xmlEscape(target.remoteRoot))
+	default:
+		return nil, errors.Errorf("IntelliJ debug configurations can only be generated for Java and Node.js stacks, not for %s", target.debugger)
+	}
+	return []byte("<component name=\"ProjectRunConfigurationManager\">\n" + configuration + "</component>\n"), nil
+}
@@ -0,0 +1,222 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd"
+	"github.com/appsody/appsody/cmd/cmdtest"
+)
+
+func TestDebugUnsupportedIDE(t *testing.T) {
+
+	args := []string{"debug", "--ide", "eclipse"}
+	output, err := cmdtest.RunAppsodyCmdExec(args, ".")
+
+	if err == nil {
+		t.Error("Expected an error when using an unsupported IDE")
+	}
+	if !strings.Contains(output, "The IDE eclipse is not supported. Use one of: vscode, intellij") {
+		t.Error("String \"The IDE eclipse is not supported. Use one of: vscode, intellij\" not found in output")
+	} else {
+		t.Log("Found the correct error string")
+	}
+}
+
+func TestGuessDebugger(t *testing.T) {
+	var tests = []struct {
+		stackImage string
+		debugPort  string
+		debugger   string
+	}{
+		{"appsody/nodejs-express:0.4", "9229", "node"},
+		{"appsody/java-microprofile:0.2", "7777", "java"},
+		{"docker.io/appsody/python-flask:0.2", "5678", "python"},
+		// kitura is a Swift stack
+		{"appsody/swift-kitura:0.2", "", ""},
+		{"appsody/kitura:0.2", "", ""},
+		// the debug port is used when the stack name is not known
+		{"example/custom-stack:1.0", "5005", "java"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.stackImage, func(t *testing.T) {
+			if debugger := cmd.GuessDebugger(tt.stackImage, tt.debugPort); debugger != tt.debugger {
+				t.Errorf("Expected the debugger %q for %s, but got %q", tt.debugger, tt.stackImage, debugger)
+			}
+		})
+	}
+}
+
+func TestVscodeLaunchConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "appsody-debug-ide")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	launchFile := filepath.Join(dir, "launch.json")
+	existing := `{
+    "version": "0.2.0",
+    "compounds": [],
+    "configurations": [
+        {"name": "Launch locally", "type": "node", "request": "launch"},
+        {"name": "Appsody: Attach to my-project", "type": "node", "request": "attach", "port": 1234}
+    ]
+}`
+	err = ioutil.WriteFile(launchFile, []byte(existing), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		debugger string
+		expected map[string]interface{}
+	}{
+		{"node", map[string]interface{}{"name": "Appsody: Attach to my-project", "request": "attach", "type": "node", "address": "localhost", "port": 9230.0, "localRoot": "${workspaceFolder}", "remoteRoot": "/project/user-app", "restart": true}},
+		{"java", map[string]interface{}{"name": "Appsody: Attach to my-project", "request": "attach", "type": "java", "hostName": "localhost", "port": 9230.0}},
+		{"python", map[string]interface{}{"name": "Appsody: Attach to my-project", "request": "attach", "type": "python",
+			"connect":      map[string]interface{}{"host": "localhost", "port": 9230.0},
+			"pathMappings": []interface{}{map[string]interface{}{"localRoot": "${workspaceFolder}", "remoteRoot": "/project/user-app"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.debugger, func(t *testing.T) {
+			content, err := cmd.VscodeLaunchConfig(launchFile, "Appsody: Attach to my-project", tt.debugger, 9230, "/project/user-app")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var launch struct {
+				Version        string                   `json:"version"`
+				Compounds      []interface{}            `json:"compounds"`
+				Configurations []map[string]interface{} `json:"configurations"`
+			}
+			err = json.Unmarshal(content, &launch)
+			if err != nil {
+				t.Fatalf("The launch configuration is not valid JSON: %v\n%s", err, content)
+			}
+			if launch.Version != "0.2.0" || launch.Compounds == nil {
+				t.Errorf("Expected the version and the compounds of the existing launch.json to be kept, got:\n%s", content)
+			}
+			if len(launch.Configurations) != 2 {
+				t.Fatalf("Expected the existing configuration to be kept and the Appsody one to be replaced, got:\n%s", content)
+			}
+			if launch.Configurations[0]["name"] != "Launch locally" {
+				t.Errorf("Expected the first configuration to be kept, got %v", launch.Configurations[0])
+			}
+			if !reflect.DeepEqual(launch.Configurations[1], tt.expected) {
+				t.Errorf("Expected the configuration %v, got %v", tt.expected, launch.Configurations[1])
+			}
+		})
+	}
+}
+
+func TestVscodeLaunchConfigNewFile(t *testing.T) {
+	content, err := cmd.VscodeLaunchConfig(filepath.Join("testdata", "missing", "launch.json"), "Appsody: Attach to my-project", "java", 5005, "/project/user-app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var launch map[string]interface{}
+	err = json.Unmarshal(content, &launch)
+	if err != nil {
+		t.Fatalf("The launch configuration is not valid JSON: %v\n%s", err, content)
+	}
+	configurations, _ := launch["configurations"].([]interface{})
+	if launch["version"] != "0.2.0" || len(configurations) != 1 {
+		t.Errorf("Expected a launch.json with the version and one configuration, got:\n%s", content)
+	}
+}
+
+func TestVscodeLaunchConfigInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "appsody-debug-ide")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	launchFile := filepath.Join(dir, "launch.json")
+	err = ioutil.WriteFile(launchFile, []byte("{\n    // a comment\n}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cmd.VscodeLaunchConfig(launchFile, "Appsody: Attach to my-project", "node", 9229, "/project/user-app")
+	if err == nil || !strings.Contains(err.Error(), "it is not valid JSON") {
+		t.Errorf("Expected an error for the launch.json with comments, got %v", err)
+	}
+}
+
+func TestIntellijRunConfig(t *testing.T) {
+	var tests = []struct {
+		debugger string
+		expected []string
+		err      string
+	}{
+		{debugger: "java", expected: []string{`type="Remote"`, `<option name="PORT" value="5006" />`, `<option name="DEBUG_PORT" value="5006" />`}},
+		{debugger: "node", expected: []string{`type="ChromiumRemoteDebugType"`, `port="5006"`, `url="file:///project/user-app"`}},
+		{debugger: "python", err: "IntelliJ debug configurations can only be generated for Java and Node.js stacks, not for python"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.debugger, func(t *testing.T) {
+			content, err := cmd.IntellijRunConfig("Appsody: Attach to <my-project>", tt.debugger, 5006, "/project/user-app")
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("Expected the error %s, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var component struct {
+				Name          string `xml:"name,attr"`
+				Configuration struct {
+					Name string `xml:"name,attr"`
+				} `xml:"configuration"`
+			}
+			err = xml.Unmarshal(content, &component)
+			if err != nil {
+				t.Fatalf("The run configuration is not valid XML: %v\n%s", err, content)
+			}
+			if component.Name != "ProjectRunConfigurationManager" || component.Configuration.Name != "Appsody: Attach to <my-project>" {
+				t.Errorf("Expected the escaped configuration name in a ProjectRunConfigurationManager component, got:\n%s", content)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(string(content), expected) {
+					t.Errorf("Expected %s in the run configuration, got:\n%s", expected, content)
+				}
+			}
+		})
+	}
+}
+
+func TestDebugIDEPublishAll(t *testing.T) {
+	project, cleanup := newTestProject(t, "ide-project", "test/nodejs-ide:0.1.0",
+		`{"Id": "sha256:5678", "Config": {"Env": ["APPSODY_MOUNTS=.:/project/user-app", "APPSODY_DEBUG_PORT=9229"], "ExposedPorts": {"9229/tcp": {}}}}`)
+	defer cleanup()
+
+	output, err := cmdtest.RunAppsodyCmd(project.appsodyArgs("debug", "--dryrun", "--ide", "vscode", "--publish-all"), project.dir)
+	if err != nil {
+		t.Fatalf("Expected debug --ide to continue with --publish-all: %v. CLI output:\n%s", err, output)
+	}
+	if !strings.Contains(output, "the debug port 9229 is published to a random host port with --publish-all") {
+		t.Errorf("Expected a warning that the debug configuration is not written. CLI output:\n%s", output)
+	}
+	if !strings.Contains(output, " -P ") {
+		t.Errorf("Expected the container to be run with -P. CLI output:\n%s", output)
+	}
+}
@@ -33,8 +33,10 @@ import (
 
 type deployCommandConfig struct {
 	*RootCommandConfig
-	appDeployFile, namespace, tag  string
-	knative, generate, force, push bool
+	appDeployFile, namespace, tag, tagStrategy string
+	knative, generate, force, push             bool
+	buildArgs                                  []string
+	target                                     string
 }
 
 type AppsodyApplication struct {
@@ -112,7 +114,7 @@ generates a deployment manifest (yaml) file if one is not present, and uses it t
 			if !exists || (exists && config.force) {
 				err = generateDeploymentConfig(config)
 				if err != nil {
-					if err.Error() == "docker cp command failed: exit status 1" {
+					if strings.HasSuffix(err.Error(), "cp command failed: exit status 1") {
 						Warning.log("No deployment config is present in the stack. Falling back to default deploy config using Knative.")
 						return deployWithKnative(config)
 					}
@@ -134,11 +136,25 @@ generates a deployment manifest (yaml) file if one is not present, and uses it t
 			if deployImage == "" {
 				deployImage = applicationImage
 				// deployImage = "dev.local/" + projectName
+				tagStrategy, err := getTagStrategy(config.RootCommandConfig, config.tagStrategy)
+				if err != nil {
+					return err
+				}
+				if tagStrategy != "" {
+					// the tag of the previous deploy is not deployed again, the tag strategy computes the new one
+					deployImage = imageRepository(applicationImage)
+				}
+			}
+			gitInfo := getProjectGitInfo()
+			images, err := getBuildImages(config.RootCommandConfig, gitInfo, deployImage, config.tagStrategy, "")
+			if err != nil {
+				return err
 			}
+			deployImage = images[0]
 
 			// Extract code and build the image - and tags it if -t is specified
-			buildConfig := &buildCommandConfig{RootCommandConfig: config.RootCommandConfig}
-			buildConfig.tag = deployImage
+			buildConfig := &buildCommandConfig{RootCommandConfig: config.RootCommandConfig, buildArgs: config.buildArgs, target: config.target}
+			buildConfig.images, buildConfig.gitInfo = images, gitInfo
 			buildErr := build(buildConfig)
 			if buildErr != nil {
 				return buildErr
@@ -205,9 +221,15 @@ generates a deployment manifest (yaml) file if one is not present, and uses it t
 			w.Flush()
 
 			if config.push {
-				err = DockerPush(deployImage, dryrun)
+				engine, err := getContainerEngine(config.RootCommandConfig)
 				if err != nil {
-					return errors.Errorf("Could not push the docker image - exiting. Error: %v", err)
+					return err
+				}
+				for _, image := range images {
+					_, err = pushWithRetries(image, func() (string, error) { return engine.Push(image, dryrun) })
+					if err != nil {
+						return errors.Errorf("Could not push the docker image - exiting. Error: %v", err)
+					}
 				}
 			}
 			err = KubeApply(configFile, namespace, dryrun)
@@ -240,20 +262,32 @@ generates a deployment manifest (yaml) file if one is not present, and uses it t
 	deployCmd.PersistentFlags().BoolVar(&config.force, "force", false, "Force the reuse of the deployment configuration file if one exists.")
 	deployCmd.PersistentFlags().StringVarP(&config.namespace, "namespace", "n", "default", "Target namespace in your Kubernetes cluster")
 	deployCmd.PersistentFlags().StringVarP(&config.tag, "tag", "t", "", "Docker image name and optionally a tag in the 'name:tag' format")
+	addTagStrategyFlag(deployCmd, &config.tagStrategy)
 	deployCmd.PersistentFlags().BoolVar(&config.push, "push", false, "Push this image to an external Docker registry. Assumes that you have previously successfully done docker login")
 	deployCmd.PersistentFlags().BoolVar(&config.knative, "knative", false, "Deploy as a Knative Service")
+	addBuildArgFlags(deployCmd, &config.buildArgs, &config.target)
+	addPullPolicyFlag(deployCmd, rootConfig)
 
 	deployCmd.AddCommand(newDeleteDeploymentCmd(config))
 	return deployCmd
 }
 
 func deployWithKnative(config *deployCommandConfig) error {
-	buildConfig := &buildCommandConfig{RootCommandConfig: config.RootCommandConfig}
-	buildConfig.tag = config.tag
+	gitInfo := getProjectGitInfo()
+	images, err := getBuildImages(config.RootCommandConfig, gitInfo, config.tag, config.tagStrategy, "")
+	if err != nil {
+		return err
+	}
+	buildConfig := &buildCommandConfig{RootCommandConfig: config.RootCommandConfig, buildArgs: config.buildArgs, target: config.target}
+	buildConfig.images, buildConfig.gitInfo = images, gitInfo
 	buildErr := build(buildConfig)
 	if buildErr != nil {
 		return buildErr
 	}
+	engine, err := getContainerEngine(config.RootCommandConfig)
+	if err != nil {
+		return err
+	}
 	//Generate the KNative yaml
 	//Get the container port first
 	port, err := getEnvVarInt("PORT", config.RootCommandConfig)
@@ -288,15 +322,12 @@ func deployWithKnative(config *deployCommandConfig) error {
 	}
 	//Get the project name and make it the KNative service name
 	serviceName := projectName
-	deployImage := projectName // if not tagged, this is the deploy image name
-	if config.tag != "" {
-		deployImage = config.tag //Otherwise, it's the tag
-	}
+	deployImage := images[0] // the project name, or the tag when it is specified
 	// We're not pushing to a repository, so we need to use dev.local for Knative to be able to find it
 	if !config.push {
 		localtag := "dev.local/" + projectName
 		// Tagging the image using the tag as the deployImage for KNative
-		err = DockerTag(deployImage, localtag, config.Dryrun)
+		err = engine.Tag(deployImage, localtag, config.Dryrun)
 		if err != nil {
 			return errors.Errorf("Tagging the image failed - exiting. Error: %v", err)
 		}
@@ -309,11 +340,13 @@ func deployWithKnative(config *deployCommandConfig) error {
 		return errors.Errorf("Could not generate the KNative YAML file: %v", err)
 	}
 	Info.log("Generated KNative serving deploy file: ", yamlFileName)
-	// Pushing the docker image if necessary
+	// Pushing the docker images if necessary
 	if config.push {
-		err = DockerPush(deployImage, config.Dryrun)
-		if err != nil {
-			return errors.Errorf("Could not push the docker image - exiting. Error: %v", err)
+		for _, image := range images {
+			_, err = pushWithRetries(image, func() (string, error) { return engine.Push(image, config.Dryrun) })
+			if err != nil {
+				return errors.Errorf("Could not push the docker image - exiting. Error: %v", err)
+			}
 		}
 	}
 	err = KubeApply(yamlFileName, config.namespace, config.Dryrun)
@@ -347,7 +380,11 @@ func generateDeploymentConfig(config *deployCommandConfig) error {
 	if configErr != nil {
 		return configErr
 	}
-	err = CheckPrereqs()
+	engine, err := getContainerEngine(config.RootCommandConfig)
+	if err != nil {
+		return err
+	}
+	err = CheckPrereqs(config.RootCommandConfig)
 	if err != nil {
 		Warning.logf("Failed to check prerequisites: %v\n", err)
 	}
@@ -355,8 +392,6 @@ func generateDeploymentConfig(config *deployCommandConfig) error {
 	Debug.log("Stack image: ", stackImage)
 	Debug.log("Config directory: ", containerConfigDir)
 
-	var cmdName string
-	var cmdArgs []string
 	pullErr := pullImage(stackImage, config.RootCommandConfig)
 	if pullErr != nil {
 		return pullErr
@@ -366,41 +401,36 @@ func generateDeploymentConfig(config *deployCommandConfig) error {
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-c
-		err := dockerStop(extractContainerName, config.Dryrun)
+		err := engine.Stop(extractContainerName, config.Dryrun)
 		if err != nil {
 			Error.log(err)
 		}
 		os.Exit(1)
 	}()
-	cmdName = "docker"
 	var configDir string
-	cmdArgs = []string{"--name", extractContainerName}
-
-	cmdArgs = append([]string{"create"}, cmdArgs...)
-	cmdArgs = append(cmdArgs, stackImage)
-	err = execAndWaitReturnErr(cmdName, cmdArgs, Debug, config.Dryrun)
+	cmdArgs := []string{"--name", extractContainerName, stackImage}
+	err = engine.Create(cmdArgs, config.Dryrun)
 	if err != nil {
 
-		Error.log("docker create command failed: ", err)
-		removeErr := containerRemove(extractContainerName, false, config.Dryrun)
+		Error.log(engine.Command(), " create command failed: ", err)
+		removeErr := engine.Remove(extractContainerName, config.Dryrun)
 		Error.log("Error in containerRemove", removeErr)
 		return err
 	}
 	configDir = extractContainerName + ":" + containerConfigDir
 
-	cmdArgs = []string{"cp", configDir, "./" + configFile}
-	err = execAndWaitReturnErr(cmdName, cmdArgs, Debug, config.Dryrun)
+	err = engine.Cp(configDir, "./"+configFile, config.Dryrun)
 	if err != nil {
-		Error.log("docker cp command failed: ", err)
+		Error.log(engine.Command(), " cp command failed: ", err)
 
-		removeErr := containerRemove(extractContainerName, false, config.Dryrun)
+		removeErr := engine.Remove(extractContainerName, config.Dryrun)
 		if removeErr != nil {
 			Error.log("containerRemove error ", removeErr)
 		}
-		return errors.Errorf("docker cp command failed: %v", err)
+		return errors.Errorf("%s cp command failed: %v", engine.Command(), err)
 	}
 
-	removeErr := containerRemove(extractContainerName, false, config.Dryrun)
+	removeErr := engine.Remove(extractContainerName, config.Dryrun)
 	if removeErr != nil {
 		Error.log("containerRemove error ", removeErr)
 	}
@@ -0,0 +1,82 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd/cmdtest"
+)
+
+// the deployment manifest of a previous deploy, which deployed the image tagged with a commit SHA
+const deployedApplication = `apiVersion: appsody.dev/v1beta1
+kind: AppsodyApplication
+metadata:
+  name: deploy-project
+spec:
+  applicationImage: registry.example.com/deploy-project:0123456789ab
+  createKnativeService: false
+`
+
+func TestDeployTagStrategy(t *testing.T) {
+	project, cleanup := newTestProject(t, "deploy-project", "test/deploy-stack:0.1", "")
+	defer cleanup()
+	project.writeFiles(t, map[string]string{
+		".appsody-config.yaml": "stack: test/deploy-stack:0.1\nversion: 1.0.0\n",
+	})
+	// the operator is installed from a fake release, as there is none in the cluster of the dry run
+	operatorRelease := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("apiVersion: v1\nkind: List\nitems: []\n"))
+	}))
+	defer operatorRelease.Close()
+	err := ioutil.WriteFile(project.configFile, []byte("home: "+project.home+"\noperator: "+operatorRelease.URL+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		testName string
+		args     []string
+		expected string
+	}{
+		{"tag strategy", []string{"--tag-strategy", "semver-from-config,latest"}, "registry.example.com/deploy-project:1.0.0"},
+		{"no tag strategy", nil, "registry.example.com/deploy-project:0123456789ab"},
+		{"tag", []string{"-t", "other/deploy-project:rc1", "--tag-strategy", "latest"}, "other/deploy-project:rc1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			project.writeFiles(t, map[string]string{"app-deploy.yaml": deployedApplication})
+			args := project.appsodyArgs(append([]string{"deploy", "--dryrun"}, tt.args...)...)
+			output, err := cmdtest.RunAppsodyCmd(args, project.dir)
+			if err != nil {
+				t.Fatalf("%v. CLI output:\n%s", err, output)
+			}
+			if !strings.Contains(output, "Using applicationImage of: "+tt.expected+"\n") {
+				t.Errorf("Expected the deployment to use the image %s. CLI output:\n%s", tt.expected, output)
+			}
+			manifest, err := ioutil.ReadFile(filepath.Join(project.dir, "app-deploy.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(manifest), "applicationImage: "+tt.expected+"\n") {
+				t.Errorf("Expected the deployment manifest to have the image %s:\n%s", tt.expected, manifest)
+			}
+		})
+	}
+}
@@ -16,16 +16,17 @@ package cmd
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
 	"os/user"
-	"path/filepath"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
-	"time"
 
+	"github.com/gosuri/uitable"
 	"github.com/pkg/errors"
 
 	"github.com/spf13/cobra"
@@ -41,23 +42,15 @@ type devCommonConfig struct {
 	interactive     bool
 	dockerNetwork   string
 	dockerOptions   string
-}
-
-func checkDockerRunOptions(options []string) error {
-	fmt.Println("testing docker options", options)
-	//runOptionsTest := "(^((-p)|(--publish)|(--publish-all)|(-P)|(-u)|(--user)|(--name)|(--network)|(-t)|(--tty)|(--rm)|(--entrypoint)|(-v)|(--volume)|(-e)|(--env))((=?$)|(=.*)))"
-	runOptionsTest := "(^((--help)|(-p)|(--publish)|(--publish-all)|(-P)|(-u)|(--user)|(--name)|(--network)|(-t)|(--tty)|(--rm)|(--entrypoint)|(-v)|(--volume))((=?$)|(=.*)))"
-
-	blackListedRunOptionsRegexp := regexp.MustCompile(runOptionsTest)
-	for _, value := range options {
-		isInBlackListed := blackListedRunOptionsRegexp.MatchString(value)
-		if isInBlackListed {
-			return errors.Errorf("%s is not allowed in --docker-options", value)
-
-		}
-	}
-	return nil
-
+	autoPorts       bool
+	ide             string
+	resetDeps       bool
+	portMappings    []string
+	profile         string
+	envVars         []string
+	target          string
+	namespace       string
+	syncBack        []string
 }
 
 func addNameFlag(cmd *cobra.Command, flagVar *string, config *RootCommandConfig) {
@@ -93,13 +86,22 @@ func addDevCommonFlags(cmd *cobra.Command, config *devCommonConfig) {
 	cmd.PersistentFlags().StringVar(&config.depsVolumeName, "deps-volume", defaultDepsVolume, "Docker volume to use for dependencies. Mounts to APPSODY_DEPS dir.")
 	cmd.PersistentFlags().StringArrayVarP(&config.ports, "publish", "p", nil, "Publish the container's ports to the host. The stack's exposed ports will always be published, but you can publish addition ports or override the host ports with this option.")
 	cmd.PersistentFlags().BoolVarP(&config.publishAllPorts, "publish-all", "P", false, "Publish all exposed ports to random ports")
+	cmd.PersistentFlags().BoolVar(&config.autoPorts, "auto-ports", false, "If a host port needed to publish the stack's exposed ports is already in use, publish it on a free host port instead of failing.")
 	cmd.PersistentFlags().BoolVar(&config.disableWatcher, "no-watcher", false, "Disable file watching, regardless of container environment variable settings.")
 	cmd.PersistentFlags().BoolVarP(&config.interactive, "interactive", "i", false, "Attach STDIN to the container for interactive TTY mode")
 	cmd.PersistentFlags().StringVar(&config.dockerOptions, "docker-options", "", "Specify the docker run options to use.  Value must be in \"\".")
+	addPullPolicyFlag(cmd, config.RootCommandConfig)
+	addProfileFlag(cmd, config)
+	addTargetFlags(cmd, &config.target, &config.namespace)
+	addSyncBackFlag(cmd, config)
 
 }
 
 func commonCmd(config *devCommonConfig, mode string) error {
+	targetErr := checkTarget(config.target)
+	if targetErr != nil {
+		return targetErr
+	}
 
 	projectDir, perr := getProjectDir(config.RootCommandConfig)
 	if perr != nil {
@@ -110,7 +112,11 @@ func commonCmd(config *devCommonConfig, mode string) error {
 	if configErr != nil {
 		return configErr
 	}
-	err := CheckPrereqs()
+	engine, engineErr := getContainerEngine(config.RootCommandConfig)
+	if engineErr != nil {
+		return engineErr
+	}
+	err := CheckPrereqs(config.RootCommandConfig)
 	if err != nil {
 		Warning.logf("Failed to check prerequisites: %v\n", err)
 	}
@@ -124,6 +130,9 @@ func commonCmd(config *devCommonConfig, mode string) error {
 	if pullErr != nil {
 		return pullErr
 	}
+	if config.onKubernetes() {
+		return runOnKubernetes(config, platformDefinition)
+	}
 
 	volumeMaps, volumeErr := getVolumeArgs(config.RootCommandConfig)
 	if volumeErr != nil {
@@ -135,93 +144,33 @@ func commonCmd(config *devCommonConfig, mode string) error {
 		return envErr
 	}
 	if depsEnvVar != "" {
+		volumeErr := prepareDepsVolume(config)
+		if volumeErr != nil {
+			return volumeErr
+		}
 		depsMount := config.depsVolumeName + ":" + depsEnvVar
 		Debug.log("Adding dependency cache to volume mounts: ", depsMount)
 		volumeMaps = append(volumeMaps, "-v", depsMount)
 	}
 
 	// Mount the controller
-	destController := os.Getenv("APPSODY_MOUNT_CONTROLLER")
-	if destController != "" {
-		Debug.log("Overriding appsody-controller mount with APPSODY_MOUNT_CONTROLLER env variable: ", destController)
-	} else {
-		// Copy the controller from the installation directory to the home (.appsody)
-		destController = filepath.Join(getHome(config.RootCommandConfig), "appsody-controller")
-		// Debug.log("Attempting to load the controller from ", destController)
-		//if _, err := os.Stat(destController); os.IsNotExist(err) {
-		// Always copy it from the executable dir
-		//Retrieving the path of the binaries appsody and appsody-controller
-		//Debug.log("Didn't find the controller in .appsody - copying from the binary directory...")
-		executable, _ := os.Executable()
-		binaryLocation, err := filepath.Abs(filepath.Dir(executable))
-		Debug.log("Binary location ", binaryLocation)
-		if err != nil {
-			return errors.New("fatal error - can't retrieve the binary path... exiting")
-		}
-		controllerExists, existsErr := Exists(destController)
-		if existsErr != nil {
-			return existsErr
-		}
-		Debug.log("appsody-controller exists: ", controllerExists)
-		checksumMatch := false
-		if controllerExists {
-			var checksumMatchErr error
-			binaryControllerPath := filepath.Join(binaryLocation, "appsody-controller")
-			binaryControllerExists, existsErr := Exists(binaryControllerPath)
-			if existsErr != nil {
-				return existsErr
-			}
-			if binaryControllerExists {
-				checksumMatch, checksumMatchErr = checksum256TestFile(binaryControllerPath, destController)
-				Debug.log("checksum returned: ", checksumMatch)
-				if checksumMatchErr != nil {
-					return checksumMatchErr
-				}
-			} else {
-				//the binary controller did not exist so skip copying it
-				Warning.log("The binary controller could not be found.")
-				checksumMatch = true
-			}
-		}
-		// if the controller doesn't exist
-		if !controllerExists || (controllerExists && !checksumMatch) {
-			Debug.log("Replacing Controller")
-
-			//Construct the appsody-controller mount
-			sourceController := filepath.Join(binaryLocation, "appsody-controller")
-			if config.Dryrun {
-				Info.logf("Dry Run - Skipping copy of controller binary from %s to %s", sourceController, destController)
-			} else {
-				Debug.log("Attempting to copy the source controller from: ", sourceController)
-				//Copy the controller from the binary location to $HOME/.appsody
-				copyError := CopyFile(sourceController, destController)
-				if copyError != nil {
-					return errors.Errorf("Cannot retrieve controller - exiting: %v", copyError)
-				}
-				// Making the controller executable in case CopyFile loses permissions
-				chmodErr := os.Chmod(destController, 0755)
-				if chmodErr != nil {
-					return errors.Errorf("Cannot make the controller  executable - exiting: %v", chmodErr)
-				}
-			}
-		}
-		//} Used to close the "if controller does not exist"
+	destController, controllerErr := getMountedController(config.RootCommandConfig)
+	if controllerErr != nil {
+		return controllerErr
 	}
 	controllerMount := destController + ":/appsody/appsody-controller"
 	Debug.log("Adding controller to volume mounts: ", controllerMount)
 	volumeMaps = append(volumeMaps, "-v", controllerMount)
-	if !config.Buildah {
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-		go func() {
-			<-c
-			err := dockerStop(config.containerName, config.Dryrun)
-			if err != nil {
-				Error.log(err)
-			}
-			//containerRemove(containerName) is not needed due to --rm flag
-		}()
-	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		err := engine.Stop(config.containerName, config.Dryrun)
+		if err != nil {
+			Error.log(err)
+		}
+		//containerRemove(containerName) is not needed due to --rm flag
+	}()
 	cmdArgs = []string{"--rm"}
 	validPorts, portError := checkPortInput(config.ports)
 	if !validPorts {
@@ -232,10 +181,19 @@ func commonCmd(config *devCommonConfig, mode string) error {
 	if portsErr != nil {
 		return portsErr
 	}
+	if config.ide != "" {
+		ideErr := writeIDEConfig(config)
+		if ideErr != nil {
+			return ideErr
+		}
+	}
 	cmdArgs = append(cmdArgs, "--name", config.containerName)
 	if config.dockerNetwork != "" {
 		cmdArgs = append(cmdArgs, "--network", config.dockerNetwork)
 	}
+	for _, env := range config.envVars {
+		cmdArgs = append(cmdArgs, "-e", env)
+	}
 	runAsLocal, boolErr := getEnvVarBool("APPSODY_USER_RUN_AS_LOCAL", config.RootCommandConfig)
 	if boolErr != nil {
 		return boolErr
@@ -251,11 +209,7 @@ func commonCmd(config *devCommonConfig, mode string) error {
 	}
 	if config.dockerOptions != "" {
 		Debug.logf("User provided Docker options: \"%s\"", config.dockerOptions)
-		dockerOptions := config.dockerOptions
-		dockerOptions = strings.TrimPrefix(dockerOptions, " ")
-		dockerOptions = strings.TrimSuffix(dockerOptions, " ")
-		dockerOptionsCmd := strings.Split(dockerOptions, " ")
-		err := checkDockerRunOptions(dockerOptionsCmd)
+		dockerOptionsCmd, err := parseDockerOptions(config.dockerOptions, dockerRunFlags)
 		if err != nil {
 			return err
 		}
@@ -271,122 +225,31 @@ func commonCmd(config *devCommonConfig, mode string) error {
 	if config.disableWatcher {
 		cmdArgs = append(cmdArgs, "--no-watcher")
 	}
-	if !config.Buildah {
-		Debug.logf("Attempting to start image %s with container name %s", platformDefinition, config.containerName)
-		execCmd, err := DockerRunAndListen(cmdArgs, Container, config.interactive, config.Verbose, config.Dryrun)
-		if config.Dryrun {
-			Info.log("Dry Run - Skipping execCmd.Wait")
-		} else {
-			if err == nil {
-				err = execCmd.Wait()
-			}
-		}
-		if err != nil {
-			// 'signal: interrupt'
-			// TODO presumably you can query the error itself
-			error := fmt.Sprintf("%s", err)
-			//Linux and Windows return a different error on Ctrl-C
-			if error == "signal: interrupt" || error == "exit status 2" {
-				Info.log("Closing down, development environment was interrupted.")
-			} else {
-				return errors.Errorf("Error in 'appsody %s': %s", mode, error)
-
-			}
-
-		} else {
-			Info.log("Closing down development environment.")
-		}
-
+	Debug.logf("Attempting to start image %s with container name %s", platformDefinition, config.containerName)
+	logPhase(phaseRunning, config.containerName)
+	execCmd, err := engine.RunAndListen(cmdArgs, Container, config.interactive, config.Verbose, config.Dryrun)
+	if config.Dryrun {
+		Info.log("Dry Run - Skipping execCmd.Wait")
 	} else {
-		//This is buildah path - so do a kube apply instead
-		dryrun := config.Dryrun
-
-		portList, portsErr := getExposedPorts(config.RootCommandConfig)
-		if portsErr != nil {
-			return portsErr
-		}
-		/*
-			projectName, err := getProjectName(config.RootCommandConfig)
-			if err != nil {
-				return err
-			}*/
-
-		projectDir, err := getProjectDir(config.RootCommandConfig)
-		if err != nil {
-			return err
-		}
-		deploymentYaml, err := GenDeploymentYaml(config.containerName, platformDefinition, portList, projectDir, config.containerName, dryrun)
-		if err != nil {
-			return err
-		}
-		//hack
-		namespace := ""
-		//endhack
-		err = KubeApply(deploymentYaml, namespace, dryrun)
-		if err != nil {
-			return err
-		}
-		serviceYaml, err := GenServiceYaml(config.containerName, portList, projectDir, dryrun)
-		if err != nil {
-			return err
+		if err == nil {
+			err = waitCommand(execCmd)
 		}
+	}
+	if err != nil {
+		// 'signal: interrupt'
+		// TODO presumably you can query the error itself
+		error := fmt.Sprintf("%s", err)
+		//Linux and Windows return a different error on Ctrl-C
+		if error == "signal: interrupt" || error == "exit status 2" {
+			Info.log("Closing down, development environment was interrupted.")
+		} else {
+			return errors.Errorf("Error in 'appsody %s': %s", mode, error)
 
-		err = KubeApply(serviceYaml, namespace, dryrun)
-		if err != nil {
-			return err
 		}
-		port := getIngressPort(config.RootCommandConfig)
-		// Generate the Ingress only if it makes sense - i.e. there's a port to expose
-		if port > 0 {
-			routeYaml, err := GenRouteYaml(config.containerName, projectDir, port, dryrun)
-			if err != nil {
-				return err
-			}
 
-			err = KubeApply(routeYaml, namespace, dryrun)
-			if err != nil {
-				return err
-			}
-		}
-		Info.log("Waiting 30 seconds for the container to start")
-		time.Sleep(30 * time.Second)
-		logSuccess := false
-		deploymentName := "deployment/" + config.containerName
-		var timeout = "2m"
-		kubeArgs := []string{"logs", deploymentName, "-f", "--pod-running-timeout=" + timeout}
-		for logCount := 0; logCount < 3; logCount++ {
-
-			execCmd, kubeErr := RunKubeCommandAndListen(kubeArgs, Container, config.interactive, config.Verbose, config.Dryrun)
-			if config.Dryrun {
-				Info.log("Dry Run - Skipping execCmd.Wait")
-			} else {
-				if kubeErr == nil {
-					logSuccess = true
-					err = execCmd.Wait()
-
-					if err != nil {
-
-						return err
-					}
-				} else {
-					if logCount < 3 {
-						Debug.logf("kubectl error, could not obtain logs, pod may not have started.  Sleeping and retrying %b", logCount)
-
-						time.Sleep(120 * time.Second)
-
-					} else {
-						return kubeErr
-
-					}
-
-				}
-			} // end if not dryrun
-			if logSuccess {
-				break
-			}
-		} //end of for loop
-
-	} // end of buildah path
+	} else {
+		Info.log("Closing down development environment.")
+	}
 	return nil
 }
 
@@ -450,11 +313,95 @@ func processPorts(cmdArgs []string, config *devCommonConfig) ([]string, error) {
 		}
 	}
 
+	if config.Dryrun {
+		Debug.log("Dry Run - Skipping host port availability check")
+	} else {
+		var conflictErr error
+		exposedPortsMapping, conflictErr = resolveHostPortConflicts(exposedPortsMapping, len(config.ports), config.autoPorts)
+		if conflictErr != nil {
+			return cmdArgs, conflictErr
+		}
+	}
+	config.portMappings = exposedPortsMapping
+
 	for k := 0; k < len(exposedPortsMapping); k++ {
 		cmdArgs = append(cmdArgs, "-p", exposedPortsMapping[k])
 	}
 	return cmdArgs, nil
 }
+
+// hostPortAvailable reports whether the given port can be bound on the host
+func hostPortAvailable(port string) bool {
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		Debug.logf("Host port %s is not available: %v", port, err)
+		return false
+	}
+	listener.Close()
+	return true
+}
+
+// freeHostPort asks the OS for a host port that is currently free and not one of the used ports
+func freeHostPort(used map[string]string) (string, error) {
+	// the OS may hand out a port that an earlier mapping publishes, which is not bound yet
+	for attempt := 0; attempt < 10; attempt++ {
+		listener, err := net.Listen("tcp", ":0")
+		if err != nil {
+			return "", errors.Errorf("Could not find a free host port: %v", err)
+		}
+		port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+		listener.Close()
+		if _, found := used[port]; !found {
+			return port, nil
+		}
+	}
+	return "", errors.New("Could not find a free host port that is not already published")
+}
+
+// resolveHostPortConflicts probes the host side of each host:container mapping before docker run.
+// The first numExplicit mappings were given with --publish and are never remapped. The others
+// are the stack's exposed ports, which are moved to free host ports when autoPorts is set.
+// A host port that an earlier mapping publishes is in use as well.
+func resolveHostPortConflicts(portMappings []string, numExplicit int, autoPorts bool) ([]string, error) {
+	table := uitable.New()
+	table.AddRow("CONTAINER PORT", "HOST PORT")
+	resolvedMappings := make([]string, 0, len(portMappings))
+	// the mappings by the host port they publish
+	used := make(map[string]string)
+	for i, mapping := range portMappings {
+		ports := strings.Split(mapping, ":")
+		hostPort, containerPort := ports[0], ports[1]
+		previous, published := used[hostPort]
+		if published || !hostPortAvailable(hostPort) {
+			if i < numExplicit {
+				if published {
+					return nil, errors.Errorf("Host port %s, requested with --publish %s, is already published by --publish %s. Choose a different host port.", hostPort, mapping, previous)
+				}
+				return nil, errors.Errorf("Host port %s, requested with --publish %s, is already in use. Choose a different host port.", hostPort, mapping)
+			}
+			if !autoPorts {
+				if published {
+					return nil, errors.Errorf("Host port %s, needed to publish the stack's container port %s, is already published as %s. Map a different host port with --publish <host port>:%s, or use --auto-ports to pick free host ports.", hostPort, containerPort, previous, containerPort)
+				}
+				return nil, errors.Errorf("Host port %s, needed to publish the stack's container port %s, is already in use. Stop whatever is using it, map a different host port with --publish <host port>:%s, or use --auto-ports to pick free host ports.", hostPort, containerPort, containerPort)
+			}
+			freePort, err := freeHostPort(used)
+			if err != nil {
+				return nil, err
+			}
+			Warning.logf("Host port %s is already in use - publishing container port %s on host port %s instead", hostPort, containerPort, freePort)
+			hostPort = freePort
+		}
+		used[hostPort] = hostPort + ":" + containerPort
+		resolvedMappings = append(resolvedMappings, hostPort+":"+containerPort)
+		table.AddRow(containerPort, hostPort)
+	}
+	if autoPorts && len(resolvedMappings) > 0 {
+		Info.log("Publishing container ports on the following host ports:\n", table)
+	}
+	return resolvedMappings, nil
+}
+
 func checkPortInput(publishedPorts []string) (bool, error) {
 	validPorts := true
 	var portError error
@@ -467,7 +414,6 @@ func checkPortInput(publishedPorts []string) (bool, error) {
 		} else {
 			// check the numbers
 			portValues := strings.Split(publishedPorts[i], ":")
-			fmt.Println(portValues)
 			if !validPortNumber.MatchString(portValues[0]) || !validPortNumber.MatchString(portValues[1]) {
 				portError = errors.New("The numeric port input: " + publishedPorts[i] + " is not valid.")
 				validPorts = false
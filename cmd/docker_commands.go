@@ -2,27 +2,18 @@ package cmd
 
 import (
 	"bufio"
+	"bytes"
 	"io"
 	"os"
 	"os/exec"
 	"strings"
-)
-
-func DockerRunAndListen(args []string, logger appsodylogger, interactive bool, verbose bool, dryrun bool) (*exec.Cmd, error) {
-	var runArgs = []string{"run"}
-	runArgs = append(runArgs, args...)
-	return RunDockerCommandAndListen(runArgs, logger, interactive, verbose, dryrun)
-}
 
-func DockerBuild(args []string, logger appsodylogger, verbose bool, dryrun bool) error {
-	var buildArgs = []string{"build"}
-	buildArgs = append(buildArgs, args...)
-	return RunDockerCommandAndWait(buildArgs, logger, verbose, dryrun)
-}
+	"github.com/pkg/errors"
+)
 
-func RunDockerCommandAndWait(args []string, logger appsodylogger, verbose bool, dryrun bool) error {
+func RunCommandAndWait(command string, args []string, logger appsodylogger, verbose bool, dryrun bool) error {
 
-	cmd, err := RunDockerCommandAndListen(args, logger, false, verbose, dryrun)
+	cmd, err := RunCommandAndListen(command, args, logger, false, verbose, dryrun)
 	if err != nil {
 		return err
 	}
@@ -31,20 +22,49 @@ func RunDockerCommandAndWait(args []string, logger appsodylogger, verbose bool,
 
 		return nil
 	}
-	return cmd.Wait()
+	return waitCommand(cmd)
+
+}
 
+// waitCommand waits for a command started by RunCommandAndListen, and writes the end of its output
+func waitCommand(execCmd *exec.Cmd) error {
+	err := execCmd.Wait()
+	if events, ok := execCmd.Stdout.(*eventWriter); ok {
+		events.Flush()
+	}
+	return err
 }
 
 func RunKubeCommandAndListen(args []string, logger appsodylogger, interactive bool, verbose bool, dryrun bool) (*exec.Cmd, error) {
 	command := "kubectl"
 	return RunCommandAndListen(command, args, logger, interactive, verbose, dryrun)
 }
-func RunDockerCommandAndListen(args []string, logger appsodylogger, interactive bool, verbose bool, dryrun bool) (*exec.Cmd, error) {
-	command := "docker"
-	return RunCommandAndListen(command, args, logger, interactive, verbose, dryrun)
-}
 
 func RunCommandAndListen(commandValue string, args []string, logger appsodylogger, interactive bool, verbose bool, dryrun bool) (*exec.Cmd, error) {
+	return runCommandAndListen(commandValue, args, logger, interactive, verbose, dryrun, nil)
+}
+
+// runCommandAndWaitOutput runs the command like RunCommandAndWait, and returns the end of its output
+// with its error, so that the caller can tell the failures apart
+func runCommandAndWaitOutput(command string, args []string, logger appsodylogger, verbose bool, dryrun bool) error {
+	var output bytes.Buffer
+	execCmd, err := runCommandAndListen(command, args, logger, false, verbose, dryrun, &output)
+	if err != nil || dryrun {
+		return err
+	}
+	err = waitCommand(execCmd)
+	if err != nil {
+		tail := output.Bytes()
+		if len(tail) > 2048 {
+			tail = tail[len(tail)-2048:]
+		}
+		return errors.Errorf("%v %s", err, strings.TrimSpace(string(tail)))
+	}
+	return nil
+}
+
+// runCommandAndListen starts the command, and also copies its output to output if it is set
+func runCommandAndListen(commandValue string, args []string, logger appsodylogger, interactive bool, verbose bool, dryrun bool, output io.Writer) (*exec.Cmd, error) {
 	var execCmd *exec.Cmd
 	var command = commandValue
 	var err error
@@ -54,11 +74,33 @@ func RunCommandAndListen(commandValue string, args []string, logger appsodylogge
 		Info.log("Running docker command: ", command, " ", strings.Join(args, " "))
 		execCmd = exec.Command(command, args...)
 
+		if jsonlOutput {
+			// the output is only written as events
+			events := &eventWriter{logger: logger, copy: output}
+			execCmd.Stdout = events
+			execCmd.Stderr = events
+			if interactive {
+				execCmd.Stdin = os.Stdin
+			}
+			err = execCmd.Start()
+			if err != nil {
+				Debug.log("Error running ", command, " command: ", err)
+				return nil, err
+			}
+			return execCmd, nil
+		}
+
 		// Create io pipes for the command
 		logReader, logWriter := io.Pipe()
 		consoleReader, consoleWriter := io.Pipe()
-		execCmd.Stdout = io.MultiWriter(logWriter, consoleWriter)
-		execCmd.Stderr = io.MultiWriter(logWriter, consoleWriter)
+		writers := []io.Writer{logWriter, consoleWriter}
+		if output != nil {
+			writers = append(writers, output)
+		}
+		// exec writes to the same writer of stdout and stderr from one goroutine at a time
+		outputs := io.MultiWriter(writers...)
+		execCmd.Stdout = outputs
+		execCmd.Stderr = outputs
 		if interactive {
 			execCmd.Stdin = os.Stdin
 		}
@@ -0,0 +1,283 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// dockerOption describes a single docker command line flag that may appear in --docker-options.
+// Flags that are not allowed carry the reason, so the error tells the user why.
+type dockerOption struct {
+	names      []string
+	takesValue bool
+	allowed    bool
+	reason     string
+}
+
+// Reasons shared by several flags
+const (
+	reasonManagedByAppsody = "this is set by appsody"
+	reasonUseAppsodyFlag   = "use the equivalent appsody flag instead"
+	reasonMountsManaged    = "volume mounts are controlled by the stack's APPSODY_MOUNTS"
+	reasonContainerManaged = "the dev container lifecycle is managed by appsody"
+)
+
+var dockerRunFlags = []dockerOption{
+	// options that are safe to pass through to docker run
+	{names: []string{"-e", "--env"}, takesValue: true, allowed: true},
+	{names: []string{"--env-file"}, takesValue: true, allowed: true},
+	{names: []string{"-m", "--memory"}, takesValue: true, allowed: true},
+	{names: []string{"--memory-swap"}, takesValue: true, allowed: true},
+	{names: []string{"--memory-reservation"}, takesValue: true, allowed: true},
+	{names: []string{"--cpus"}, takesValue: true, allowed: true},
+	{names: []string{"-c", "--cpu-shares"}, takesValue: true, allowed: true},
+	{names: []string{"--cpuset-cpus"}, takesValue: true, allowed: true},
+	{names: []string{"--shm-size"}, takesValue: true, allowed: true},
+	{names: []string{"--ulimit"}, takesValue: true, allowed: true},
+	{names: []string{"--add-host"}, takesValue: true, allowed: true},
+	{names: []string{"--dns"}, takesValue: true, allowed: true},
+	{names: []string{"--dns-search"}, takesValue: true, allowed: true},
+	{names: []string{"--dns-option"}, takesValue: true, allowed: true},
+	{names: []string{"-h", "--hostname"}, takesValue: true, allowed: true},
+	{names: []string{"-l", "--label"}, takesValue: true, allowed: true},
+	{names: []string{"--label-file"}, takesValue: true, allowed: true},
+	{names: []string{"--cap-add"}, takesValue: true, allowed: true},
+	{names: []string{"--cap-drop"}, takesValue: true, allowed: true},
+	{names: []string{"--security-opt"}, takesValue: true, allowed: true},
+	{names: []string{"--device"}, takesValue: true, allowed: true},
+	{names: []string{"--privileged"}, allowed: true},
+	{names: []string{"--init"}, allowed: true},
+	{names: []string{"--log-driver"}, takesValue: true, allowed: true},
+	{names: []string{"--log-opt"}, takesValue: true, allowed: true},
+	{names: []string{"--sysctl"}, takesValue: true, allowed: true},
+	{names: []string{"--tmpfs"}, takesValue: true, allowed: true},
+	{names: []string{"--network-alias"}, takesValue: true, allowed: true},
+	{names: []string{"--link"}, takesValue: true, allowed: true},
+	{names: []string{"--gpus"}, takesValue: true, allowed: true},
+	// options that would conflict with what appsody sets up for the dev container
+	{names: []string{"--help"}, reason: "it is not a docker run option"},
+	{names: []string{"-p", "--publish"}, takesValue: true, reason: reasonUseAppsodyFlag + " (--publish)"},
+	{names: []string{"-P", "--publish-all"}, reason: reasonUseAppsodyFlag + " (--publish-all)"},
+	{names: []string{"--name"}, takesValue: true, reason: reasonUseAppsodyFlag + " (--name)"},
+	{names: []string{"--network", "--net"}, takesValue: true, reason: reasonUseAppsodyFlag + " (--network)"},
+	{names: []string{"-i", "--interactive"}, reason: reasonUseAppsodyFlag + " (--interactive)"},
+	{names: []string{"-u", "--user"}, takesValue: true, reason: reasonManagedByAppsody + " (see APPSODY_USER_RUN_AS_LOCAL)"},
+	{names: []string{"-t", "--tty"}, reason: reasonManagedByAppsody},
+	{names: []string{"--entrypoint"}, takesValue: true, reason: "the appsody controller must be the entrypoint"},
+	{names: []string{"-v", "--volume"}, takesValue: true, reason: reasonMountsManaged},
+	{names: []string{"--mount"}, takesValue: true, reason: reasonMountsManaged},
+	{names: []string{"--volumes-from"}, takesValue: true, reason: reasonMountsManaged},
+	{names: []string{"-w", "--workdir"}, takesValue: true, reason: "the working directory is defined by the stack"},
+	{names: []string{"--rm"}, reason: reasonContainerManaged},
+	{names: []string{"-d", "--detach"}, reason: reasonContainerManaged},
+	{names: []string{"--restart"}, takesValue: true, reason: reasonContainerManaged},
+}
+
+var dockerBuildFlags = []dockerOption{
+	// options that are safe to pass through to docker build
+	{names: []string{"--build-arg"}, takesValue: true, allowed: true},
+	{names: []string{"--no-cache"}, allowed: true},
+	{names: []string{"--pull"}, allowed: true},
+	{names: []string{"-q", "--quiet"}, allowed: true},
+	{names: []string{"--rm"}, allowed: true},
+	{names: []string{"--force-rm"}, allowed: true},
+	{names: []string{"--target"}, takesValue: true, allowed: true},
+	{names: []string{"-l", "--label"}, takesValue: true, allowed: true},
+	{names: []string{"--network"}, takesValue: true, allowed: true},
+	{names: []string{"--add-host"}, takesValue: true, allowed: true},
+	{names: []string{"-m", "--memory"}, takesValue: true, allowed: true},
+	{names: []string{"--memory-swap"}, takesValue: true, allowed: true},
+	{names: []string{"--cpu-shares", "-c"}, takesValue: true, allowed: true},
+	{names: []string{"--cpuset-cpus"}, takesValue: true, allowed: true},
+	{names: []string{"--shm-size"}, takesValue: true, allowed: true},
+	{names: []string{"--ulimit"}, takesValue: true, allowed: true},
+	{names: []string{"--cache-from"}, takesValue: true, allowed: true},
+	{names: []string{"--squash"}, allowed: true},
+	{names: []string{"--security-opt"}, takesValue: true, allowed: true},
+	{names: []string{"--iidfile"}, takesValue: true, allowed: true},
+	// options that would conflict with what appsody sets up for the build
+	{names: []string{"-t", "--tag"}, takesValue: true, reason: reasonUseAppsodyFlag + " (--tag)"},
+	{names: []string{"-f", "--file"}, takesValue: true, reason: "the Dockerfile is provided by the stack"},
+}
+
+func findDockerOption(name string, options []dockerOption) *dockerOption {
+	for i := range options {
+		for _, optionName := range options[i].names {
+			if optionName == name {
+				return &options[i]
+			}
+		}
+	}
+	return nil
+}
+
+// splitShellWords splits a string into words following POSIX shell quoting rules:
+// words are separated by unquoted blanks, single quotes preserve everything literally,
+// double quotes preserve everything except backslash escapes of $ ` " \ and newline,
+// and an unquoted backslash escapes the next character.
+func splitShellWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case r == '\\':
+			inWord = true
+			i++
+			if i >= len(runes) {
+				return nil, errors.New("unexpected end of input after \\")
+			}
+			if runes[i] != '\n' {
+				word.WriteRune(runes[i])
+			}
+		case r == '\'':
+			inWord = true
+			closed := false
+			for i++; i < len(runes); i++ {
+				if runes[i] == '\'' {
+					closed = true
+					break
+				}
+				word.WriteRune(runes[i])
+			}
+			if !closed {
+				return nil, errors.New("unterminated single quote")
+			}
+		case r == '"':
+			inWord = true
+			closed := false
+			for i++; i < len(runes); i++ {
+				if runes[i] == '"' {
+					closed = true
+					break
+				}
+				if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("$`\"\\\n", runes[i+1]) {
+					i++
+					if runes[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteRune(runes[i])
+			}
+			if !closed {
+				return nil, errors.New("unterminated double quote")
+			}
+		default:
+			inWord = true
+			word.WriteRune(r)
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// parseDockerOptions splits the value of --docker-options into words and checks every flag
+// against the given allowlist. The returned words can be appended to the docker command as is.
+func parseDockerOptions(value string, options []dockerOption) ([]string, error) {
+	words, err := splitShellWords(value)
+	if err != nil {
+		return nil, errors.Errorf("Could not parse --docker-options \"%s\": %v", value, err)
+	}
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		if !strings.HasPrefix(word, "-") || word == "-" {
+			return nil, errors.Errorf("%s is not allowed in --docker-options: only docker flags and their values can be specified", word)
+		}
+		if word == "--" {
+			return nil, errors.Errorf("%s is not allowed in --docker-options", word)
+		}
+		name := word
+		hasValue := false
+		if strings.HasPrefix(word, "--") {
+			if index := strings.Index(word, "="); index >= 0 {
+				name = word[:index]
+				hasValue = true
+			}
+		} else if len(word) > 2 {
+			valueIsNext, err := checkShortDockerFlags(word, options)
+			if err != nil {
+				return nil, err
+			}
+			if valueIsNext {
+				i++
+				if i >= len(words) {
+					return nil, errors.Errorf("%s in --docker-options requires a value", word)
+				}
+			}
+			continue
+		}
+		if err := checkDockerOption(word, name, hasValue, options); err != nil {
+			return nil, err
+		}
+		option := findDockerOption(name, options)
+		if option.takesValue && !hasValue {
+			// the value is the next word
+			i++
+			if i >= len(words) {
+				return nil, errors.Errorf("%s in --docker-options requires a value", word)
+			}
+		}
+	}
+	return words, nil
+}
+
+// checkShortDockerFlags checks a word of combined short flags (-it). As with docker, the first flag that takes
+// a value takes the rest of the word (-m4g, -e=FOO=bar), or the next word when it is the last flag of the word (-ie FOO=bar).
+// It reports whether the value is the next word.
+func checkShortDockerFlags(word string, options []dockerOption) (bool, error) {
+	flags := []rune(word[1:])
+	for i, flag := range flags {
+		name := "-" + string(flag)
+		if err := checkDockerOption(word, name, false, options); err != nil {
+			return false, err
+		}
+		if findDockerOption(name, options).takesValue {
+			return i == len(flags)-1, nil
+		}
+	}
+	return false, nil
+}
+
+func checkDockerOption(word string, name string, hasValue bool, options []dockerOption) error {
+	option := findDockerOption(name, options)
+	if option == nil {
+		return errors.Errorf("%s is not allowed in --docker-options: %s is not a recognized option", word, name)
+	}
+	if !option.allowed {
+		return errors.Errorf("%s is not allowed in --docker-options: %s", word, option.reason)
+	}
+	if hasValue && !option.takesValue {
+		// boolean flags accept an explicit --flag=true or --flag=false
+		value := strings.TrimPrefix(word, name+"=")
+		if _, err := strconv.ParseBool(value); err != nil || value == word {
+			return errors.Errorf("%s is not allowed in --docker-options: %s does not take a value", word, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd"
+)
+
+func TestSplitShellWords(t *testing.T) {
+	var tests = []struct {
+		line     string
+		expected []string
+		err      string
+	}{
+		{line: "", expected: nil},
+		{line: "  -e   FOO=bar\t--rm\n", expected: []string{"-e", "FOO=bar", "--rm"}},
+		{line: `-e 'FOO=a b' -e "BAR=c d"`, expected: []string{"-e", "FOO=a b", "-e", "BAR=c d"}},
+		{line: `-e 'FOO="$HOME" \n'`, expected: []string{"-e", `FOO="$HOME" \n`}},
+		{line: `-e "FOO=\"quoted\" \$HOME \\ \a"`, expected: []string{"-e", `FOO="quoted" $HOME \ \a`}},
+		{line: `-e FOO=a\ b\'c`, expected: []string{"-e", "FOO=a b'c"}},
+		{line: "-e FOO=a\\\nb", expected: []string{"-e", "FOO=ab"}},
+		{line: `-e FOO=''`, expected: []string{"-e", "FOO="}},
+		{line: `-e ""`, expected: []string{"-e", ""}},
+		{line: `-e 'FOO`, err: "unterminated single quote"},
+		{line: `-e "FOO`, err: "unterminated double quote"},
+		{line: `-e FOO\`, err: "unexpected end of input after \\"},
+	}
+	for _, test := range tests {
+		words, err := cmd.SplitShellWords(test.line)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Expected the error %s splitting %q, got %v", test.err, test.line, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error splitting %q: %v", test.line, err)
+		} else if !reflect.DeepEqual(words, test.expected) {
+			t.Errorf("Expected %q to be split into %q, got %q", test.line, test.expected, words)
+		}
+	}
+}
+
+func TestParseDockerOptions(t *testing.T) {
+	var tests = []struct {
+		options  string
+		build    bool
+		expected []string
+		err      string
+	}{
+		{options: "-e FOO=bar --env=BAZ=1 -m4g --cpus 2", expected: []string{"-e", "FOO=bar", "--env=BAZ=1", "-m4g", "--cpus", "2"}},
+		{options: "-e=FOO=bar --privileged --init=false", expected: []string{"-e=FOO=bar", "--privileged", "--init=false"}},
+		{options: `-e "FOO=a b"`, expected: []string{"-e", "FOO=a b"}},
+		// the last flag of combined short flags takes the next word as its value
+		{options: "-ql key=value --no-cache", build: true, expected: []string{"-ql", "key=value", "--no-cache"}},
+		// the first flag that takes a value takes the rest of the word
+		{options: "-qm4g", build: true, expected: []string{"-qm4g"}},
+		{options: "-qlkey=value", build: true, expected: []string{"-qlkey=value"}},
+		{options: "-ql", build: true, err: "-ql in --docker-options requires a value"},
+		{options: "-qt app", build: true, err: "-qt is not allowed in --docker-options: use the equivalent appsody flag instead (--tag)"},
+		{options: "-qz", build: true, err: "-qz is not allowed in --docker-options: -z is not a recognized option"},
+		{options: "-e", err: "-e in --docker-options requires a value"},
+		{options: "-e FOO=bar stray", err: "stray is not allowed in --docker-options: only docker flags and their values can be specified"},
+		{options: "-it", err: "-it is not allowed in --docker-options: use the equivalent appsody flag instead (--interactive)"},
+		{options: "-p 3000:3000", err: "-p is not allowed in --docker-options: use the equivalent appsody flag instead (--publish)"},
+		{options: "--volume=/tmp:/tmp", err: "--volume=/tmp:/tmp is not allowed in --docker-options: volume mounts are controlled by the stack's APPSODY_MOUNTS"},
+		{options: "--privileged=yes", err: "--privileged=yes is not allowed in --docker-options: --privileged does not take a value"},
+		{options: "--unknown", err: "--unknown is not allowed in --docker-options: --unknown is not a recognized option"},
+		{options: "-- -e FOO", err: "-- is not allowed in --docker-options"},
+		{options: "-f Dockerfile.dev", build: true, err: "-f is not allowed in --docker-options: the Dockerfile is provided by the stack"},
+		{options: "-e 'FOO", err: "Could not parse --docker-options \"-e 'FOO\": unterminated single quote"},
+	}
+	for _, test := range tests {
+		flags := cmd.DockerRunFlags
+		if test.build {
+			flags = cmd.DockerBuildFlags
+		}
+		words, err := cmd.ParseDockerOptions(test.options, flags)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Expected the error %s parsing %q, got %v", test.err, test.options, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error parsing %q: %v", test.options, err)
+		} else if !reflect.DeepEqual(words, test.expected) {
+			t.Errorf("Expected %q to be parsed as %q, got %q", test.options, test.expected, words)
+		}
+	}
+}
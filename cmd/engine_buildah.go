@@ -0,0 +1,228 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// buildahEngine is used by the experimental Kubernetes path and by extract --buildah.
+// Buildah builds and extracts images but does not run containers.
+type buildahEngine struct{}
+
+func (e *buildahEngine) Name() string {
+	return "buildah"
+}
+
+func (e *buildahEngine) Command() string {
+	return "buildah"
+}
+
+func (e *buildahEngine) unsupported(operation string) error {
+	return errors.Errorf("%s is not supported when using buildah", operation)
+}
+
+func (e *buildahEngine) CheckAvailable() error {
+	checkCmd := exec.Command("buildah", "version")
+	_, cmdErr := checkCmd.Output()
+	if cmdErr != nil {
+		return errors.New("buildah does not seem to be installed - failed to execute buildah version")
+	}
+	return nil
+}
+
+func (e *buildahEngine) RunAndListen(args []string, logger appsodylogger, interactive bool, verbose bool, dryrun bool) (*exec.Cmd, error) {
+	return nil, e.unsupported("Running a container")
+}
+
+func (e *buildahEngine) RunOutput(args []string) (string, error) {
+	return "", e.unsupported("Running a container")
+}
+
+func (e *buildahEngine) Build(args []string, logger appsodylogger, verbose bool, dryrun bool) error {
+	var buildArgs = []string{"bud"}
+	buildArgs = append(buildArgs, args...)
+	return RunCommandAndWait("buildah", buildArgs, logger, verbose, dryrun)
+}
+
+func (e *buildahEngine) BuildPlatforms(args []string, images []string, platforms []string, push bool, logger appsodylogger, verbose bool, dryrun bool) (string, error) {
+	return buildManifestList("buildah", "bud", args, images, platforms, push, logger, verbose, dryrun)
+}
+
+// InspectImage parses the OCI image configuration. Buildah prints it as a single map
+// rather than the array of maps docker produces.
+func (e *buildahEngine) InspectImage(image string) (*ImageInspect, error) {
+	cmdArgs := []string{"inspect", "--format", "{{.Config}}", image}
+	Debug.Logf("About to run buildah with args %s ", cmdArgs)
+	inspectCmd := exec.Command("buildah", cmdArgs...)
+	inspectOut, inspectErr := inspectCmd.Output()
+	if inspectErr != nil {
+		return nil, errors.Errorf("Could not inspect the image: %v", inspectErr)
+	}
+	var ociImage struct {
+		Config ImageConfig `json:"config"`
+	}
+	err := json.Unmarshal(inspectOut, &ociImage)
+	if err != nil {
+		return nil, errors.Errorf("Error unmarshaling data from inspect command - exiting %v", err)
+	}
+	return &ImageInspect{Config: ociImage.Config}, nil
+}
+
+func (e *buildahEngine) ImageID(image string) (string, error) {
+	imagesCmd := exec.Command("buildah", "images", "-q", "--no-trunc", image)
+	imagesOut, imagesErr := imagesCmd.Output()
+	if imagesErr != nil {
+		return "", errors.Errorf("Could not get the ID of the image %s: %v", image, imagesErr)
+	}
+	ids := strings.Fields(string(imagesOut))
+	if len(ids) == 0 {
+		return "", errors.Errorf("Could not get the ID of the image %s: the image was not found", image)
+	}
+	return ids[0], nil
+}
+
+func (e *buildahEngine) ListImages(repository string) ([]ImageInfo, error) {
+	return nil, e.unsupported("Listing images")
+}
+
+func (e *buildahEngine) RemoveImage(image string, dryrun bool) error {
+	return execAndWaitReturnErr("buildah", []string{"rmi", image}, Debug, dryrun)
+}
+
+func (e *buildahEngine) ImageExists(image string) bool {
+	imagesCmd := exec.Command("buildah", "images", "-q", image)
+	imagesOut, imagesErr := imagesCmd.Output()
+	if imagesErr != nil {
+		Debug.log("buildah images -q failed for the image: ", image, " error: ", imagesErr)
+		return false
+	}
+	return strings.TrimSpace(string(imagesOut)) != ""
+}
+
+func (e *buildahEngine) Create(args []string, dryrun bool) error {
+	var fromArgs = []string{"from"}
+	fromArgs = append(fromArgs, args...)
+	return execAndWaitReturnErr("buildah", fromArgs, Debug, dryrun)
+}
+
+// Cp mounts the working container and copies the contents of the source directory
+func (e *buildahEngine) Cp(source string, dest string, dryrun bool) error {
+	sourceParts := strings.SplitN(source, ":", 2)
+	if len(sourceParts) != 2 {
+		return errors.Errorf("Invalid copy source %s, expected <container>:<path>", source)
+	}
+	script := fmt.Sprintf("x=`buildah mount %s`; cp -rf $x/%s/* %s", sourceParts[0], sourceParts[1], dest)
+	return execAndWaitReturnErr("/bin/sh", []string{"-c", script}, Debug, dryrun)
+}
+
+func (e *buildahEngine) Remove(container string, dryrun bool) error {
+	return execAndWait("buildah", []string{"rm", container}, Debug, dryrun)
+}
+
+func (e *buildahEngine) ListContainers(all bool) ([]ContainerInfo, error) {
+	return nil, e.unsupported("Listing running containers")
+}
+
+func (e *buildahEngine) Stop(container string, dryrun bool) error {
+	return e.unsupported("Stopping a container")
+}
+
+func (e *buildahEngine) Pull(image string, dryrun bool) error {
+	pullArgs := []string{"pull", image}
+	if dryrun {
+		Info.log("Dry run - skipping execution of: buildah ", strings.Join(pullArgs, " "))
+		return nil
+	}
+	Info.log("Pulling image ", image)
+	err := execAndWaitReturnErr("buildah", pullArgs, Info, dryrun)
+	if err != nil {
+		Warning.log("Image pull failed: ", err)
+		return err
+	}
+	return nil
+}
+
+func (e *buildahEngine) Tag(image string, tag string, dryrun bool) error {
+	return execAndWait("buildah", []string{"tag", image, tag}, Debug, dryrun)
+}
+
+func (e *buildahEngine) Push(image string, dryrun bool) (string, error) {
+	Info.log("Pushing image ", image)
+	return pushWithDigestFile("buildah", []string{"push", image}, dryrun)
+}
+
+func (e *buildahEngine) Login(registry string, dryrun bool) error {
+	return loginCommand("buildah", registry, dryrun)
+}
+
+// Export pushes the image to a docker-archive or oci transport, which only hold the first image
+func (e *buildahEngine) Export(images []string, outputType string, dest string, dryrun bool) error {
+	Info.log("Exporting ", images[0], " to ", dest)
+	if len(images) > 1 {
+		Warning.log("buildah only exports one image, the other images are not in ", dest)
+	}
+	transport := "oci:" + dest
+	if outputType == outputDockerArchive {
+		transport = "docker-archive:" + dest + ":" + images[0]
+	}
+	return execAndWaitReturnErr("buildah", []string{"push", images[0], transport}, Debug, dryrun)
+}
+
+// Load pulls the image from the docker-archive or oci transport and returns its ID
+func (e *buildahEngine) Load(source string, dryrun bool) ([]string, error) {
+	transport := "docker-archive:" + source
+	if info, err := os.Stat(source); err == nil && info.IsDir() {
+		transport = "oci:" + source
+	}
+	pullArgs := []string{"pull", "--quiet", transport}
+	if dryrun {
+		Info.log("Dry run - skipping execution of: buildah ", strings.Join(pullArgs, " "))
+		return nil, nil
+	}
+	Debug.log("Running command: buildah ", strings.Join(pullArgs, " "))
+	pullOut, err := exec.Command("buildah", pullArgs...).Output()
+	if err != nil {
+		return nil, errors.Errorf("Could not load the image of %s: %v", source, err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(pullOut)), "\n")
+	return []string{strings.TrimSpace(lines[len(lines)-1])}, nil
+}
+
+func (e *buildahEngine) ListVolumes() ([]VolumeInfo, error) {
+	return nil, e.unsupported("Managing volumes")
+}
+
+func (e *buildahEngine) InspectVolume(name string) (*VolumeInfo, error) {
+	return nil, e.unsupported("Managing volumes")
+}
+
+func (e *buildahEngine) VolumeSizes() (map[string]string, error) {
+	return nil, e.unsupported("Managing volumes")
+}
+
+func (e *buildahEngine) CreateVolume(name string, labels map[string]string, dryrun bool) error {
+	return e.unsupported("Managing volumes")
+}
+
+func (e *buildahEngine) RemoveVolume(name string, dryrun bool) error {
+	return e.unsupported("Managing volumes")
+}
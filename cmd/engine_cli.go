@@ -0,0 +1,557 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// cliEngine drives a docker compatible command line: docker itself, or podman,
+// which accepts the same commands and flags for everything the CLI does.
+type cliEngine struct {
+	name    string
+	command string
+}
+
+func (e *cliEngine) Name() string {
+	return e.name
+}
+
+func (e *cliEngine) Command() string {
+	return e.command
+}
+
+func (e *cliEngine) CheckAvailable() error {
+	checkCmd := exec.Command(e.command, "ps")
+	_, cmdErr := checkCmd.Output()
+	if cmdErr != nil {
+		return errors.Errorf("%s does not seem to be installed or running - failed to execute %s ps", e.command, e.command)
+	}
+	return nil
+}
+
+func (e *cliEngine) RunAndListen(args []string, logger appsodylogger, interactive bool, verbose bool, dryrun bool) (*exec.Cmd, error) {
+	var runArgs = []string{"run"}
+	runArgs = append(runArgs, args...)
+	return RunCommandAndListen(e.command, runArgs, logger, interactive, verbose, dryrun)
+}
+
+func (e *cliEngine) RunOutput(args []string) (string, error) {
+	var runArgs = []string{"run"}
+	runArgs = append(runArgs, args...)
+	Info.log("Running command: ", e.command, " ", strings.Join(runArgs, " "))
+	runCmd := exec.Command(e.command, runArgs...)
+	runOut, err := runCmd.Output()
+	if err != nil {
+		Error.log("Could not run the ", e.command, " image: ", err)
+		return "", err
+	}
+	return strings.TrimSpace(string(runOut)), nil
+}
+
+func (e *cliEngine) Build(args []string, logger appsodylogger, verbose bool, dryrun bool) error {
+	var buildArgs = []string{"build"}
+	buildArgs = append(buildArgs, args...)
+	return RunCommandAndWait(e.command, buildArgs, logger, verbose, dryrun)
+}
+
+// BuildPlatforms uses buildx with docker, which can only push a manifest list, and a local manifest list with podman.
+// The build that pushes is run again when the push fails with a transient error, from the build cache.
+func (e *cliEngine) BuildPlatforms(args []string, images []string, platforms []string, push bool, logger appsodylogger, verbose bool, dryrun bool) (string, error) {
+	if e.name == enginePodman {
+		return buildManifestList(e.command, "build", args, images, platforms, push, logger, verbose, dryrun)
+	}
+	buildArgs := []string{"buildx", "build", "--platform", strings.Join(platforms, ",")}
+	for _, image := range images {
+		buildArgs = append(buildArgs, "-t", image)
+	}
+	var metadataFile string
+	if push {
+		for _, image := range images {
+			err := loginCommand(e.command, registryOf(image), dryrun)
+			if err != nil {
+				return "", err
+			}
+		}
+		metadataDir, err := ioutil.TempDir("", "appsody-buildx")
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(metadataDir)
+		metadataFile = filepath.Join(metadataDir, "metadata.json")
+		buildArgs = append(buildArgs, "--push", "--metadata-file", metadataFile)
+	} else if len(platforms) == 1 {
+		buildArgs = append(buildArgs, "--load")
+	} else {
+		Warning.log("docker cannot store a multi-platform image locally, the images are only kept in the build cache. Use --push to push them to a registry.")
+	}
+	buildArgs = append(buildArgs, args...)
+	if !push {
+		return "", RunCommandAndWait(e.command, buildArgs, logger, verbose, dryrun)
+	}
+	_, err := pushWithRetries(strings.Join(images, ", "), func() (string, error) {
+		return "", runCommandAndWaitOutput(e.command, buildArgs, logger, verbose, dryrun)
+	})
+	if err != nil || dryrun {
+		return "", err
+	}
+	var metadata struct {
+		Digest string `json:"containerimage.digest"`
+	}
+	metadataBytes, err := ioutil.ReadFile(metadataFile)
+	if err == nil {
+		err = json.Unmarshal(metadataBytes, &metadata)
+	}
+	if err != nil {
+		Warning.log("Could not read the digest of the manifest list: ", err)
+	}
+	return metadata.Digest, nil
+}
+
+// buildManifestList builds a manifest list named after the first image with podman or buildah, then
+// pushes it to all the images or tags it with the other images
+func buildManifestList(command string, buildCommand string, args []string, images []string, platforms []string, push bool, logger appsodylogger, verbose bool, dryrun bool) (string, error) {
+	manifestList := images[0]
+	// building into an existing list adds to the images of the previous build
+	if !dryrun {
+		rmCmd := exec.Command(command, "manifest", "rm", manifestList)
+		if rmOut, rmErr := rmCmd.CombinedOutput(); rmErr == nil {
+			Debug.log("Removed the previous manifest list ", manifestList, ": ", strings.TrimSpace(string(rmOut)))
+		}
+	}
+	buildArgs := []string{buildCommand, "--platform", strings.Join(platforms, ","), "--manifest", manifestList}
+	buildArgs = append(buildArgs, args...)
+	err := RunCommandAndWait(command, buildArgs, logger, verbose, dryrun)
+	if err != nil {
+		return "", err
+	}
+	var digest string
+	for _, image := range images {
+		if push {
+			Info.log("Pushing manifest list ", image)
+			err = loginCommand(command, registryOf(image), dryrun)
+			if err != nil {
+				return "", err
+			}
+			digest, err = pushWithRetries(image, func() (string, error) {
+				return pushWithDigestFile(command, []string{"manifest", "push", "--all", manifestList, "docker://" + image}, dryrun)
+			})
+		} else if image != manifestList {
+			err = execAndWait(command, []string{"tag", manifestList, image}, Debug, dryrun)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return digest, nil
+}
+
+// pushWithDigestFile runs a podman or buildah push command, which writes the digest of the pushed image to a file
+func pushWithDigestFile(command string, pushArgs []string, dryrun bool) (string, error) {
+	digestDir, err := ioutil.TempDir("", "appsody-push")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(digestDir)
+	digestFile := filepath.Join(digestDir, "digest")
+	// the options go before the source and destination
+	pushArgs = append(pushArgs[:len(pushArgs)-1:len(pushArgs)-1], "--digestfile", digestFile, pushArgs[len(pushArgs)-1])
+	if dryrun {
+		Info.log("Dry run - skipping execution of: ", command, " ", strings.Join(pushArgs, " "))
+		return "", nil
+	}
+	Debug.log("Running command: ", command, " ", strings.Join(pushArgs, " "))
+	pushOut, err := exec.Command(command, pushArgs...).CombinedOutput()
+	if err != nil {
+		return "", errors.Errorf("%v %s", err, strings.TrimSpace(string(pushOut)))
+	}
+	digest, err := ioutil.ReadFile(digestFile)
+	if err != nil {
+		Warning.log("Could not read the digest of the pushed image: ", err)
+	}
+	return strings.TrimSpace(string(digest)), nil
+}
+
+func (e *cliEngine) InspectImage(image string) (*ImageInspect, error) {
+	cmdArgs := []string{"image", "inspect", image}
+	Debug.Logf("About to run %s with args %s ", e.command, cmdArgs)
+	inspectCmd := exec.Command(e.command, cmdArgs...)
+	inspectOut, inspectErr := inspectCmd.Output()
+	if inspectErr != nil {
+		return nil, errors.Errorf("Could not inspect the image: %v", inspectErr)
+	}
+	var images []ImageInspect
+	err := json.Unmarshal(inspectOut, &images)
+	if err != nil {
+		return nil, errors.Errorf("Error unmarshaling data from inspect command - exiting %v", err)
+	}
+	if len(images) == 0 {
+		return nil, errors.Errorf("Could not inspect the image: %s returned no data for %s", e.command, image)
+	}
+	return &images[0], nil
+}
+
+func (e *cliEngine) ImageID(image string) (string, error) {
+	cmdArgs := []string{"image", "inspect", "--format", "{{.Id}}", image}
+	idCmd := exec.Command(e.command, cmdArgs...)
+	idOut, idErr := idCmd.Output()
+	if idErr != nil {
+		return "", errors.Errorf("Could not get the ID of the image %s: %v", image, idErr)
+	}
+	return strings.TrimSpace(string(idOut)), nil
+}
+
+func (e *cliEngine) ListImages(repository string) ([]ImageInfo, error) {
+	var images = []ImageInfo{}
+	strSep := "$!$!$!"
+	lsCmd := exec.Command(e.command, "image", "ls", "--no-trunc", "--format", "{{.ID}}"+strSep+"{{.Repository}}"+strSep+"{{.Tag}}", repository)
+	lsOut, err := lsCmd.Output()
+	if err != nil {
+		return nil, errors.Errorf("Could not list the images %s: %v", repository, err)
+	}
+	var ids []string
+	for _, line := range strings.Split(string(lsOut), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), strSep)
+		if len(fields) < 3 {
+			continue
+		}
+		images = append(images, ImageInfo{ID: fields[0], Repository: fields[1], Tag: fields[2]})
+		ids = append(ids, fields[0])
+	}
+	if len(ids) == 0 {
+		return images, nil
+	}
+	// the size ls reports is rounded for display, inspect gives it in bytes
+	inspectCmd := exec.Command(e.command, append([]string{"image", "inspect", "--format", "{{.Id}} {{.Size}}"}, ids...)...)
+	inspectOut, err := inspectCmd.Output()
+	if err != nil {
+		Debug.log("Could not get the size of the images: ", err)
+		return images, nil
+	}
+	sizes := map[string]int64{}
+	for _, line := range strings.Split(string(inspectOut), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 {
+			size, _ := strconv.ParseInt(fields[1], 10, 64)
+			sizes[fields[0]] = size
+		}
+	}
+	for i := range images {
+		images[i].Size = sizes[images[i].ID]
+	}
+	return images, nil
+}
+
+func (e *cliEngine) RemoveImage(image string, dryrun bool) error {
+	return execAndWaitReturnErr(e.command, []string{"rmi", image}, Debug, dryrun)
+}
+
+func (e *cliEngine) ImageExists(image string) bool {
+	cmdArgs := []string{"image", "ls", "-q", image}
+	imagelsCmd := exec.Command(e.command, cmdArgs...)
+	imagelsOut, imagelsErr := imagelsCmd.Output()
+	imagelsOutStr := strings.TrimSpace(string(imagelsOut))
+	Debug.log(e.command, " image ls command output: ", imagelsOutStr)
+
+	if imagelsErr != nil {
+		Warning.log("Could not run ", e.command, " image ls -q for the image: ", image, " error: ", imagelsErr, " Check to make sure ", e.command, " is available.")
+		return false
+	}
+	return imagelsOutStr != ""
+}
+
+func (e *cliEngine) Create(args []string, dryrun bool) error {
+	var createArgs = []string{"create"}
+	createArgs = append(createArgs, args...)
+	return execAndWaitReturnErr(e.command, createArgs, Debug, dryrun)
+}
+
+func (e *cliEngine) Cp(source string, dest string, dryrun bool) error {
+	return execAndWaitReturnErr(e.command, []string{"cp", source, dest}, Debug, dryrun)
+}
+
+func (e *cliEngine) Remove(container string, dryrun bool) error {
+	//Added "-f" to force removal if container is still running or image has containers
+	return execAndWait(e.command, []string{"rm", container, "-f"}, Debug, dryrun)
+}
+
+func (e *cliEngine) ListContainers(all bool) ([]ContainerInfo, error) {
+	var containers = []ContainerInfo{}
+
+	// We are going to do a 'ps' and parse the output into fields. At least one of these
+	// fields can have white space in it (Status), so we need a way of splitting up the output.
+	// To do this we use the --format option and include a string of illegal characters as a
+	// seperator, which we then subsequently use to parse.
+	strSep := "$!$!$!"
+	cmdArgs := []string{
+		"ps",
+		"--no-trunc",
+		"--format",
+		"{{.ID}}" + strSep + "{{.Image}}" + strSep + "{{.Status}}" +
+			strSep + "{{.Names}}" + strSep + "{{.Command}}"}
+	if all {
+		cmdArgs = append(cmdArgs, "--all")
+	}
+
+	psCmd := exec.Command(e.command, cmdArgs...)
+	psOut, err := psCmd.Output()
+	if err != nil {
+		Error.log("Error running command", err)
+		return nil, err
+	}
+	for _, line := range strings.Split(string(psOut), "\n") {
+		fields := strings.Split(line, strSep)
+		if len(fields) < 5 {
+			continue
+		}
+		containers = append(containers, ContainerInfo{fields[0], fields[1], fields[2], fields[3], fields[4]})
+	}
+	return containers, nil
+}
+
+func (e *cliEngine) Stop(container string, dryrun bool) error {
+	return execAndWait(e.command, []string{"stop", container}, Debug, dryrun)
+}
+
+func (e *cliEngine) Pull(image string, dryrun bool) error {
+	pullArgs := []string{"pull", image}
+	if dryrun {
+		Info.log("Dry run - skipping execution of: ", e.command, " ", strings.Join(pullArgs, " "))
+		return nil
+	}
+	Info.log("Pulling docker image ", image)
+	err := execAndWaitReturnErr(e.command, pullArgs, Info, dryrun)
+	if err != nil {
+		Warning.log("Docker image pull failed: ", err)
+		return err
+	}
+	return nil
+}
+
+func (e *cliEngine) Tag(image string, tag string, dryrun bool) error {
+	Info.log("Tagging Docker image as ", tag)
+	cmdArgs := []string{"image", "tag", image, tag}
+	if dryrun {
+		Info.log("Dry run - skipping execution of: ", e.command, " ", strings.Join(cmdArgs, " "))
+		return nil
+	}
+	tagCmd := exec.Command(e.command, cmdArgs...)
+	tagOut, tagErr := tagCmd.Output()
+	if tagErr != nil {
+		Error.log("Could not tag the image: ", tagErr, " ", string(tagOut[:]))
+		return tagErr
+	}
+	Debug.log(e.command, " tag command output: ", string(tagOut[:]))
+	return nil
+}
+
+// pushedDigest matches the digest docker push prints when it is done
+var pushedDigest = regexp.MustCompile(`digest: (sha256:[0-9a-f]{64})`)
+
+// Push assumes that the user has done docker login, or that the credentials were given with Login
+func (e *cliEngine) Push(image string, dryrun bool) (string, error) {
+	Info.log("Pushing docker image ", image)
+	if e.name == enginePodman {
+		return pushWithDigestFile(e.command, []string{"push", image}, dryrun)
+	}
+	cmdArgs := []string{"push", image}
+	if dryrun {
+		Info.log("Dry run - skipping execution of: ", e.command, " ", strings.Join(cmdArgs, " "))
+		return "", nil
+	}
+	pushCmd := exec.Command(e.command, cmdArgs...)
+	pushOut, pushErr := pushCmd.CombinedOutput()
+	if pushErr != nil {
+		return "", errors.Errorf("%v %s", pushErr, strings.TrimSpace(string(pushOut)))
+	}
+	Debug.log(e.command, " push command output: ", string(pushOut[:]))
+	var digest string
+	if match := pushedDigest.FindStringSubmatch(string(pushOut)); match != nil {
+		digest = match[1]
+	}
+	return digest, nil
+}
+
+func (e *cliEngine) Login(registry string, dryrun bool) error {
+	return loginCommand(e.command, registry, dryrun)
+}
+
+// Export uses docker save for a docker-archive, and converts the archive of docker save to an OCI layout,
+// so that the layout has the images that were built. podman saves both formats.
+func (e *cliEngine) Export(images []string, outputType string, dest string, dryrun bool) error {
+	Info.log("Exporting ", strings.Join(images, ", "), " to ", dest)
+	if e.name == enginePodman {
+		saveArgs := []string{"save", "--format", "oci-dir", "-o", dest, images[0]}
+		if outputType == outputDockerArchive {
+			saveArgs = []string{"save", "--format", "docker-archive", "-o", dest}
+			if len(images) > 1 {
+				saveArgs = append(saveArgs, "--multi-image-archive")
+			}
+			saveArgs = append(saveArgs, images...)
+		}
+		return execAndWaitReturnErr(e.command, saveArgs, Debug, dryrun)
+	}
+	if outputType == outputDockerArchive {
+		return execAndWaitReturnErr(e.command, append([]string{"save", "-o", dest}, images...), Debug, dryrun)
+	}
+	saveArgs := append([]string{"save"}, images...)
+	if dryrun {
+		Info.log("Dry run - skipping execution of: ", e.command, " ", strings.Join(saveArgs, " "))
+		return nil
+	}
+	Debug.log("Running command: ", e.command, " ", strings.Join(saveArgs, " "))
+	saveCmd := exec.Command(e.command, saveArgs...)
+	var stderr bytes.Buffer
+	saveCmd.Stderr = &stderr
+	// the archive is streamed to the layout, images do not fit in memory
+	archive, err := saveCmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = saveCmd.Start()
+	if err != nil {
+		return err
+	}
+	err = writeOCILayout(archive, dest)
+	_, _ = io.Copy(ioutil.Discard, archive)
+	waitErr := saveCmd.Wait()
+	if waitErr != nil {
+		return errors.Errorf("%s save failed: %v %s", e.command, waitErr, strings.TrimSpace(stderr.String()))
+	}
+	return err
+}
+
+// Load runs docker load, which only reads archives, so an OCI layout directory is archived first
+func (e *cliEngine) Load(source string, dryrun bool) ([]string, error) {
+	loadArgs := []string{"load", "-i", source}
+	if dryrun {
+		Info.log("Dry run - skipping execution of: ", e.command, " ", strings.Join(loadArgs, " "))
+		return nil, nil
+	}
+	if info, err := os.Stat(source); err == nil && info.IsDir() && e.name != enginePodman {
+		archive, err := archiveDirectory(source)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(archive)
+		loadArgs[2] = archive
+	}
+	Debug.log("Running command: ", e.command, " ", strings.Join(loadArgs, " "))
+	loadOut, err := exec.Command(e.command, loadArgs...).CombinedOutput()
+	if err != nil {
+		return nil, errors.Errorf("Could not load the images of %s: %v %s", source, err, strings.TrimSpace(string(loadOut)))
+	}
+	Debug.log(e.command, " load command output: ", string(loadOut))
+	return loadedImages(string(loadOut)), nil
+}
+
+func (e *cliEngine) ListVolumes() ([]VolumeInfo, error) {
+	lsCmd := exec.Command(e.command, "volume", "ls", "-q")
+	lsOut, err := lsCmd.Output()
+	if err != nil {
+		return nil, errors.Errorf("Could not list the volumes: %v", err)
+	}
+	names := strings.Fields(string(lsOut))
+	if len(names) == 0 {
+		return []VolumeInfo{}, nil
+	}
+	inspectCmd := exec.Command(e.command, append([]string{"volume", "inspect"}, names...)...)
+	inspectOut, err := inspectCmd.Output()
+	if err != nil {
+		return nil, errors.Errorf("Could not inspect the volumes: %v", err)
+	}
+	var volumes []VolumeInfo
+	err = json.Unmarshal(inspectOut, &volumes)
+	if err != nil {
+		return nil, errors.Errorf("Error unmarshaling data from volume inspect command: %v", err)
+	}
+	return volumes, nil
+}
+
+func (e *cliEngine) InspectVolume(name string) (*VolumeInfo, error) {
+	inspectCmd := exec.Command(e.command, "volume", "inspect", name)
+	var stderr bytes.Buffer
+	inspectCmd.Stderr = &stderr
+	inspectOut, err := inspectCmd.Output()
+	if err != nil {
+		if strings.Contains(strings.ToLower(stderr.String()), "no such volume") {
+			return nil, nil
+		}
+		return nil, errors.Errorf("Could not inspect the volume %s: %v %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	var volumes []VolumeInfo
+	err = json.Unmarshal(inspectOut, &volumes)
+	if err != nil {
+		return nil, errors.Errorf("Error unmarshaling data from volume inspect command: %v", err)
+	}
+	if len(volumes) == 0 {
+		return nil, nil
+	}
+	return &volumes[0], nil
+}
+
+// VolumeSizes parses the local volumes table of 'system df -v', which has the
+// volume name, the number of links and the size in its columns
+func (e *cliEngine) VolumeSizes() (map[string]string, error) {
+	dfCmd := exec.Command(e.command, "system", "df", "-v")
+	dfOut, err := dfCmd.Output()
+	if err != nil {
+		return nil, errors.Errorf("Could not get the disk usage of the volumes: %v", err)
+	}
+	sizes := map[string]string{}
+	inVolumes := false
+	for _, line := range strings.Split(string(dfOut), "\n") {
+		if strings.HasPrefix(line, "Local Volumes space usage") {
+			inVolumes = true
+			continue
+		}
+		fields := strings.Fields(line)
+		if !inVolumes || len(fields) == 0 {
+			continue
+		}
+		if strings.HasSuffix(line, ":") {
+			// the next table starts
+			break
+		}
+		if len(fields) >= 3 && fields[0] != "VOLUME" {
+			sizes[fields[0]] = fields[len(fields)-1]
+		}
+	}
+	return sizes, nil
+}
+
+func (e *cliEngine) CreateVolume(name string, labels map[string]string, dryrun bool) error {
+	createArgs := []string{"volume", "create"}
+	for key, value := range labels {
+		createArgs = append(createArgs, "--label", key+"="+value)
+	}
+	createArgs = append(createArgs, name)
+	return execAndWaitReturnErr(e.command, createArgs, Debug, dryrun)
+}
+
+func (e *cliEngine) RemoveVolume(name string, dryrun bool) error {
+	return execAndWaitReturnErr(e.command, []string{"volume", "rm", name}, Debug, dryrun)
+}
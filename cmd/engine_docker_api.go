@@ -0,0 +1,604 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const defaultDockerHost = "unix:///var/run/docker.sock"
+
+// dockerAPIEngine talks to the Docker Engine REST API for the queries and the image and
+// container management, and uses the docker CLI for run, build, create and cp, which
+// need the CLI's streaming, tty and archive handling.
+type dockerAPIEngine struct {
+	cli     *cliEngine
+	client  *http.Client
+	baseURL string
+}
+
+// dockerAPIError is the body of an error response of the Docker Engine API
+type dockerAPIError struct {
+	Message string `json:"message"`
+}
+
+// dockerAPIContainer is an entry of the GET /containers/json response
+type dockerAPIContainer struct {
+	ID      string   `json:"Id"`
+	Names   []string `json:"Names"`
+	Image   string   `json:"Image"`
+	Command string   `json:"Command"`
+	Status  string   `json:"Status"`
+}
+
+// dockerAPIImage is an entry of the image list
+type dockerAPIImage struct {
+	ID       string   `json:"Id"`
+	RepoTags []string `json:"RepoTags"`
+	Size     int64    `json:"Size"`
+}
+
+// dockerAPIProgress is a message of the progress stream returned by pull and push
+type dockerAPIProgress struct {
+	Status      string `json:"status"`
+	Error       string `json:"error"`
+	ErrorDetail struct {
+		Message string `json:"message"`
+	} `json:"errorDetail"`
+	// a push ends with the digest of the pushed image
+	Aux struct {
+		Digest string `json:"Digest"`
+	} `json:"aux"`
+}
+
+// NewDockerAPIEngine returns a container engine that uses the Docker Engine API at dockerHost,
+// which has the same form as DOCKER_HOST: unix:///path/to/socket or tcp://host:port.
+// The default socket is used when dockerHost is empty.
+func NewDockerAPIEngine(dockerHost string) (ContainerEngine, error) {
+	if dockerHost == "" {
+		dockerHost = defaultDockerHost
+	}
+	hostURL, err := url.Parse(dockerHost)
+	if err != nil {
+		return nil, errors.Errorf("Could not parse the docker host %s: %v", dockerHost, err)
+	}
+	engine := &dockerAPIEngine{cli: &cliEngine{name: engineDocker, command: "docker"}}
+	switch hostURL.Scheme {
+	case "unix":
+		socketPath := hostURL.Path
+		engine.client = &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		}
+		// the host is ignored when dialing the socket, but the request needs one
+		engine.baseURL = "http://docker"
+	case "tcp":
+		if os.Getenv("DOCKER_TLS_VERIFY") != "" {
+			return nil, errors.Errorf("TLS connections to the docker host %s are not supported by the docker-api engine. Use the docker engine instead.", dockerHost)
+		}
+		engine.client = &http.Client{}
+		engine.baseURL = "http://" + hostURL.Host
+	default:
+		return nil, errors.Errorf("The docker host %s is not supported by the docker-api engine. Use a unix:// or tcp:// address.", dockerHost)
+	}
+	return engine, nil
+}
+
+func (e *dockerAPIEngine) Name() string {
+	return engineDockerAPI
+}
+
+func (e *dockerAPIEngine) Command() string {
+	return e.cli.Command()
+}
+
+// do sends a request to the API and returns the response if its status is one of the expected codes.
+// The body is JSON unless the header sets another Content-Type.
+func (e *dockerAPIEngine) do(method string, path string, query url.Values, header http.Header, body io.Reader, expected ...int) (*http.Response, error) {
+	requestURL := e.baseURL + path
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+	Debug.log("Docker API request: ", method, " ", requestURL)
+	request, err := http.NewRequest(method, requestURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	response, err := e.client.Do(request)
+	if err != nil {
+		return nil, errors.Errorf("Could not connect to the docker daemon: %v", err)
+	}
+	for _, code := range expected {
+		if response.StatusCode == code {
+			return response, nil
+		}
+	}
+	defer response.Body.Close()
+	responseBody, _ := ioutil.ReadAll(response.Body)
+	var apiError dockerAPIError
+	if json.Unmarshal(responseBody, &apiError) == nil && apiError.Message != "" {
+		return nil, errors.Errorf("Docker API %s %s failed with status %d: %s", method, path, response.StatusCode, apiError.Message)
+	}
+	return nil, errors.Errorf("Docker API %s %s failed with status %d: %s", method, path, response.StatusCode, strings.TrimSpace(string(responseBody)))
+}
+
+// getJSON sends a GET request and decodes the JSON response into result
+func (e *dockerAPIEngine) getJSON(path string, query url.Values, result interface{}) error {
+	response, err := e.do("GET", path, query, nil, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	err = json.NewDecoder(response.Body).Decode(result)
+	if err != nil {
+		return errors.Errorf("Could not decode the response of %s: %v", path, err)
+	}
+	return nil
+}
+
+// readProgress consumes the progress stream of a pull or a push and returns the first error it reports
+func readProgress(body io.Reader, logger appsodylogger) error {
+	_, err := readProgressDigest(body, logger)
+	return err
+}
+
+// readProgressDigest consumes the progress stream of a push and returns the digest of the pushed image
+func readProgressDigest(body io.Reader, logger appsodylogger) (string, error) {
+	decoder := json.NewDecoder(body)
+	var digest string
+	for {
+		var progress dockerAPIProgress
+		err := decoder.Decode(&progress)
+		if err == io.EOF {
+			return digest, nil
+		}
+		if err != nil {
+			return "", errors.Errorf("Could not decode the progress stream: %v", err)
+		}
+		if progress.Error != "" {
+			return "", errors.New(progress.Error)
+		}
+		if progress.ErrorDetail.Message != "" {
+			return "", errors.New(progress.ErrorDetail.Message)
+		}
+		if progress.Status != "" {
+			logger.log(progress.Status)
+		}
+		if progress.Aux.Digest != "" {
+			digest = progress.Aux.Digest
+		}
+	}
+}
+
+func (e *dockerAPIEngine) CheckAvailable() error {
+	response, err := e.do("GET", "/_ping", nil, nil, nil, http.StatusOK)
+	if err != nil {
+		return errors.Errorf("docker does not seem to be installed or running - %v", err)
+	}
+	response.Body.Close()
+	return nil
+}
+
+func (e *dockerAPIEngine) RunAndListen(args []string, logger appsodylogger, interactive bool, verbose bool, dryrun bool) (*exec.Cmd, error) {
+	return e.cli.RunAndListen(args, logger, interactive, verbose, dryrun)
+}
+
+func (e *dockerAPIEngine) RunOutput(args []string) (string, error) {
+	return e.cli.RunOutput(args)
+}
+
+func (e *dockerAPIEngine) Build(args []string, logger appsodylogger, verbose bool, dryrun bool) error {
+	return e.cli.Build(args, logger, verbose, dryrun)
+}
+
+// BuildPlatforms runs docker buildx, which pushes with the credentials of the docker CLI
+func (e *dockerAPIEngine) BuildPlatforms(args []string, images []string, platforms []string, push bool, logger appsodylogger, verbose bool, dryrun bool) (string, error) {
+	return e.cli.BuildPlatforms(args, images, platforms, push, logger, verbose, dryrun)
+}
+
+func (e *dockerAPIEngine) InspectImage(image string) (*ImageInspect, error) {
+	var inspect ImageInspect
+	err := e.getJSON("/images/"+image+"/json", nil, &inspect)
+	if err != nil {
+		return nil, errors.Errorf("Could not inspect the image: %v", err)
+	}
+	return &inspect, nil
+}
+
+func (e *dockerAPIEngine) ImageID(image string) (string, error) {
+	inspect, err := e.InspectImage(image)
+	if err != nil {
+		return "", err
+	}
+	return inspect.ID, nil
+}
+
+func (e *dockerAPIEngine) ListImages(repository string) ([]ImageInfo, error) {
+	var apiImages []dockerAPIImage
+	filters, err := json.Marshal(map[string][]string{"reference": {repository}})
+	if err != nil {
+		return nil, err
+	}
+	err = e.getJSON("/images/json", url.Values{"filters": []string{string(filters)}}, &apiImages)
+	if err != nil {
+		return nil, errors.Errorf("Could not list the images %s: %v", repository, err)
+	}
+	var images = []ImageInfo{}
+	for _, apiImage := range apiImages {
+		for _, repoTag := range apiImage.RepoTags {
+			imageRepository, tag := splitImageTag(repoTag)
+			if matched, _ := path.Match(repository, imageRepository); !matched && repository != repoTag {
+				continue
+			}
+			images = append(images, ImageInfo{ID: apiImage.ID, Repository: imageRepository, Tag: tag, Size: apiImage.Size})
+		}
+	}
+	return images, nil
+}
+
+func (e *dockerAPIEngine) RemoveImage(image string, dryrun bool) error {
+	if dryrun {
+		Info.log("Dry run - skipping removal of image ", image)
+		return nil
+	}
+	response, err := e.do("DELETE", "/images/"+image, nil, nil, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+func (e *dockerAPIEngine) ImageExists(image string) bool {
+	_, err := e.InspectImage(image)
+	if err != nil {
+		Debug.log("Image ", image, " was not found locally: ", err)
+		return false
+	}
+	return true
+}
+
+func (e *dockerAPIEngine) Create(args []string, dryrun bool) error {
+	return e.cli.Create(args, dryrun)
+}
+
+func (e *dockerAPIEngine) Cp(source string, dest string, dryrun bool) error {
+	return e.cli.Cp(source, dest, dryrun)
+}
+
+func (e *dockerAPIEngine) Remove(container string, dryrun bool) error {
+	if dryrun {
+		Info.log("Dry run - skipping removal of container ", container)
+		return nil
+	}
+	query := url.Values{"force": []string{"1"}}
+	response, err := e.do("DELETE", "/containers/"+container, query, nil, nil, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+func (e *dockerAPIEngine) ListContainers(all bool) ([]ContainerInfo, error) {
+	var apiContainers []dockerAPIContainer
+	var query url.Values
+	if all {
+		query = url.Values{"all": []string{"1"}}
+	}
+	err := e.getJSON("/containers/json", query, &apiContainers)
+	if err != nil {
+		return nil, err
+	}
+	var containers = []ContainerInfo{}
+	for _, apiContainer := range apiContainers {
+		names := make([]string, 0, len(apiContainer.Names))
+		for _, name := range apiContainer.Names {
+			names = append(names, strings.TrimPrefix(name, "/"))
+		}
+		containers = append(containers, ContainerInfo{
+			ID:      apiContainer.ID,
+			Image:   apiContainer.Image,
+			Status:  apiContainer.Status,
+			Names:   strings.Join(names, ","),
+			Command: apiContainer.Command,
+		})
+	}
+	return containers, nil
+}
+
+func (e *dockerAPIEngine) Stop(container string, dryrun bool) error {
+	if dryrun {
+		Info.log("Dry run - skipping stop of container ", container)
+		return nil
+	}
+	// 304 means the container was already stopped
+	response, err := e.do("POST", "/containers/"+container+"/stop", nil, nil, nil, http.StatusNoContent, http.StatusNotModified)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+func (e *dockerAPIEngine) Pull(image string, dryrun bool) error {
+	if dryrun {
+		Info.log("Dry run - skipping pull of image ", image)
+		return nil
+	}
+	Info.log("Pulling docker image ", image)
+	repository, tag := splitImageTag(image)
+	query := url.Values{"fromImage": []string{repository}, "tag": []string{tag}}
+	header := http.Header{"X-Registry-Auth": []string{registryAuth(repository)}}
+	response, err := e.do("POST", "/images/create", query, header, nil, http.StatusOK)
+	if err == nil {
+		defer response.Body.Close()
+		err = readProgress(response.Body, Debug)
+	}
+	if err != nil {
+		Warning.log("Docker image pull failed: ", err)
+		return err
+	}
+	return nil
+}
+
+func (e *dockerAPIEngine) Tag(image string, tag string, dryrun bool) error {
+	Info.log("Tagging Docker image as ", tag)
+	if dryrun {
+		Info.log("Dry run - skipping tag of image ", image, " as ", tag)
+		return nil
+	}
+	repository, tagName := splitImageTag(tag)
+	query := url.Values{"repo": []string{repository}, "tag": []string{tagName}}
+	response, err := e.do("POST", "/images/"+image+"/tag", query, nil, nil, http.StatusCreated)
+	if err != nil {
+		Error.log("Could not tag the image: ", err)
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+func (e *dockerAPIEngine) Push(image string, dryrun bool) (string, error) {
+	Info.log("Pushing docker image ", image)
+	if dryrun {
+		Info.log("Dry run - skipping push of image ", image)
+		return "", nil
+	}
+	repository, tag := splitImageTag(image)
+	query := url.Values{"tag": []string{tag}}
+	header := http.Header{"X-Registry-Auth": []string{registryAuth(repository)}}
+	response, err := e.do("POST", "/images/"+repository+"/push", query, header, nil, http.StatusOK)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	return readProgressDigest(response.Body, Debug)
+}
+
+// Login does nothing, the credentials are sent with each pull and push
+func (e *dockerAPIEngine) Login(registry string, dryrun bool) error {
+	return nil
+}
+
+// Export saves a docker-archive with the API, and converts it to an OCI layout like the docker engine does
+func (e *dockerAPIEngine) Export(images []string, outputType string, dest string, dryrun bool) error {
+	Info.log("Exporting ", strings.Join(images, ", "), " to ", dest)
+	if dryrun {
+		Info.log("Dry run - skipping export of the images to ", dest)
+		return nil
+	}
+	response, err := e.do("GET", "/images/get", url.Values{"names": images}, nil, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if outputType == outputOCI {
+		return writeOCILayout(response.Body, dest)
+	}
+	archive, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(archive, response.Body)
+	closeErr := archive.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Errorf("Could not write the images to %s: %v", dest, err)
+	}
+	return nil
+}
+
+// Load sends the archive, or the archived OCI layout directory, to the daemon
+func (e *dockerAPIEngine) Load(source string, dryrun bool) ([]string, error) {
+	if dryrun {
+		Info.log("Dry run - skipping load of the images of ", source)
+		return nil, nil
+	}
+	archive := source
+	if info, err := os.Stat(source); err == nil && info.IsDir() {
+		archive, err = archiveDirectory(source)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(archive)
+	}
+	// the archive is streamed to the daemon, images do not fit in memory
+	body, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	header := http.Header{"Content-Type": []string{"application/x-tar"}}
+	response, err := e.do("POST", "/images/load", url.Values{"quiet": []string{"1"}}, header, body, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	var loaded []string
+	decoder := json.NewDecoder(response.Body)
+	for {
+		var message struct {
+			Stream string `json:"stream"`
+			Error  string `json:"error"`
+		}
+		err = decoder.Decode(&message)
+		if err == io.EOF {
+			return loaded, nil
+		}
+		if err != nil {
+			return nil, errors.Errorf("Could not decode the response of the image load: %v", err)
+		}
+		if message.Error != "" {
+			return nil, errors.New(message.Error)
+		}
+		loaded = append(loaded, loadedImages(message.Stream)...)
+	}
+}
+
+// splitImageTag splits an image reference into the repository and the tag, which defaults to latest.
+// A colon followed by a port in the registry host is not a tag.
+func splitImageTag(image string) (string, string) {
+	if index := strings.Index(image, "@"); index >= 0 {
+		// the digest is passed as the tag
+		return image[:index], image[index+1:]
+	}
+	lastColon := strings.LastIndex(image, ":")
+	if lastColon > strings.LastIndex(image, "/") {
+		return image[:lastColon], image[lastColon+1:]
+	}
+	return image, "latest"
+}
+
+// registryAuth returns the X-Registry-Auth header value for the registry of the repository.
+// The daemon requires the header on push, so an empty auth config is sent when there are no credentials.
+func registryAuth(repository string) string {
+	authBytes, _ := json.Marshal(lookupCredentials(repository))
+	return base64.URLEncoding.EncodeToString(authBytes)
+}
+
+// dockerAPIVolume is a volume of the GET /volumes and GET /system/df responses
+type dockerAPIVolume struct {
+	VolumeInfo
+	UsageData *struct {
+		Size int64 `json:"Size"`
+	} `json:"UsageData"`
+}
+
+func (e *dockerAPIEngine) ListVolumes() ([]VolumeInfo, error) {
+	var volumesResponse struct {
+		Volumes []dockerAPIVolume `json:"Volumes"`
+	}
+	err := e.getJSON("/volumes", nil, &volumesResponse)
+	if err != nil {
+		return nil, err
+	}
+	volumes := []VolumeInfo{}
+	for _, volume := range volumesResponse.Volumes {
+		volumes = append(volumes, volume.VolumeInfo)
+	}
+	return volumes, nil
+}
+
+func (e *dockerAPIEngine) InspectVolume(name string) (*VolumeInfo, error) {
+	response, err := e.do("GET", "/volumes/"+name, nil, nil, nil, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	var volume VolumeInfo
+	err = json.NewDecoder(response.Body).Decode(&volume)
+	if err != nil {
+		return nil, errors.Errorf("Could not decode the response of /volumes/%s: %v", name, err)
+	}
+	return &volume, nil
+}
+
+func (e *dockerAPIEngine) VolumeSizes() (map[string]string, error) {
+	var diskUsage struct {
+		Volumes []dockerAPIVolume `json:"Volumes"`
+	}
+	err := e.getJSON("/system/df", nil, &diskUsage)
+	if err != nil {
+		return nil, err
+	}
+	sizes := map[string]string{}
+	for _, volume := range diskUsage.Volumes {
+		// the size is -1 when it could not be computed
+		if volume.UsageData != nil && volume.UsageData.Size >= 0 {
+			sizes[volume.Name] = formatBytes(volume.UsageData.Size)
+		}
+	}
+	return sizes, nil
+}
+
+func (e *dockerAPIEngine) CreateVolume(name string, labels map[string]string, dryrun bool) error {
+	if dryrun {
+		Info.log("Dry run - skipping creation of volume ", name)
+		return nil
+	}
+	body, err := json.Marshal(map[string]interface{}{"Name": name, "Labels": labels})
+	if err != nil {
+		return err
+	}
+	response, err := e.do("POST", "/volumes/create", nil, nil, bytes.NewReader(body), http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+func (e *dockerAPIEngine) RemoveVolume(name string, dryrun bool) error {
+	if dryrun {
+		Info.log("Dry run - skipping removal of volume ", name)
+		return nil
+	}
+	response, err := e.do("DELETE", "/volumes/"+name, nil, nil, nil, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd"
+)
+
+func TestDockerAPIEngine(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[
+			{"Id": "0123456789abcdef0123", "Names": ["/my-project-dev"], "Image": "appsody/nodejs-express:0.2", "Command": "/appsody/appsody-controller --mode=run", "Status": "Up 2 minutes"},
+			{"Id": "fedcba9876543210fedc", "Names": ["/other"], "Image": "nginx", "Command": "nginx -g 'daemon off;'", "Status": "Up 1 hour"}
+		]`))
+	})
+	mux.HandleFunc("/images/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/images/appsody/nodejs-express:0.2/json" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message": "No such image: missing:latest"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{
+			"Id": "sha256:1234",
+			"RepoTags": ["appsody/nodejs-express:0.2"],
+			"Config": {
+				"Env": ["PATH=/usr/bin", "APPSODY_MOUNTS=.:/project/user-app", "EMPTY="],
+				"ExposedPorts": {"3000/tcp": {}, "9229/tcp": {}},
+				"Labels": {"dev.appsody.stack.version": "0.2.8"}
+			}
+		}`))
+	})
+	mux.HandleFunc("/containers/my-project-dev/stop", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	dockerHost, cleanup := startFakeDockerDaemon(t, mux)
+	defer cleanup()
+
+	engine, err := cmd.NewDockerAPIEngine(dockerHost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	containers, err := engine.ListContainers(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 2 {
+		t.Fatalf("Expected 2 containers but found %d", len(containers))
+	}
+	if containers[0].Names != "my-project-dev" || containers[0].Status != "Up 2 minutes" || !strings.Contains(containers[0].Command, "appsody-controller") {
+		t.Errorf("Unexpected container %+v", containers[0])
+	}
+
+	inspect, err := engine.InspectImage("appsody/nodejs-express:0.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inspect.ID != "sha256:1234" {
+		t.Errorf("Expected image ID sha256:1234 but found %s", inspect.ID)
+	}
+	if len(inspect.Config.Env) != 3 || inspect.Config.Env[1] != "APPSODY_MOUNTS=.:/project/user-app" {
+		t.Errorf("Unexpected image environment %v", inspect.Config.Env)
+	}
+	if _, found := inspect.Config.ExposedPorts["3000/tcp"]; !found || len(inspect.Config.ExposedPorts) != 2 {
+		t.Errorf("Unexpected exposed ports %v", inspect.Config.ExposedPorts)
+	}
+	if inspect.Config.Labels["dev.appsody.stack.version"] != "0.2.8" {
+		t.Errorf("Unexpected image labels %v", inspect.Config.Labels)
+	}
+
+	if !engine.ImageExists("appsody/nodejs-express:0.2") {
+		t.Error("Expected image appsody/nodejs-express:0.2 to exist")
+	}
+	if engine.ImageExists("missing") {
+		t.Error("Expected image missing not to exist")
+	}
+	_, err = engine.InspectImage("missing")
+	if err == nil || !strings.Contains(err.Error(), "No such image: missing:latest") {
+		t.Errorf("Expected the daemon error message but got %v", err)
+	}
+
+	err = engine.Stop("my-project-dev", false)
+	if err != nil {
+		t.Error(err)
+	}
+	err = engine.Stop("unknown", false)
+	if err == nil {
+		t.Error("Expected an error stopping an unknown container")
+	}
+}
+
+func TestDockerAPIEngineHosts(t *testing.T) {
+	if _, err := cmd.NewDockerAPIEngine("tcp://127.0.0.1:2375"); err != nil {
+		t.Errorf("Expected a tcp docker host to be accepted: %v", err)
+	}
+	_, err := cmd.NewDockerAPIEngine("npipe:////./pipe/docker_engine")
+	if err == nil || !strings.Contains(err.Error(), "is not supported by the docker-api engine") {
+		t.Errorf("Expected an unsupported docker host error but got %v", err)
+	}
+	dockerHost, cleanup := startFakeDockerDaemon(t, http.NotFoundHandler())
+	defer cleanup()
+	engine, err := cmd.NewDockerAPIEngine(dockerHost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = engine.CheckAvailable(); err == nil {
+		t.Error("Expected CheckAvailable to fail when the daemon does not answer the ping")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+// The unexported functions the tests of the cmd_test package use
+
+var (
+	SplitShellWords    = splitShellWords
+	ParseDockerOptions = parseDockerOptions
+	DockerRunFlags     = dockerRunFlags
+	DockerBuildFlags   = dockerBuildFlags
+
+	ResolveHostPortConflicts = resolveHostPortConflicts
+
+	ControllerVersionMatches = controllerVersionMatches
+
+	GuessDebugger = guessDebugger
+
+	StripURLCredentials = stripURLCredentials
+
+	ContainsPlatform = containsPlatform
+
+	PushWithRetries      = pushWithRetries
+	IsTransientPushError = isTransientPushError
+	PushRetryDelay       = &pushRetryDelay
+)
+
+// LoginCommand logs in to the registry with the command like build --registry-username does,
+// and returns the function that removes the temporary docker config of the login
+func LoginCommand(command string, registry string, username string, password string) (func(), error) {
+	explicitCredentials = map[string]registryCredentials{registry: {Username: username, Password: password, ServerAddress: registry}}
+	return removeLoginConfig, loginCommand(command, registry, false)
+}
+
+// VscodeLaunchConfig returns the launch.json content with the debug configuration of the target
+func VscodeLaunchConfig(launchFile string, name string, debugger string, hostPort int, remoteRoot string) ([]byte, error) {
+	return vscodeLaunchConfig(launchFile, &ideDebugTarget{name: name, debugger: debugger, hostPort: hostPort, remoteRoot: remoteRoot})
+}
+
+// IntellijRunConfig returns the IntelliJ run configuration of the target
+func IntellijRunConfig(name string, debugger string, hostPort int, remoteRoot string) ([]byte, error) {
+	return intellijRunConfig(&ideDebugTarget{name: name, debugger: debugger, hostPort: hostPort, remoteRoot: remoteRoot})
+}
+
+// PullBack returns the function that pulls the sync back paths from the dev container of the app into the project
+func PullBack(localDir string, remoteDir string, syncBack []string, appName string) func() error {
+	syncer := &kubeSync{localDir: localDir, remoteDir: remoteDir, syncBack: syncBack, appName: appName, pod: appName, snapshot: map[string]syncFileState{}}
+	return syncer.pullBack
+}
+
+// BuildxPush builds and pushes the images for the platforms with the docker command, without explicit credentials
+func BuildxPush(command string, images []string, platforms []string) (string, error) {
+	explicitCredentials = map[string]registryCredentials{}
+	engine := &cliEngine{name: engineDocker, command: command}
+	return engine.BuildPlatforms([]string{"."}, images, platforms, true, DockerLog, false, false)
+}
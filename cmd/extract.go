@@ -15,7 +15,6 @@
 package cmd
 
 import (
-	"fmt"
 	"os"
 	"strings"
 
@@ -39,7 +38,12 @@ func newExtractCmd(rootConfig *RootCommandConfig) *cobra.Command {
 		Use:   "extract",
 		Short: "Extract the stack and your Appsody project to a local directory",
 		Long: `This copies the full project, stack plus app, into a local directory
-in preparation to build the final container image.`,
+in preparation to build the final container image.
+
+The extracted project is kept in $HOME/.appsody/extract. When the stack image did not change since the
+last extract, only the changed project files are copied, and nothing is copied when no file changed.
+The project files that match the patterns of the .appsodyignore file of the project, which has the
+syntax of .dockerignore, are not extracted, so they are not in the images appsody build creates.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return extract(config)
 		},
@@ -49,6 +53,7 @@ in preparation to build the final container image.`,
 	extractCmd.PersistentFlags().BoolVar(&rootConfig.Buildah, "buildah", false, "Extract project using buildah primitives instead of docker.")
 	defaultName := defaultExtractContainerName(rootConfig)
 	extractCmd.PersistentFlags().StringVar(&config.extractContainerName, "name", defaultName, "Assign a name to your development container.")
+	addPullPolicyFlag(extractCmd, rootConfig)
 	return extractCmd
 }
 
@@ -67,6 +72,7 @@ func extract(config *extractCommandConfig) error {
 		return projectErr
 	}
 	Info.log("Extracting project from development environment")
+	logPhase(phaseExtracting, projectName)
 
 	targetDir := config.targetDir
 	if targetDir != "" {
@@ -91,44 +97,24 @@ func extract(config *extractCommandConfig) error {
 		}
 	}
 
-	extractDir := filepath.Join(getHome(config.RootCommandConfig), "extract")
-	extractDirExists, err := Exists(extractDir)
+	extractRoot := filepath.Join(getHome(config.RootCommandConfig), "extract")
+	extractRootExists, err := Exists(extractRoot)
 	if err != nil {
 		return errors.Errorf("Error checking directory: %v", err)
 	}
-	if !extractDirExists {
+	if !extractRootExists {
 		if config.Dryrun {
-			Info.log("Dry Run - Skip creating extract dir: ", extractDir)
+			Info.log("Dry Run - Skip creating extract dir: ", extractRoot)
 		} else {
-			Debug.log("Creating extract dir: ", extractDir)
-			err = os.MkdirAll(extractDir, os.ModePerm)
+			Debug.log("Creating extract dir: ", extractRoot)
+			err = os.MkdirAll(extractRoot, os.ModePerm)
 			if err != nil {
-				return errors.Errorf("Error creating directories %s %v", extractDir, err)
+				return errors.Errorf("Error creating directories %s %v", extractRoot, err)
 			}
 		}
 	}
-	extractDir = filepath.Join(extractDir, projectName)
-	extractDirExists, err = Exists(extractDir)
-	if err != nil {
-		return errors.Errorf("Error checking directory: %v", err)
-	}
-	if extractDirExists {
-		if config.Dryrun {
-			Info.log("Dry Run - Skip deleting extract dir: ", extractDir)
-		} else {
-			Debug.log("Deleting extract dir: ", extractDir)
-			os.RemoveAll(extractDir)
-		}
-	}
-
-	if config.Buildah {
-		// Buildah fails if the destination does not exist.
-		Debug.log("Creating extract dir: ", extractDir)
-		err = os.MkdirAll(extractDir, os.ModePerm)
-		if err != nil {
-			return errors.Errorf("Error creating directories %s %v", extractDir, err)
-		}
-	}
+	extractDir := filepath.Join(extractRoot, projectName)
+	manifestFile := getExtractManifestFile(config.RootCommandConfig, projectName)
 
 	stackImage := projectConfig.Platform
 
@@ -147,33 +133,89 @@ func extract(config *extractCommandConfig) error {
 	if volumeErr != nil {
 		return volumeErr
 	}
-	cmdName := "docker"
+	engine, engineErr := getContainerEngine(config.RootCommandConfig)
+	if engineErr != nil {
+		return engineErr
+	}
+
+	// The extract directory is kept between extracts. When the stack image did not change, the changed
+	// project files are copied from the mounts, without going through a container.
+	stackImageID, err := engine.ImageID(stackImage)
+	if err != nil {
+		Debug.log("The stack image ID is not known, extracting the whole project: ", err)
+	}
+	localFiles, ignoredFiles, err := scanProjectMounts(config.RootCommandConfig, volumeMaps, containerProjectDir)
+	if err != nil {
+		return err
+	}
+	previous := readExtractManifest(manifestFile)
+	if previous != nil && !previous.intact(extractDir) {
+		previous = nil
+	}
+	if previous != nil && stackImageID != "" && previous.StackImageID == stackImageID && strings.Join(previous.Mounts, " ") == strings.Join(volumeMaps, " ") {
+		changed, incremental := previous.localChanges(localFiles)
+		if incremental {
+			if len(changed) == 0 {
+				Info.log("The stack image and the project files did not change since the last extract")
+			} else if config.Dryrun {
+				Info.logf("Dry Run - Skip copying the %d changed project files to %s", len(changed), extractDir)
+			} else {
+				for _, path := range changed {
+					file := localFiles[path]
+					Debug.log("Copying the changed project file ", path)
+					err = copyExtractedFile(file.source, filepath.Join(extractDir, filepath.FromSlash(path)), file.extractedFile)
+					if err != nil {
+						return errors.Errorf("Could not copy %s to the extract directory: %v", file.source, err)
+					}
+					previous.Files[path] = file.extractedFile
+				}
+				err = writeExtractManifest(manifestFile, previous)
+				if err != nil {
+					return err
+				}
+				Info.logf("Copied %d changed project files", len(changed))
+			}
+			return placeExtractDir(config, extractDir, targetDir)
+		}
+		Debug.log("Project files that were removed or that hide files of the stack need the whole project to be extracted")
+	}
+
+	// the container is copied to a staging directory, and only the files that changed are copied to the extract directory
+	stagingDir := filepath.Join(extractRoot, "."+projectName+".staging")
+	stagingDirExists, err := Exists(stagingDir)
+	if err != nil {
+		return errors.Errorf("Error checking directory: %v", err)
+	}
+	if stagingDirExists {
+		if config.Dryrun {
+			Info.log("Dry Run - Skip deleting extract staging dir: ", stagingDir)
+		} else {
+			Debug.log("Deleting extract staging dir: ", stagingDir)
+			os.RemoveAll(stagingDir)
+		}
+	}
+
 	if config.Buildah {
-		cmdName = "buildah"
+		// Buildah fails if the destination does not exist.
+		Debug.log("Creating extract staging dir: ", stagingDir)
+		err = os.MkdirAll(stagingDir, os.ModePerm)
+		if err != nil {
+			return errors.Errorf("Error creating directories %s %v", stagingDir, err)
+		}
 	}
+
 	var appDir string
 	cmdArgs := []string{"--name", extractContainerName}
 	if len(volumeMaps) > 0 {
 		cmdArgs = append(cmdArgs, volumeMaps...)
 	}
 
-	if runtime.GOOS != "windows" {
-		// On Linux and OS/X we run docker create or buildah from
-		if config.Buildah {
-			cmdArgs = append([]string{"from"}, cmdArgs...)
-		} else {
-			cmdArgs = append([]string{"create"}, cmdArgs...)
-		}
-		cmdArgs = append(cmdArgs, stackImage)
-		err = execAndWaitReturnErr(cmdName, cmdArgs, Debug, config.Dryrun)
+	if runtime.GOOS != "windows" || config.Buildah {
+		// On Linux and OS/X we create the container without running it (docker create or buildah from)
+		err = engine.Create(append(cmdArgs, stackImage), config.Dryrun)
 		if err != nil {
-
-			if config.Buildah {
-				Error.log("buildah from command failed: ", err)
-			} else {
-				Error.log("docker create command failed: ", err)
-			}
-			removeErr := containerRemove(extractContainerName, config.Buildah, config.Dryrun)
+			Error.log(engine.Command(), " create command failed: ", err)
+			removeErr := engine.Remove(extractContainerName, config.Dryrun)
 			Error.log("Error in containerRemove", removeErr)
 			return err
 
@@ -192,7 +234,7 @@ func extract(config *extractCommandConfig) error {
 		if err != nil {
 			Debug.log("Error attempting to run copy command ", bashCmd, " on image ", stackImage, ": ", err)
 
-			removeErr := containerRemove(extractContainerName, config.Buildah, config.Dryrun)
+			removeErr := engine.Remove(extractContainerName, config.Dryrun)
 			if removeErr != nil {
 				Error.log("containerRemove error ", removeErr)
 			}
@@ -203,29 +245,15 @@ func extract(config *extractCommandConfig) error {
 		//If everything went fine, we need to set the source project directory to /tmp/...
 		appDir = extractContainerName + ":" + filepath.Join("/tmp", containerProjectDir)
 	}
-	cmdArgs = []string{"cp", appDir, extractDir}
-	if config.Buildah {
-		appDir = containerProjectDir
-		cmdName = "/bin/sh"
-		script := fmt.Sprintf("x=`buildah mount %s`; cp -rf $x/%s/* %s", extractContainerName, appDir, extractDir)
-		cmdArgs = []string{"-c", script}
-	}
-	err = execAndWaitReturnErr(cmdName, cmdArgs, Debug, config.Dryrun)
+	err = engine.Cp(appDir, stagingDir, config.Dryrun)
 	if err != nil {
-		if config.Buildah {
-			Error.log("buildah mount / copy command failed: ", err)
-		} else {
-			Error.log("docker cp command failed: ", err)
-		}
+		Error.log(engine.Command(), " cp command failed: ", err)
 
-		removeErr := containerRemove(extractContainerName, config.Buildah, config.Dryrun)
+		removeErr := engine.Remove(extractContainerName, config.Dryrun)
 		if removeErr != nil {
 			Error.log("containerRemove error ", removeErr)
 		}
-		if config.Buildah {
-			return errors.Errorf("buildah mount / copy command failed: %v", err)
-		}
-		return errors.Errorf("docker cp command failed: %v", err)
+		return errors.Errorf("%s cp command failed: %v", engine.Command(), err)
 	}
 
 	// A class of systems (e.g:- RHEL 7.6) exhibit situations wherein
@@ -246,7 +274,7 @@ func extract(config *extractCommandConfig) error {
 						return errors.Errorf("Error getting cwd: %v", err)
 					}
 				}
-				dest = strings.Replace(dest, appDir, extractDir, -1)
+				dest = strings.Replace(dest, containerProjectDir, stagingDir, -1)
 				Debug.log("Local-adjusted mount destination: ", dest)
 				fileInfo, err := os.Lstat(src)
 				if err != nil {
@@ -260,7 +288,7 @@ func extract(config *extractCommandConfig) error {
 				}
 				err = os.MkdirAll(mkdir, os.ModePerm)
 				if err != nil {
-					return errors.Errorf("Error creating directories %s %v", extractDir, err)
+					return errors.Errorf("Error creating directories %s %v", stagingDir, err)
 				}
 
 				fileInfo, err = os.Lstat(src)
@@ -285,26 +313,63 @@ func extract(config *extractCommandConfig) error {
 		}
 	}
 
-	removeErr := containerRemove(extractContainerName, config.Buildah, config.Dryrun)
+	removeErr := engine.Remove(extractContainerName, config.Dryrun)
 	if removeErr != nil {
 		Error.log("containerRemove error ", removeErr)
 	}
-	if targetDir == "" {
-		if !config.Dryrun {
-			Info.log("Project extracted to ", extractDir)
-		}
+	if config.Dryrun {
+		Info.log("Dry Run - Skip updating extract dir: ", extractDir)
 	} else {
-		if config.Dryrun {
-			Info.log("Dry Run - Skip moving ", extractDir, " to ", targetDir)
-		} else {
-			err = MoveDir(extractDir, targetDir)
+		// the container copies the whole mounts, without the rules of .appsodyignore
+		for _, path := range ignoredFiles {
+			err = os.RemoveAll(filepath.Join(stagingDir, filepath.FromSlash(path)))
 			if err != nil {
-				return errors.Errorf("Extract failed when moving %s to %s %v", extractDir, targetDir, err)
-
+				return errors.Errorf("Could not remove the ignored file %s: %v", path, err)
 			}
-			Info.log("Project extracted to ", targetDir)
 		}
+		if len(ignoredFiles) > 0 {
+			Debug.logf("Removed %d files excluded by %s", len(ignoredFiles), appsodyIgnoreFile)
+		}
+		var previousFiles map[string]extractedFile
+		if previous != nil {
+			previousFiles = previous.Files
+		}
+		files, err := syncExtractDir(stagingDir, extractDir, previousFiles)
+		if err != nil {
+			return err
+		}
+		for path, file := range files {
+			if _, found := localFiles[path]; found {
+				file.Local = true
+				files[path] = file
+			}
+		}
+		err = writeExtractManifest(manifestFile, &extractManifest{StackImageID: stackImageID, Mounts: volumeMaps, Files: files})
+		if err != nil {
+			return err
+		}
+	}
+	return placeExtractDir(config, extractDir, targetDir)
+}
+
+// placeExtractDir copies the extract directory to the target directory, if any.
+// The extract directory is kept for the next extract.
+func placeExtractDir(config *extractCommandConfig, extractDir string, targetDir string) error {
+	if targetDir == "" {
+		if !config.Dryrun {
+			Info.log("Project extracted to ", extractDir)
+		}
+		return nil
+	}
+	if config.Dryrun {
+		Info.log("Dry Run - Skip copying ", extractDir, " to ", targetDir)
+		return nil
+	}
+	err := copyDir(extractDir, targetDir)
+	if err != nil {
+		return errors.Errorf("Extract failed when copying %s to %s %v", extractDir, targetDir, err)
 	}
+	Info.log("Project extracted to ", targetDir)
 	return nil
 }
 
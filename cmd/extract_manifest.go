@@ -0,0 +1,343 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// extractManifest records the content of the extract directory of a project and what it was extracted from,
+// so that the next extract only copies what changed
+type extractManifest struct {
+	StackImageID string `json:"stackImageID"`
+	// the mounts of the stack, in the -v <local>:<container> form
+	Mounts []string                 `json:"mounts"`
+	Files  map[string]extractedFile `json:"files"`
+}
+
+// extractedFile is a file of the extract directory, by its slash separated path in the directory
+type extractedFile struct {
+	Mode os.FileMode `json:"mode"`
+	Size int64       `json:"size"`
+	// the sha256 of the content of a file, or the target of a symbolic link. Directories have none.
+	Hash string `json:"hash,omitempty"`
+	// Local files come from the mounts of the project rather than from the stack image
+	Local bool `json:"local,omitempty"`
+}
+
+// localFile is a file of a mount of the project, with the path it has in the extract directory
+type localFile struct {
+	extractedFile
+	source string
+}
+
+func getExtractManifestFile(config *RootCommandConfig, projectName string) string {
+	return filepath.Join(getHome(config), "extract", projectName+".manifest.json")
+}
+
+// readExtractManifest returns the manifest of the last extract, or nil when there is none
+func readExtractManifest(manifestFile string) *extractManifest {
+	manifestBytes, err := ioutil.ReadFile(manifestFile)
+	if err != nil {
+		return nil
+	}
+	var manifest extractManifest
+	err = json.Unmarshal(manifestBytes, &manifest)
+	if err != nil || manifest.Files == nil {
+		Debug.log("Ignoring the extract manifest ", manifestFile, ": ", err)
+		return nil
+	}
+	return &manifest
+}
+
+func writeExtractManifest(manifestFile string, manifest *extractManifest) error {
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(manifestFile, manifestBytes, 0644)
+	if err != nil {
+		return errors.Errorf("Could not write the extract manifest %s: %v", manifestFile, err)
+	}
+	return nil
+}
+
+// hashFile returns the entry of a file, with the hash of its content
+func hashFile(path string, info os.FileInfo) (extractedFile, error) {
+	entry := extractedFile{Mode: info.Mode(), Size: info.Size()}
+	if info.IsDir() {
+		entry.Size = 0
+		return entry, nil
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return entry, err
+		}
+		entry.Hash = "link:" + target
+		return entry, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return entry, err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return entry, err
+	}
+	entry.Hash = hex.EncodeToString(hash.Sum(nil))
+	return entry, nil
+}
+
+// scanTree returns the entries of the files in the directory
+func scanTree(dir string) (map[string]extractedFile, error) {
+	files := make(map[string]extractedFile)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		relative, err := filepath.Rel(dir, path)
+		if err != nil || relative == "." {
+			return err
+		}
+		entry, err := hashFile(path, info)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(relative)] = entry
+		return nil
+	})
+	return files, err
+}
+
+// scanMounts returns the files of the local mounts of the project, by their path in the extract directory,
+// and the paths of the files of the project directory the rules of .appsodyignore exclude
+func scanMounts(volumeMaps []string, containerProjectDir string, projectDir string, rules *ignoreRules) (map[string]localFile, []string, error) {
+	files := make(map[string]localFile)
+	var ignored []string
+	for _, item := range volumeMaps {
+		if item == "-v" {
+			continue
+		}
+		// the container path has no colon, the local one may have a drive letter
+		separator := strings.LastIndex(item, ":")
+		if separator < 0 {
+			continue
+		}
+		source, dest := filepath.FromSlash(item[:separator]), item[separator+1:]
+		if dest != containerProjectDir && !strings.HasPrefix(dest, containerProjectDir+"/") {
+			// mounted outside of the project, so it is not extracted
+			continue
+		}
+		destPath := strings.TrimPrefix(strings.TrimPrefix(dest, containerProjectDir), "/")
+		err := filepath.Walk(source, func(path string, info os.FileInfo, walkErr error) error {
+			if walkErr != nil {
+				return walkErr
+			}
+			relative, err := filepath.Rel(source, path)
+			if err != nil {
+				return err
+			}
+			extractPath := strings.TrimPrefix(destPath+"/"+filepath.ToSlash(relative), "/")
+			extractPath = strings.TrimSuffix(strings.TrimSuffix(extractPath, "."), "/")
+			if extractPath == "" {
+				return nil
+			}
+			if projectPath, err := filepath.Rel(projectDir, path); err == nil && !strings.HasPrefix(projectPath, "..") && rules.ignored(filepath.ToSlash(projectPath)) {
+				if !info.IsDir() {
+					ignored = append(ignored, extractPath)
+					return nil
+				}
+				if rules.skipDir(filepath.ToSlash(projectPath)) {
+					ignored = append(ignored, extractPath)
+					return filepath.SkipDir
+				}
+				// an exception may include some of its content, which is walked
+				return nil
+			}
+			entry, err := hashFile(path, info)
+			if err != nil {
+				return err
+			}
+			entry.Local = true
+			files[extractPath] = localFile{extractedFile: entry, source: path}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, errors.Errorf("Could not read the mounted files of %s: %v", source, err)
+		}
+	}
+	return files, ignored, nil
+}
+
+// scanProjectMounts scans the mounts of the project with the rules of its .appsodyignore file
+func scanProjectMounts(config *RootCommandConfig, volumeMaps []string, containerProjectDir string) (map[string]localFile, []string, error) {
+	projectDir, err := getProjectDir(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	rules, err := loadIgnoreRules(projectDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	return scanMounts(volumeMaps, containerProjectDir, projectDir, rules)
+}
+
+// intact reports whether the files of the manifest are still in the extract directory
+func (manifest *extractManifest) intact(extractDir string) bool {
+	for path, entry := range manifest.Files {
+		info, err := os.Lstat(filepath.Join(extractDir, filepath.FromSlash(path)))
+		if err != nil || info.Mode() != entry.Mode || (!info.IsDir() && info.Size() != entry.Size) {
+			Debug.log("The extract directory changed since the last extract: ", path)
+			return false
+		}
+	}
+	return true
+}
+
+// localChanges compares the files of the mounts with the manifest and returns the paths of the changed files,
+// and whether the files that changed can be copied without extracting the stack image again
+func (manifest *extractManifest) localChanges(localFiles map[string]localFile) ([]string, bool) {
+	var changed []string
+	for path, file := range localFiles {
+		previous, found := manifest.Files[path]
+		if found && (previous == file.extractedFile || (previous.Mode.IsDir() && file.Mode.IsDir())) {
+			continue
+		}
+		if found && !previous.Local {
+			// a new local file hides a file of the stack, which a later removal must restore
+			return nil, false
+		}
+		changed = append(changed, path)
+	}
+	for path, previous := range manifest.Files {
+		if _, found := localFiles[path]; previous.Local && !found {
+			// the file of the stack it was hiding, if any, is only in the stack image
+			return nil, false
+		}
+	}
+	sort.Strings(changed)
+	return changed, true
+}
+
+// copyExtractedFile copies a file, a directory or a symbolic link with its mode
+func copyExtractedFile(source string, dest string, entry extractedFile) error {
+	if entry.Mode.IsDir() {
+		// a file or a symlink the directory replaces is removed first
+		if info, err := os.Lstat(dest); err == nil && !info.IsDir() {
+			if err = os.Remove(dest); err != nil {
+				return err
+			}
+		}
+		err := os.MkdirAll(dest, entry.Mode.Perm()|0700)
+		if err != nil {
+			return err
+		}
+		// MkdirAll keeps the mode of an existing directory
+		return os.Chmod(dest, entry.Mode.Perm()|0700)
+	}
+	err := os.MkdirAll(filepath.Dir(dest), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	if err = os.RemoveAll(dest); err != nil {
+		return err
+	}
+	if entry.Mode&os.ModeSymlink != 0 {
+		return os.Symlink(strings.TrimPrefix(entry.Hash, "link:"), dest)
+	}
+	content, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	destFile, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, entry.Mode.Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(destFile, content)
+	closeErr := destFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	// the mode the file is created with is masked by the umask
+	return os.Chmod(dest, entry.Mode.Perm())
+}
+
+// syncExtractDir makes the extract directory the same as the staging directory, copying only the files that changed,
+// and returns the content of the staging directory. previous is the content of the extract directory, if it is known.
+func syncExtractDir(stagingDir string, extractDir string, previous map[string]extractedFile) (map[string]extractedFile, error) {
+	staged, err := scanTree(stagingDir)
+	if err != nil {
+		return nil, errors.Errorf("Could not read the extracted files: %v", err)
+	}
+	if exists, _ := Exists(extractDir); !exists {
+		return staged, os.Rename(stagingDir, extractDir)
+	}
+	if previous == nil {
+		previous, err = scanTree(extractDir)
+		if err != nil {
+			return nil, errors.Errorf("Could not read the extract directory: %v", err)
+		}
+	}
+	var paths []string
+	for path := range staged {
+		paths = append(paths, path)
+	}
+	// parent directories sort before their content
+	sort.Strings(paths)
+	copied := 0
+	for _, path := range paths {
+		entry := staged[path]
+		if current, found := previous[path]; found && current.Mode == entry.Mode && current.Hash == entry.Hash {
+			continue
+		}
+		err = copyExtractedFile(filepath.Join(stagingDir, filepath.FromSlash(path)), filepath.Join(extractDir, filepath.FromSlash(path)), entry)
+		if err != nil {
+			return nil, errors.Errorf("Could not update %s in the extract directory: %v", path, err)
+		}
+		if !entry.Mode.IsDir() {
+			copied++
+		}
+	}
+	removed := 0
+	for path := range previous {
+		if _, found := staged[path]; !found {
+			// removing a directory removes its content, which is also gone from the staging directory
+			err = os.RemoveAll(filepath.Join(extractDir, filepath.FromSlash(path)))
+			if err != nil {
+				return nil, errors.Errorf("Could not remove %s from the extract directory: %v", path, err)
+			}
+			removed++
+		}
+	}
+	Info.logf("Updated the extract directory: %d changed files copied, %d files removed", copied, removed)
+	return staged, os.RemoveAll(stagingDir)
+}
@@ -0,0 +1,169 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd/cmdtest"
+)
+
+// writePreviousExtract writes the extract directory of a previous extract of the stack image, with the files
+// of the stack, and its manifest, so that the next extract copies the project files without running a container.
+// It returns the extract directory.
+func (project *testProject) writePreviousExtract(t *testing.T, stackImageID string, stackFiles map[string]string) string {
+	projectName := filepath.Base(project.dir)
+	extractDir := filepath.Join(project.home, "extract", projectName)
+	type manifestFile struct {
+		Mode uint32 `json:"mode"`
+		Size int64  `json:"size"`
+		Hash string `json:"hash,omitempty"`
+	}
+	manifestFiles := map[string]manifestFile{}
+	for path, content := range stackFiles {
+		file := filepath.Join(extractDir, filepath.FromSlash(path))
+		err := os.MkdirAll(filepath.Dir(file), os.ModePerm)
+		if err == nil {
+			err = ioutil.WriteFile(file, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash := sha256.Sum256([]byte(content))
+		manifestFiles[path] = manifestFile{Mode: uint32(info.Mode()), Size: info.Size(), Hash: hex.EncodeToString(hash[:])}
+	}
+	manifest, err := json.Marshal(map[string]interface{}{
+		"stackImageID": stackImageID,
+		"mounts":       []string{"-v", filepath.ToSlash(project.dir) + "/.:/project/user-app"},
+		"files":        manifestFiles,
+	})
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(project.home, "extract", projectName+".manifest.json"), manifest, 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return extractDir
+}
+
+func TestExtractIncremental(t *testing.T) {
+	project, cleanup := newTestProject(t, "incremental-project", "test/incremental-stack:0.1",
+		`{"Id": "sha256:1111", "Config": {"Env": ["APPSODY_MOUNTS=.:/project/user-app", "APPSODY_PROJECT_DIR=/project"]}}`)
+	defer cleanup()
+	project.writeFiles(t, map[string]string{"app.js": "console.log('v1')\n"})
+	extractDir := project.writePreviousExtract(t, "sha256:1111", map[string]string{"Dockerfile": "FROM scratch\n"})
+
+	// the project files are copied next to the files of the stack, without a container
+	args := project.appsodyArgs("extract")
+	output, err := cmdtest.RunAppsodyCmd(args, project.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "Copied 3 changed project files") {
+		t.Errorf("Expected the project directory, .appsody-config.yaml and app.js to be copied. CLI output:\n%s", output)
+	}
+
+	// only the changed file is copied, without a container
+	project.writeFiles(t, map[string]string{"app.js": "console.log('v2')\n"})
+	output, err = cmdtest.RunAppsodyCmd(args, project.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "Copied 1 changed project files") {
+		t.Errorf("Expected the changed app.js to be copied. CLI output:\n%s", output)
+	}
+	extracted, err := ioutil.ReadFile(filepath.Join(extractDir, "user-app", "app.js"))
+	if err != nil || string(extracted) != "console.log('v2')\n" {
+		t.Errorf("Expected the extracted app.js to be the changed one, it is %s %v", extracted, err)
+	}
+
+	output, err = cmdtest.RunAppsodyCmd(args, project.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "The stack image and the project files did not change since the last extract") {
+		t.Errorf("Expected the extract to be skipped. CLI output:\n%s", output)
+	}
+}
+
+func TestExtractStackImageChanged(t *testing.T) {
+	project, cleanup := newTestProject(t, "changed-stack-project", "test/changed-stack:0.1", defaultStackInspect)
+	defer cleanup()
+	project.mux.HandleFunc("/containers/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	extractDir := project.writePreviousExtract(t, "sha256:1111", map[string]string{
+		"Dockerfile":   "FROM scratch\n",
+		"config":       "a file the new stack replaces by a directory\n",
+		"lib/index.js": "v1\n",
+		"old.js":       "removed from the new stack\n",
+	})
+	err := os.Symlink("lib", filepath.Join(extractDir, "bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the container of the new stack image is copied to the staging directory by docker cp
+	restorePath := project.installFakeDocker(t, `if [ "$1" = cp ]; then
+  mkdir -p "$3/config" "$3/lib" "$3/bin"
+  printf 'FROM scratch\n' > "$3/Dockerfile"
+  printf '{}\n' > "$3/config/settings.json"
+  printf 'v2\n' > "$3/lib/index.js"
+  printf 'start\n' > "$3/bin/start.sh"
+  chmod 700 "$3/lib"
+fi
+exit 0
+`)
+	defer restorePath()
+
+	output, err := cmdtest.RunAppsodyCmd(project.appsodyArgs("extract"), project.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "Updated the extract directory: 3 changed files copied, 1 files removed") {
+		t.Errorf("Expected settings.json, index.js and start.sh to be copied, and old.js to be removed. CLI output:\n%s", output)
+	}
+	for path, content := range map[string]string{"Dockerfile": "FROM scratch\n", "config/settings.json": "{}\n", "lib/index.js": "v2\n", "bin/start.sh": "start\n"} {
+		extracted, err := ioutil.ReadFile(filepath.Join(extractDir, filepath.FromSlash(path)))
+		if err != nil || string(extracted) != content {
+			t.Errorf("Expected the extracted %s to be %q, it is %q %v", path, content, extracted, err)
+		}
+	}
+	if _, err = os.Lstat(filepath.Join(extractDir, "old.js")); !os.IsNotExist(err) {
+		t.Errorf("Expected old.js to be removed from the extract directory: %v", err)
+	}
+	if info, err := os.Lstat(filepath.Join(extractDir, "bin")); err != nil || !info.IsDir() {
+		t.Errorf("Expected the bin symlink to be replaced by a directory: %v %v", info, err)
+	}
+	if _, err = os.Lstat(filepath.Join(extractDir, "lib", "start.sh")); !os.IsNotExist(err) {
+		t.Errorf("Expected start.sh not to be copied through the replaced symlink: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(extractDir, "lib")); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("Expected the mode of the lib directory to be updated to 0700: %v %v", info, err)
+	}
+	if _, err = os.Stat(filepath.Join(project.home, "extract", ".changed-stack-project.staging")); !os.IsNotExist(err) {
+		t.Errorf("Expected the staging directory to be removed: %v", err)
+	}
+}
@@ -15,6 +15,7 @@ package cmd
 
 import (
 	"encoding/json"
+	"net/url"
 	"os/exec"
 	"runtime"
 	"strings"
@@ -40,6 +41,17 @@ type GitInfo struct {
 
 const trimChars = "' \r\n"
 
+// stripURLCredentials removes the user information, such as an access token, from a remote URL.
+// The user of an scp-like remote, such as git@github.com:org/repo.git, is not a credential and is kept.
+func stripURLCredentials(remoteURL string) string {
+	parsed, err := url.Parse(remoteURL)
+	if err != nil || parsed.User == nil || parsed.Host == "" {
+		return remoteURL
+	}
+	parsed.User = nil
+	return parsed.String()
+}
+
 func stringBefore(value string, searchValue string) string {
 	// Get substring before a string.
 
@@ -80,6 +92,17 @@ func stringBetween(value string, pre string, post string) string {
 	return value[positionBeginAdjusted:positionEnd]
 }
 
+// getProjectGitInfo returns the Git information of the project for the tags, labels and metadata of a build,
+// or nil when it is not available. git is only read, so it also runs with --dryrun
+func getProjectGitInfo() *GitInfo {
+	gitInfo, err := GetGitInfo(false)
+	if err != nil {
+		Debug.log("The project Git information is not available: ", err)
+		return nil
+	}
+	return &gitInfo
+}
+
 //RunGitFindBranc issues git status
 func GetGitInfo(dryrun bool) (GitInfo, error) {
 	var gitInfo GitInfo
@@ -137,16 +160,16 @@ func GetGitInfo(dryrun bool) (GitInfo, error) {
 	if gitInfo.Upstream != "" {
 		gitInfo.RemoteURL, gitErr = RunGitConfigLocalRemoteOriginURL(gitInfo.Upstream, dryrun)
 		if gitErr != nil {
-			Info.Logf("Could not construct repository URL %v", gitErr)
+			Debug.logf("Could not construct repository URL %v", gitErr)
 		}
 
 	} else {
-		Info.log("Unable to determine origin to compute repository URL")
+		Debug.log("Unable to determine origin to compute repository URL")
 	}
 
 	gitInfo.Commit, gitErr = RunGitGetLastCommit(gitInfo.RemoteURL, dryrun)
 	if gitErr != nil {
-		Info.log("Received error getting current commit: ", gitErr)
+		Debug.log("Received error getting current commit: ", gitErr)
 
 	}
 
@@ -155,7 +178,7 @@ func GetGitInfo(dryrun bool) (GitInfo, error) {
 
 //RunGitConfigLocalRemoteOriginURL
 func RunGitConfigLocalRemoteOriginURL(upstream string, dryrun bool) (string, error) {
-	Info.log("Attempting to perform git config --local remote.<origin>.url  ...")
+	Debug.log("Attempting to perform git config --local remote.<origin>.url  ...")
 
 	upstreamStart := strings.Split(upstream, "/")[0]
 	kargs := []string{"config", "--local", "remote." + upstreamStart + ".url"}
@@ -166,7 +189,6 @@ func RunGitConfigLocalRemoteOriginURL(upstream string, dryrun bool) (string, err
 func RunGitGetLastCommit(URL string, dryrun bool) (CommitInfo, error) {
 	//git log -n 1 --pretty=format:"{"author":"%cn","sha":"%h","date":"%cd”}”
 	kargs := []string{"log", "-n", "1", "--pretty=format:'{\"author\":\"%cn\",\"sha\":\"%H\",\"date\":\"%cd\"}'"}
-	kargs = append(kargs)
 	var commitInfo CommitInfo
 	commitStringInfo, gitErr := RunGit(kargs, dryrun)
 	if gitErr != nil {
@@ -183,10 +205,19 @@ func RunGitGetLastCommit(URL string, dryrun bool) (CommitInfo, error) {
 
 }
 
+//RunGitDescribe issues git describe, which names the commit after the most recent tag
+func RunGitDescribe(dryrun bool) (string, error) {
+	kargs := []string{"describe", "--tags", "--always", "--dirty"}
+	description, gitErr := RunGit(kargs, dryrun)
+	if gitErr != nil {
+		return "", gitErr
+	}
+	return strings.Trim(description, trimChars), nil
+}
+
 //RunGitVersion
 func RunGitVersion(dryrun bool) (string, error) {
 	kargs := []string{"version"}
-	kargs = append(kargs)
 	versionInfo, gitErr := RunGit(kargs, dryrun)
 	if gitErr != nil {
 		return "", gitErr
@@ -201,7 +232,7 @@ func RunGit(kargs []string, dryrun bool) (string, error) {
 		Info.log("Dry run - skipping execution of: ", kcmd, " ", strings.Join(kargs, " "))
 		return "", nil
 	}
-	Info.log("Running git command: ", kcmd, " ", strings.Join(kargs, " "))
+	Debug.log("Running git command: ", kcmd, " ", strings.Join(kargs, " "))
 	execCmd := exec.Command(kcmd, kargs...)
 	kout, kerr := execCmd.Output()
 
@@ -0,0 +1,97 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd"
+)
+
+// listenOnFreePort returns a host port that is in use until the returned listener is closed
+func listenOnFreePort(t *testing.T) (string, net.Listener) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port), listener
+}
+
+// freePort returns a host port that is free when the test starts
+func freePort(t *testing.T) string {
+	port, listener := listenOnFreePort(t)
+	listener.Close()
+	return port
+}
+
+func TestResolveHostPortConflicts(t *testing.T) {
+	inUse, listener := listenOnFreePort(t)
+	defer listener.Close()
+	free := freePort(t)
+	otherFree := freePort(t)
+
+	var tests = []struct {
+		name        string
+		mappings    []string
+		numExplicit int
+		autoPorts   bool
+		// the expected mappings, an empty host port is any other free port
+		expected []string
+		err      string
+	}{
+		{name: "free ports", mappings: []string{free + ":3000", otherFree + ":" + otherFree}, numExplicit: 1, expected: []string{free + ":3000", otherFree + ":" + otherFree}},
+		{name: "explicit port in use", mappings: []string{inUse + ":3000"}, numExplicit: 1, autoPorts: true, err: "Host port " + inUse + ", requested with --publish " + inUse + ":3000, is already in use"},
+		{name: "explicit port published twice", mappings: []string{free + ":3000", free + ":4000"}, numExplicit: 2, err: "Host port " + free + ", requested with --publish " + free + ":4000, is already published by --publish " + free + ":3000"},
+		{name: "exposed port in use", mappings: []string{inUse + ":" + inUse}, err: "Host port " + inUse + ", needed to publish the stack's container port " + inUse + ", is already in use"},
+		{name: "exposed port in use, auto-assigned", mappings: []string{free + ":3000", inUse + ":" + inUse}, numExplicit: 1, autoPorts: true, expected: []string{free + ":3000", ":" + inUse}},
+		{name: "exposed port published by --publish", mappings: []string{free + ":3000", free + ":" + free}, numExplicit: 1, err: "Host port " + free + ", needed to publish the stack's container port " + free + ", is already published as " + free + ":3000"},
+		{name: "exposed port published by --publish, auto-assigned", mappings: []string{free + ":3000", free + ":" + free}, numExplicit: 1, autoPorts: true, expected: []string{free + ":3000", ":" + free}},
+		{name: "exposed ports published twice, auto-assigned", mappings: []string{inUse + ":8080", inUse + ":8443"}, autoPorts: true, expected: []string{":8080", ":8443"}},
+	}
+	for _, test := range tests {
+		mappings, err := cmd.ResolveHostPortConflicts(test.mappings, test.numExplicit, test.autoPorts)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected the error %s, got %v", test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if len(mappings) != len(test.expected) {
+			t.Errorf("%s: expected the mappings %v, got %v", test.name, test.expected, mappings)
+			continue
+		}
+		hostPorts := make(map[string]bool)
+		for i, mapping := range mappings {
+			hostPort := strings.Split(mapping, ":")[0]
+			if hostPorts[hostPort] {
+				t.Errorf("%s: host port %s is published twice in %v", test.name, hostPort, mappings)
+			}
+			hostPorts[hostPort] = true
+			if strings.HasPrefix(test.expected[i], ":") {
+				if !strings.HasSuffix(mapping, test.expected[i]) || hostPort == inUse || hostPort == "" {
+					t.Errorf("%s: expected container port %s to be published on another free host port, got %s", test.name, test.expected[i][1:], mapping)
+				}
+			} else if mapping != test.expected[i] {
+				t.Errorf("%s: expected the mapping %s, got %s", test.name, test.expected[i], mapping)
+			}
+		}
+	}
+}
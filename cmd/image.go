@@ -0,0 +1,411 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// The formats appsody build --output writes the images in
+const (
+	outputDockerArchive = "docker-archive"
+	outputOCI           = "oci"
+)
+
+// buildOutput is where appsody build writes the images, besides the local images of the engine
+type buildOutput struct {
+	outputType string
+	dest       string
+}
+
+// parseBuildOutput parses the type=<docker-archive|oci>,dest=<path> value of --output
+func parseBuildOutput(output string) (*buildOutput, error) {
+	if output == "" {
+		return nil, nil
+	}
+	parsed := &buildOutput{}
+	for _, field := range strings.Split(output, ",") {
+		keyValue := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(keyValue) != 2 {
+			return nil, errors.Errorf("Invalid --output %s, use type=docker-archive,dest=<file> or type=oci,dest=<directory>", output)
+		}
+		switch keyValue[0] {
+		case "type":
+			parsed.outputType = keyValue[1]
+		case "dest":
+			parsed.dest = keyValue[1]
+		default:
+			return nil, errors.Errorf("Unsupported --output option %s, the options are type and dest", keyValue[0])
+		}
+	}
+	if parsed.outputType != outputDockerArchive && parsed.outputType != outputOCI {
+		return nil, errors.Errorf("Unsupported --output type %s, use %s or %s", parsed.outputType, outputDockerArchive, outputOCI)
+	}
+	if parsed.dest == "" {
+		return nil, errors.Errorf("The --output option needs a destination, for example type=%s,dest=app.tar", parsed.outputType)
+	}
+	dest, err := filepath.Abs(parsed.dest)
+	if err != nil {
+		return nil, err
+	}
+	parsed.dest = dest
+	return parsed, nil
+}
+
+// loadedImage matches the lines of docker and podman load
+var loadedImage = regexp.MustCompile(`Loaded image(?:\(s\))?(?: ID)?: *(\S+)`)
+
+// loadedImages returns the names, or the IDs, of the images in the output of a load
+func loadedImages(output string) []string {
+	var loaded []string
+	for _, match := range loadedImage.FindAllStringSubmatch(output, -1) {
+		// podman lists the images of an archive on one line
+		loaded = append(loaded, strings.Split(match[1], ",")...)
+	}
+	return uniqueStrings(loaded)
+}
+
+// archiveDirectory writes the content of the directory to a temporary tar file, which the caller removes
+func archiveDirectory(dir string) (string, error) {
+	archive, err := ioutil.TempFile("", "appsody-image-*.tar")
+	if err != nil {
+		return "", err
+	}
+	tarWriter := tar.NewWriter(archive)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		relative, err := filepath.Rel(dir, path)
+		if err != nil || relative == "." {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relative)
+		err = tarWriter.WriteHeader(header)
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		content, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer content.Close()
+		_, err = io.Copy(tarWriter, content)
+		return err
+	})
+	if err == nil {
+		err = tarWriter.Close()
+	}
+	closeErr := archive.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(archive.Name())
+		return "", errors.Errorf("Could not archive %s: %v", dir, err)
+	}
+	return archive.Name(), nil
+}
+
+// The media types of the OCI image layout written from a docker save archive
+const (
+	ociIndexMediaType    = "application/vnd.oci.image.index.v1+json"
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ociConfigMediaType   = "application/vnd.oci.image.config.v1+json"
+	ociLayerMediaType    = "application/vnd.oci.image.layer.v1.tar"
+)
+
+// dockerArchiveManifest is an image of the manifest.json of a docker save archive
+type dockerArchiveManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// ociDescriptor points to a blob of an OCI image layout
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+// writeOCILayout writes the images of a docker save archive to an OCI image layout directory. The configuration
+// blob of an image is the one of the archive, so the image keeps its ID. The layout also has the manifest.json of
+// the archive, with the paths of the blobs, for docker versions that cannot load an OCI layout.
+func writeOCILayout(archive io.Reader, dest string) error {
+	blobsDir := filepath.Join(dest, "blobs", "sha256")
+	err := os.MkdirAll(blobsDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	// the files of the archive, by path, and the symbolic links of the layers docker save writes once
+	blobs := map[string]ociDescriptor{}
+	links := map[string]string{}
+	var manifests []dockerArchiveManifest
+	files := tar.NewReader(archive)
+	for {
+		header, err := files.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Errorf("Could not read the docker archive: %v", err)
+		}
+		name := path.Clean(header.Name)
+		switch {
+		case header.Typeflag == tar.TypeSymlink:
+			links[name] = path.Join(path.Dir(name), header.Linkname)
+		case header.Typeflag != tar.TypeReg:
+		case name == "manifest.json":
+			err = json.NewDecoder(files).Decode(&manifests)
+			if err != nil {
+				return errors.Errorf("Could not read the manifest.json of the docker archive: %v", err)
+			}
+		case name == "repositories" || name == "index.json" || name == "oci-layout":
+		default:
+			blobs[name], err = writeBlob(blobsDir, files)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for link, target := range links {
+		if blob, found := blobs[target]; found {
+			blobs[link] = blob
+		}
+	}
+	if len(manifests) == 0 {
+		return errors.New("The docker archive has no image")
+	}
+
+	index := ociIndex{SchemaVersion: 2, MediaType: ociIndexMediaType}
+	layoutManifests := []dockerArchiveManifest{}
+	referenced := map[string]bool{}
+	for _, image := range manifests {
+		config, found := blobs[path.Clean(image.Config)]
+		if !found {
+			return errors.Errorf("The docker archive has no configuration %s", image.Config)
+		}
+		config.MediaType = ociConfigMediaType
+		manifest := ociManifest{SchemaVersion: 2, MediaType: ociManifestMediaType, Config: config, Layers: []ociDescriptor{}}
+		layoutManifest := dockerArchiveManifest{Config: blobPath(config), RepoTags: image.RepoTags}
+		for _, layer := range image.Layers {
+			blob, found := blobs[path.Clean(layer)]
+			if !found {
+				return errors.Errorf("The docker archive has no layer %s", layer)
+			}
+			manifest.Layers = append(manifest.Layers, blob)
+			layoutManifest.Layers = append(layoutManifest.Layers, blobPath(blob))
+			referenced[blob.Digest] = true
+		}
+		referenced[config.Digest] = true
+		manifestBytes, err := json.Marshal(manifest)
+		if err != nil {
+			return err
+		}
+		manifestBlob, err := writeBlob(blobsDir, bytes.NewReader(manifestBytes))
+		if err != nil {
+			return err
+		}
+		manifestBlob.MediaType = ociManifestMediaType
+		referenced[manifestBlob.Digest] = true
+		if len(image.RepoTags) == 0 {
+			index.Manifests = append(index.Manifests, manifestBlob)
+		}
+		for _, tag := range image.RepoTags {
+			tagged := manifestBlob
+			_, ref := splitImageTag(tag)
+			tagged.Annotations = map[string]string{"io.containerd.image.name": tag, "org.opencontainers.image.ref.name": ref}
+			index.Manifests = append(index.Manifests, tagged)
+		}
+		layoutManifests = append(layoutManifests, layoutManifest)
+	}
+	// the other files of the archive, such as the json of the layers of older docker versions, are not blobs of the images
+	for _, blob := range blobs {
+		if !referenced[blob.Digest] {
+			os.Remove(filepath.Join(dest, filepath.FromSlash(blobPath(blob))))
+		}
+	}
+
+	for file, content := range map[string]interface{}{"index.json": index, "manifest.json": layoutManifests, "oci-layout": map[string]string{"imageLayoutVersion": "1.0.0"}} {
+		contentBytes, err := json.Marshal(content)
+		if err == nil {
+			err = ioutil.WriteFile(filepath.Join(dest, file), contentBytes, 0644)
+		}
+		if err != nil {
+			return errors.Errorf("Could not write the %s of the OCI image layout: %v", file, err)
+		}
+	}
+	return nil
+}
+
+// writeBlob writes the content to the blobs directory, named after its digest, and returns its descriptor
+// with the media type of a layer, compressed or not
+func writeBlob(blobsDir string, content io.Reader) (ociDescriptor, error) {
+	var blob ociDescriptor
+	file, err := ioutil.TempFile(blobsDir, ".blob-*")
+	if err != nil {
+		return blob, err
+	}
+	defer os.Remove(file.Name())
+	reader := bufio.NewReader(content)
+	magic, _ := reader.Peek(4)
+	blob.MediaType = ociLayerMediaType
+	if bytes.HasPrefix(magic, []byte{0x1f, 0x8b}) {
+		blob.MediaType += "+gzip"
+	} else if bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}) {
+		blob.MediaType += "+zstd"
+	}
+	hash := sha256.New()
+	blob.Size, err = io.Copy(io.MultiWriter(file, hash), reader)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return blob, errors.Errorf("Could not write a blob of the OCI image layout: %v", err)
+	}
+	blob.Digest = fmt.Sprintf("sha256:%x", hash.Sum(nil))
+	return blob, os.Rename(file.Name(), filepath.Join(blobsDir, strings.TrimPrefix(blob.Digest, "sha256:")))
+}
+
+// blobPath returns the path of the blob in the OCI image layout
+func blobPath(blob ociDescriptor) string {
+	return "blobs/sha256/" + strings.TrimPrefix(blob.Digest, "sha256:")
+}
+
+type imageLoadCommandConfig struct {
+	*RootCommandConfig
+	tag string
+}
+
+func newImageCmd(rootConfig *RootCommandConfig) *cobra.Command {
+	var imageCmd = &cobra.Command{
+		Use:   "image",
+		Short: "Manage the images of your Appsody project",
+		Long:  `Manage the images appsody build creates, for example to load the images exported with appsody build --output.`,
+	}
+	imageCmd.AddCommand(newImageLoadCmd(rootConfig))
+	return imageCmd
+}
+
+func newImageLoadCmd(rootConfig *RootCommandConfig) *cobra.Command {
+	config := &imageLoadCommandConfig{RootCommandConfig: rootConfig}
+	var imageLoadCmd = &cobra.Command{
+		Use:   "load <archive or directory>",
+		Short: "Load an image exported by appsody build --output",
+		Long: `Load the images of a docker-archive file or an OCI image layout directory written by appsody build --output.
+
+The images keep the names stored in the archive. Use --tag to tag the loaded image with another name. An image the archive does not name is tagged with the image name of the project: the name of the project directory in the registry of .appsody-config.yaml.`,
+		Example: `  appsody build --output type=docker-archive,dest=app.tar
+  appsody image load app.tar`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return imageLoad(config, args[0])
+		},
+	}
+	imageLoadCmd.PersistentFlags().StringVarP(&config.tag, "tag", "t", "", "Docker image name and optionally a tag in the 'name:tag' format to tag the loaded image with")
+	return imageLoadCmd
+}
+
+func imageLoad(config *imageLoadCommandConfig, source string) error {
+	if _, err := os.Stat(source); err != nil {
+		return errors.Errorf("Could not read the images to load: %v", err)
+	}
+	engine, err := getContainerEngine(config.RootCommandConfig)
+	if err != nil {
+		return err
+	}
+	Info.log("Loading the images of ", source)
+	loaded, err := engine.Load(source, config.Dryrun)
+	if err != nil {
+		return err
+	}
+	loadedImage := "<loaded image>"
+	if !config.Dryrun {
+		if len(loaded) == 0 {
+			return errors.Errorf("No image was loaded from %s", source)
+		}
+		if len(loaded) > 1 && config.tag != "" {
+			Warning.log(source, " holds several images, tagging the first one: ", strings.Join(loaded, ", "))
+		}
+		loadedImage = loaded[0]
+	}
+	var tag string
+	if config.tag != "" {
+		tag = config.tag
+	} else if strings.HasPrefix(loadedImage, "sha256:") {
+		// the archive does not name the image, it gets the name of the project
+		projectName, err := getProjectName(config.RootCommandConfig)
+		if err != nil {
+			return errors.Errorf("The loaded image %s has no name, and the image name of the project could not be found, use --tag to name it: %v", loadedImage, err)
+		}
+		projectConfig, err := getProjectConfig(config.RootCommandConfig)
+		if err != nil {
+			return errors.Errorf("The loaded image %s has no name, and the image name of the project could not be found, use --tag to name it: %v", loadedImage, err)
+		}
+		tag = inRegistry(projectName, projectConfig.Registry)
+	}
+	if tag == "" {
+		// the images keep the names stored in the archive
+		if !config.Dryrun {
+			invalidateImageCache(config.RootCommandConfig, loaded...)
+			Info.log("Loaded ", strings.Join(loaded, ", "))
+		}
+		return nil
+	}
+	err = engine.Tag(loadedImage, tag, config.Dryrun)
+	if err != nil {
+		return errors.Errorf("Could not tag the loaded image %s as %s: %v", loadedImage, tag, err)
+	}
+	if !config.Dryrun {
+		invalidateImageCache(config.RootCommandConfig, append(loaded, tag)...)
+		Info.log("Loaded ", loadedImage, " as ", tag)
+	}
+	return nil
+}
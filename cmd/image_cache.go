@@ -0,0 +1,109 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// imageCache holds the inspection results of stack images across CLI invocations, by image reference.
+// A result is only used for the image ID it was inspected from, so an image pulled or built outside appsody
+// is inspected again, and appsody drops the result of an image when it pulls, builds or loads it.
+type imageCache struct {
+	Images map[string]cachedImage `json:"images"`
+}
+
+// cachedImage is the inspection result of an image, with the ID of the image it was inspected from
+type cachedImage struct {
+	ImageID string        `json:"imageID"`
+	Inspect *ImageInspect `json:"inspect"`
+}
+
+// getImageCacheFile returns the cache file of the engine. Engines that share an image store
+// share the cache.
+func getImageCacheFile(config *RootCommandConfig, engine ContainerEngine) string {
+	return filepath.Join(getHome(config), "cache", "images-"+engine.Command()+".json")
+}
+
+// loadImageCache reads the cache file, a missing or unreadable file gives an empty cache
+func loadImageCache(cacheFile string) *imageCache {
+	cache := &imageCache{Images: map[string]cachedImage{}}
+	cacheBytes, err := ioutil.ReadFile(cacheFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			Debug.log("Could not read the image cache ", cacheFile, ": ", err)
+		}
+		return cache
+	}
+	err = json.Unmarshal(cacheBytes, cache)
+	if err != nil {
+		Debug.log("Ignoring the image cache ", cacheFile, ": ", err)
+		return &imageCache{Images: map[string]cachedImage{}}
+	}
+	if cache.Images == nil {
+		cache.Images = map[string]cachedImage{}
+	}
+	return cache
+}
+
+// lookup returns the cached inspection result of the image, if the image still has the ID it was inspected from
+func (cache *imageCache) lookup(image string, imageID string) *ImageInspect {
+	cached, found := cache.Images[image]
+	if !found || imageID == "" || cached.ImageID != imageID {
+		return nil
+	}
+	return cached.Inspect
+}
+
+// store records the inspection result of the image
+func (cache *imageCache) store(image string, inspect *ImageInspect) {
+	cache.Images[image] = cachedImage{ImageID: inspect.ID, Inspect: inspect}
+}
+
+func (cache *imageCache) save(cacheFile string) error {
+	cacheBytes, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(cacheFile, cacheBytes, 0644)
+}
+
+// invalidateImageCache drops the cached inspection results of the images, after appsody pulled, built or loaded them
+func invalidateImageCache(config *RootCommandConfig, images ...string) {
+	engine, err := getContainerEngine(config)
+	if err != nil {
+		return
+	}
+	cacheFile := getImageCacheFile(config, engine)
+	cache := loadImageCache(cacheFile)
+	changed := false
+	for _, image := range images {
+		if _, found := cache.Images[image]; found {
+			delete(cache.Images, image)
+			changed = true
+		}
+		delete(config.stackImages, image)
+	}
+	if !changed {
+		return
+	}
+	err = cache.save(cacheFile)
+	if err != nil {
+		Warning.log("Could not save the image cache: ", err)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/appsody/appsody/cmd"
+	"github.com/spf13/viper"
+)
+
+func TestImageCache(t *testing.T) {
+	imageID := "sha256:aaaa"
+	greeting := "hello"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/images/test/stack:0.1/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"Id": "%s", "Config": {"Env": ["GREETING=%s"]}}`, imageID, greeting)
+	})
+	mux.HandleFunc("/images/create", func(w http.ResponseWriter, r *http.Request) {
+		imageID = "sha256:bbbb"
+		greeting = "pulled"
+		_, _ = w.Write([]byte(`{"status": "Downloaded newer image for test/stack:0.1"}`))
+	})
+	dockerHost, cleanup := startFakeDockerDaemon(t, mux)
+	defer cleanup()
+
+	home, err := ioutil.TempDir("", "appsody-image-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	os.Setenv("DOCKER_HOST", dockerHost)
+	defer os.Unsetenv("DOCKER_HOST")
+
+	// each call simulates a separate CLI invocation
+	getGreeting := func(pullPolicy string) string {
+		cliConfig := viper.New()
+		cliConfig.Set("home", home)
+		config := &cmd.RootCommandConfig{
+			Engine:        "docker-api",
+			CliConfig:     cliConfig,
+			PullPolicy:    pullPolicy,
+			ProjectConfig: &cmd.ProjectConfig{Platform: "test/stack:0.1"},
+		}
+		value, err := cmd.GetEnvVar("GREETING", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+
+	if value := getGreeting("missing"); value != "hello" {
+		t.Errorf("Expected GREETING to be hello but found %s", value)
+	}
+	// the image did not change, so the cached configuration is used
+	greeting = "changed"
+	if value := getGreeting("missing"); value != "hello" {
+		t.Errorf("Expected the cached GREETING hello but found %s", value)
+	}
+	// the image is built again outside appsody, which changes its ID
+	imageID = "sha256:cccc"
+	greeting = "rebuilt"
+	if value := getGreeting("missing"); value != "rebuilt" {
+		t.Errorf("Expected GREETING of the rebuilt image to be rebuilt but found %s", value)
+	}
+	// the image is pulled again, which drops its cached configuration
+	if value := getGreeting("always"); value != "pulled" {
+		t.Errorf("Expected GREETING of the pulled image to be pulled but found %s", value)
+	}
+	greeting = "changed again"
+	if value := getGreeting("missing"); value != "pulled" {
+		t.Errorf("Expected the cached GREETING of the pulled image but found %s", value)
+	}
+}
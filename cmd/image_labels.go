@@ -0,0 +1,115 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The OCI annotations appsody build sets on the images, see
+// https://github.com/opencontainers/image-spec/blob/master/annotations.md
+const (
+	ociCreatedLabel  = "org.opencontainers.image.created"
+	ociSourceLabel   = "org.opencontainers.image.source"
+	ociRevisionLabel = "org.opencontainers.image.revision"
+	ociVersionLabel  = "org.opencontainers.image.version"
+	ociTitleLabel    = "org.opencontainers.image.title"
+)
+
+// The labels that identify the stack an image was built from. Stack images may set the id and version labels themselves.
+const (
+	stackIDLabel      = "dev.appsody.stack.id"
+	stackVersionLabel = "dev.appsody.stack.version"
+	stackImageLabel   = "dev.appsody.stack.image"
+)
+
+// buildWarningLabel marks images that cannot be traced back to a commit
+const buildWarningLabel = "dev.appsody.build.warning"
+
+const dirtyTreeWarning = "Built from a Git working tree with uncommitted changes"
+
+// getImageLabels returns the labels of the image built from the project: the OCI annotations with the
+// Git information of the project, when it is a Git repository, and the stack the image was built from
+func getImageLabels(config *RootCommandConfig, gitInfo *GitInfo, buildImage string) (map[string]string, error) {
+	projectName, err := getProjectName(config)
+	if err != nil {
+		return nil, err
+	}
+	labels := map[string]string{
+		ociCreatedLabel: time.Now().UTC().Format(time.RFC3339),
+		ociTitleLabel:   projectName,
+	}
+	if _, tag := splitImageTag(buildImage); tag != "latest" {
+		labels[ociVersionLabel] = tag
+	}
+
+	projectConfig, err := getProjectConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	stackRepository, stackTag := splitImageTag(projectConfig.Platform)
+	labels[stackImageLabel] = projectConfig.Platform
+	labels[stackIDLabel] = path.Base(stackRepository)
+	labels[stackVersionLabel] = stackTag
+	stackImage, err := inspectStackImage(config)
+	if err != nil {
+		Warning.log("Could not read the labels of the stack image: ", err)
+	} else {
+		for _, label := range []string{stackIDLabel, stackVersionLabel} {
+			if value := stackImage.Config.Labels[label]; value != "" {
+				labels[label] = value
+			}
+		}
+	}
+
+	if gitInfo == nil {
+		Info.log("The image will not have Git labels, the project Git information is not available")
+		return labels, nil
+	}
+	remoteURL := strings.TrimSpace(gitInfo.RemoteURL)
+	if remoteURL == "" {
+		// without an upstream branch, for example on a detached HEAD in CI, origin is the likely source
+		remoteURL, _ = RunGitConfigLocalRemoteOriginURL("origin", false)
+		remoteURL = strings.TrimSpace(remoteURL)
+	}
+	if remoteURL != "" {
+		labels[ociSourceLabel] = stripURLCredentials(remoteURL)
+	}
+	if gitInfo.Commit.SHA != "" {
+		labels[ociRevisionLabel] = gitInfo.Commit.SHA
+	}
+	if gitInfo.ChangesMade {
+		Warning.log(dirtyTreeWarning, ", the ", ociRevisionLabel, " label does not identify the source of the image")
+		labels[buildWarningLabel] = dirtyTreeWarning
+	}
+	return labels, nil
+}
+
+// labelArgs returns the --label options of the labels, sorted by name
+func labelArgs(labels map[string]string) []string {
+	var names []string
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var args []string
+	for _, name := range names {
+		args = append(args, "--label", name+"="+labels[name])
+	}
+	return args
+}
@@ -0,0 +1,229 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd/cmdtest"
+)
+
+func TestBuildOutput(t *testing.T) {
+	project, cleanup := newTestProject(t, "output-project", "test/output-stack:0.1", "")
+	defer cleanup()
+
+	archive := filepath.Join(project.home, "app.tar")
+	output, err := cmdtest.RunAppsodyCmd(project.appsodyArgs("build", "--dryrun", "--output", "type=docker-archive,dest="+archive), project.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Dry run - skipping export of the images to " + archive
+	if !strings.Contains(output, expected) {
+		t.Errorf("Expected %s. CLI output:\n%s", expected, output)
+	}
+
+	output, err = cmdtest.RunAppsodyCmdExec(project.appsodyArgs("build", "--dryrun", "--output", "type=zip,dest="+archive), project.dir)
+	if err == nil {
+		t.Fatalf("Expected the build with an unsupported --output type to fail. CLI output:\n%s", output)
+	}
+	expected = "Unsupported --output type zip"
+	if !strings.Contains(output, expected) {
+		t.Errorf("Expected %s. CLI output:\n%s", expected, output)
+	}
+}
+
+func TestBuildOutputOCI(t *testing.T) {
+	project, cleanup := newTestProject(t, "oci-project", "test/oci-stack:0.1", "")
+	defer cleanup()
+	project.writePreviousExtract(t, "sha256:9abc", map[string]string{"Dockerfile": "FROM scratch\n"})
+	restorePath := project.installFakeDocker(t, "exit 0\n")
+	defer restorePath()
+	// the docker save archive of the built image, the ID of an image is the digest of its configuration
+	config := `{"architecture": "amd64", "os": "linux", "rootfs": {"type": "layers", "diff_ids": []}}`
+	imageID := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(config)))
+	layer := "the layer of the image"
+	layerDigest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(layer)))
+	var archive bytes.Buffer
+	archiveWriter := tar.NewWriter(&archive)
+	for _, file := range []struct{ name, content string }{
+		{"manifest.json", `[{"Config": "` + strings.TrimPrefix(imageID, "sha256:") + `.json", "RepoTags": ["oci-project:latest"], "Layers": ["5678/layer.tar"]}]`},
+		{strings.TrimPrefix(imageID, "sha256:") + ".json", config},
+		{"5678/layer.tar", layer},
+		{"5678/json", `{"id": "5678"}`},
+		{"repositories", `{"oci-project": {"latest": "5678"}}`},
+	} {
+		err := archiveWriter.WriteHeader(&tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.content)), Typeflag: tar.TypeReg})
+		if err == nil {
+			_, err = archiveWriter.Write([]byte(file.content))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archiveWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	project.mux.HandleFunc("/images/get", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(archive.Bytes())
+	})
+	project.mux.HandleFunc("/images/oci-project/json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Id": "` + imageID + `"}`))
+	})
+
+	layoutDir := filepath.Join(project.home, "layout")
+	output, err := cmdtest.RunAppsodyCmd(project.appsodyArgs("build", "--output", "type=oci,dest="+layoutDir), project.dir)
+	if err != nil {
+		t.Fatalf("%v. CLI output:\n%s", err, output)
+	}
+	expected := "Exported docker image oci-project to " + layoutDir
+	if !strings.Contains(output, expected) {
+		t.Errorf("Expected %s. CLI output:\n%s", expected, output)
+	}
+	// the layout has the image that was built, named like the image
+	var index struct {
+		Manifests []struct {
+			Digest      string            `json:"digest"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"manifests"`
+	}
+	readJSONFile(t, filepath.Join(layoutDir, "index.json"), &index)
+	if len(index.Manifests) != 1 || index.Manifests[0].Annotations["org.opencontainers.image.ref.name"] != "latest" || index.Manifests[0].Annotations["io.containerd.image.name"] != "oci-project:latest" {
+		t.Fatalf("Expected the index of the layout to have the manifest of oci-project:latest, but got %+v", index)
+	}
+	var manifest struct {
+		Config struct {
+			MediaType string `json:"mediaType"`
+			Digest    string `json:"digest"`
+		} `json:"config"`
+		Layers []struct {
+			MediaType string `json:"mediaType"`
+			Digest    string `json:"digest"`
+		} `json:"layers"`
+	}
+	readJSONFile(t, filepath.Join(layoutDir, "blobs", "sha256", strings.TrimPrefix(index.Manifests[0].Digest, "sha256:")), &manifest)
+	if manifest.Config.Digest != imageID || manifest.Config.MediaType != "application/vnd.oci.image.config.v1+json" {
+		t.Errorf("Expected the configuration of the built image %s in the layout, but got %+v", imageID, manifest.Config)
+	}
+	if len(manifest.Layers) != 1 || manifest.Layers[0].Digest != layerDigest || manifest.Layers[0].MediaType != "application/vnd.oci.image.layer.v1.tar" {
+		t.Errorf("Expected the layer %s in the layout, but got %+v", layerDigest, manifest.Layers)
+	}
+	blobs, err := ioutil.ReadDir(filepath.Join(layoutDir, "blobs", "sha256"))
+	if err != nil || len(blobs) != 3 {
+		t.Errorf("Expected the manifest, configuration and layer blobs in the layout, but got %d blobs %v", len(blobs), err)
+	}
+	for _, file := range []string{"oci-layout", "manifest.json"} {
+		if _, err := os.Stat(filepath.Join(layoutDir, file)); err != nil {
+			t.Errorf("Expected the %s of the layout: %v", file, err)
+		}
+	}
+}
+
+// readJSONFile decodes the JSON file into value
+func readJSONFile(t *testing.T, file string, value interface{}) {
+	content, err := ioutil.ReadFile(file)
+	if err == nil {
+		err = json.Unmarshal(content, value)
+	}
+	if err != nil {
+		t.Fatalf("Could not read %s: %v", file, err)
+	}
+}
+
+func TestImageLoad(t *testing.T) {
+	project, cleanup := newTestProject(t, "load-project", "test/load-stack:0.1", "")
+	defer cleanup()
+	project.writeFiles(t, map[string]string{".appsody-config.yaml": "stack: test/load-stack:0.1\nregistry: registry.example.com\n"})
+	// an OCI image layout directory, which is sent to the daemon as an archive
+	layoutDir := filepath.Join(project.home, "layout")
+	err := os.MkdirAll(filepath.Join(layoutDir, "blobs", "sha256"), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(layoutDir, "oci-layout"), []byte(`{"imageLayoutVersion": "1.0.0"}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var loadedFiles []string
+	var loadedStream string
+	project.mux.HandleFunc("/images/load", func(w http.ResponseWriter, r *http.Request) {
+		loadedFiles = nil
+		archive := tar.NewReader(r.Body)
+		for {
+			header, err := archive.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			loadedFiles = append(loadedFiles, header.Name)
+		}
+		_, _ = w.Write([]byte(`{"stream":"` + loadedStream + `\n"}`))
+	})
+	var tagged []string
+	project.mux.HandleFunc("/images/", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/tag") {
+			http.NotFound(w, r)
+			return
+		}
+		tagged = append(tagged, strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/images/"), "/tag")+" "+r.URL.RawQuery)
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	var tests = []struct {
+		testName string
+		args     []string
+		// the images the daemon loads
+		loaded         string
+		expectedTag    string
+		expectedOutput string
+	}{
+		{"named image", nil, "Loaded image: load-project:exported", "", "Loaded load-project:exported"},
+		{"tag", []string{"--tag", "other/app:1.0"}, "Loaded image: load-project:exported", "load-project:exported repo=other%2Fapp&tag=1.0", "Loaded load-project:exported as other/app:1.0"},
+		{"unnamed image", nil, "Loaded image ID: sha256:2222", "sha256:2222 repo=registry.example.com%2Fload-project&tag=latest", "Loaded sha256:2222 as registry.example.com/load-project"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			loadedStream = tt.loaded
+			tagged = nil
+			args := append([]string{"image", "load", layoutDir, "--config", project.configFile, "--engine", "docker-api"}, tt.args...)
+			output, err := cmdtest.RunAppsodyCmd(args, project.dir)
+			if err != nil {
+				t.Fatalf("%v. CLI output:\n%s", err, output)
+			}
+			if strings.Join(loadedFiles, " ") != "blobs blobs/sha256 oci-layout" {
+				t.Errorf("Expected the daemon to load the layout directory, it received %v", loadedFiles)
+			}
+			if strings.Join(tagged, ", ") != tt.expectedTag {
+				t.Errorf("Expected the tag request %q, but got %q", tt.expectedTag, tagged)
+			}
+			if !strings.Contains(output, tt.expectedOutput) {
+				t.Errorf("Expected %s. CLI output:\n%s", tt.expectedOutput, output)
+			}
+		})
+	}
+}
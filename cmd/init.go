@@ -74,6 +74,7 @@ setup the local dev environment.`,
 
 	initCmd.PersistentFlags().BoolVar(&config.overwrite, "overwrite", false, "Download and extract the template project, overwriting existing files.  This option is not intended to be used in Appsody project directories.")
 	initCmd.PersistentFlags().BoolVar(&config.noTemplate, "no-template", false, "Only create the .appsody-config.yaml file. Do not unzip the template project. [Deprecated]")
+	addPullPolicyFlag(initCmd, rootConfig)
 	return initCmd
 }
 
@@ -90,7 +91,7 @@ func initAppsody(stack string, template string, config *initCommandConfig) error
 	}
 	var proceedWithTemplate bool
 
-	err := CheckPrereqs()
+	err := CheckPrereqs(config.RootCommandConfig)
 	if err != nil {
 		Warning.logf("Failed to check prerequisites: %v\n", err)
 	}
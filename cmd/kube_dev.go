@@ -0,0 +1,369 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// The environments run, debug and test can start the stack container in
+const (
+	targetDocker     = "docker"
+	targetKubernetes = "kubernetes"
+)
+
+var supportedTargets = []string{targetDocker, targetKubernetes}
+
+// The labels identify the resources a dev session creates, so they can be deleted together
+const (
+	kubeManagedByLabel = "app.kubernetes.io/managed-by"
+	kubeManagedByValue = "appsody-cli"
+	kubeSessionLabel   = "dev.appsody/session"
+)
+
+// the kinds of the resources generated for a dev session
+const kubeSessionKinds = "deployment,service,ingress"
+
+// how long to wait for the dev deployment to become available
+const kubeRolloutTimeout = "5m"
+
+// A synced dev pod gets the controller from the CLI: its init container waits until the controller
+// is copied into the controller volume, mounted in kubeControllerDir
+const (
+	kubeControllerInit  = "appsody-controller-init"
+	kubeControllerDir   = "/.appsody"
+	kubeControllerReady = kubeControllerDir + "/.controller-ready"
+)
+
+// how long to wait for the init container of the dev pod to start
+const kubeInitTimeout = 5 * time.Minute
+
+func addTargetFlags(cmd *cobra.Command, target *string, namespace *string) {
+	cmd.PersistentFlags().StringVar(target, "target", targetDocker, "Where to run the development environment: docker, or kubernetes to run it in the cluster of the current kubectl context")
+	cmd.PersistentFlags().StringVar(namespace, "namespace", "", "The Kubernetes namespace to use with --target kubernetes (default is the namespace of the current kubectl context)")
+}
+
+func addSyncBackFlag(cmd *cobra.Command, config *devCommonConfig) {
+	cmd.PersistentFlags().StringArrayVar(&config.syncBack, "sync-back", nil, "With --target kubernetes, a file or directory of the project, such as package-lock.json or target, to copy back from the container when it changes there. Can be repeated.")
+}
+
+func checkTarget(target string) error {
+	for _, supportedTarget := range supportedTargets {
+		if target == supportedTarget {
+			return nil
+		}
+	}
+	return errors.Errorf("Unsupported target %s. Use one of: %s", target, strings.Join(supportedTargets, ", "))
+}
+
+// onKubernetes reports whether the dev environment runs in Kubernetes, either selected with
+// --target kubernetes or with the APPSODY_K8S_EXPERIMENTAL environment variable
+func (config *devCommonConfig) onKubernetes() bool {
+	return config.Buildah || config.target == targetKubernetes
+}
+
+// kubeSessionLabels returns the labels of the resources of the dev session
+func kubeSessionLabels(name string) map[string]string {
+	return map[string]string{
+		kubeManagedByLabel: kubeManagedByValue,
+		kubeSessionLabel:   name,
+	}
+}
+
+// kubeSessionSelector returns the label selector of the resources of the dev session
+func kubeSessionSelector(name string) string {
+	var selector []string
+	for key, value := range kubeSessionLabels(name) {
+		selector = append(selector, key+"="+value)
+	}
+	sort.Strings(selector)
+	return strings.Join(selector, ",")
+}
+
+func getKubeManifestDir(projectDir string) string {
+	return filepath.Join(projectDir, ".appsody", "k8s")
+}
+
+// writeKubeManifest writes a generated manifest into the .appsody/k8s directory of the project
+func writeKubeManifest(projectDir string, fileName string, manifest []byte, dryrun bool) (string, error) {
+	manifestFile := filepath.Join(getKubeManifestDir(projectDir), fileName)
+	if dryrun {
+		Info.log("Skipping creation of yaml file: ", manifestFile)
+		return manifestFile, nil
+	}
+	err := os.MkdirAll(filepath.Dir(manifestFile), os.ModePerm)
+	if err != nil {
+		return "", err
+	}
+	err = ioutil.WriteFile(manifestFile, manifest, 0666)
+	if err != nil {
+		return "", err
+	}
+	return manifestFile, nil
+}
+
+// deleteKubeSession deletes the resources of the dev session, found by their labels
+func deleteKubeSession(name string, namespace string, dryrun bool) error {
+	Info.log("Deleting the Kubernetes resources of ", name)
+	deleteArgs := []string{kubeSessionKinds, "--selector", kubeSessionSelector(name), "--ignore-not-found"}
+	if namespace != "" {
+		deleteArgs = append(deleteArgs, "--namespace", namespace)
+	}
+	output, err := RunKubeDelete(deleteArgs, dryrun)
+	if err != nil {
+		return errors.Errorf("Could not delete the Kubernetes resources of %s: %v", name, err)
+	}
+	if strings.TrimSpace(output) != "" {
+		Info.log(strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// waitForKubeRollout waits until the pod of the dev deployment is available
+func waitForKubeRollout(name string, namespace string, dryrun bool) error {
+	Info.log("Waiting for the deployment ", name, " to become available")
+	rolloutArgs := []string{"rollout", "status", "deployment/" + name, "--timeout=" + kubeRolloutTimeout}
+	if namespace != "" {
+		rolloutArgs = append(rolloutArgs, "--namespace", namespace)
+	}
+	_, err := RunKube(rolloutArgs, dryrun)
+	if err != nil {
+		describe := "kubectl describe deployment " + name
+		if namespace != "" {
+			describe += " --namespace " + namespace
+		}
+		return errors.Errorf("The deployment %s did not become available within %s, run '%s' for details: %v", name, kubeRolloutTimeout, describe, err)
+	}
+	return nil
+}
+
+// waitForKubeInitContainer waits until the init container of a pod of the dev deployment runs and returns the pod.
+// It stops waiting when cancel is closed.
+func waitForKubeInitContainer(name string, namespace string, dryrun bool, cancel <-chan struct{}) (string, error) {
+	getArgs := []string{"get", "pods", "--selector", "app=" + name, "-o", `jsonpath={range .items[*]}{.metadata.name} {.status.initContainerStatuses[0].state.running.startedAt}{"\n"}{end}`}
+	if namespace != "" {
+		getArgs = append(getArgs, "--namespace", namespace)
+	}
+	if dryrun {
+		Info.log("Dry run - skipping execution of: kubectl ", strings.Join(getArgs, " "))
+		return name, nil
+	}
+	Info.log("Waiting for the pod of ", name, " to start")
+	deadline := time.Now().Add(kubeInitTimeout)
+	for {
+		Debug.log("Running command: kubectl ", strings.Join(getArgs, " "))
+		output, err := exec.Command("kubectl", getArgs...).Output()
+		if err != nil {
+			return "", errors.Errorf("Could not get the pods of %s: %v", name, err)
+		}
+		for _, line := range strings.Split(string(output), "\n") {
+			// the start time is only there once the init container runs
+			if fields := strings.Fields(line); len(fields) == 2 {
+				return fields[0], nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return "", errors.Errorf("The init container of the pod of %s did not start within %v, run 'kubectl describe pods --selector app=%s' for details", name, kubeInitTimeout, name)
+		}
+		select {
+		case <-cancel:
+			return "", errors.Errorf("Stopped waiting for the pod of %s", name)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// copyControllerToKube copies the controller into the controller volume of the dev pod, through the init container,
+// which then lets the pod start
+func copyControllerToKube(config *devCommonConfig, controller string, cancel <-chan struct{}) error {
+	pod, err := waitForKubeInitContainer(config.containerName, config.namespace, config.Dryrun, cancel)
+	if err != nil {
+		return err
+	}
+	var input io.Reader
+	if !config.Dryrun {
+		controllerFile, err := os.Open(controller)
+		if err != nil {
+			return errors.Errorf("Could not read the controller %s: %v", controller, err)
+		}
+		defer controllerFile.Close()
+		input = controllerFile
+	}
+	Info.logf("Copying the controller %s to the pod %s", controller, pod)
+	target := kubeControllerDir + "/" + controllerBinary
+	_, err = kubeExec(pod, kubeControllerInit, config.namespace, input, config.Dryrun,
+		"sh", "-c", "cat > "+target+".tmp && chmod 755 "+target+".tmp && mv "+target+".tmp "+target+" && touch "+kubeControllerReady)
+	if err != nil {
+		return errors.Errorf("Could not copy the controller to the pod %s: %v", pod, err)
+	}
+	return nil
+}
+
+// runOnKubernetes deploys the stack image with the controller to Kubernetes and streams its logs.
+// The resources are deleted when the command is interrupted, or by appsody stop.
+func runOnKubernetes(config *devCommonConfig, platformDefinition string) error {
+	dryrun := config.Dryrun
+	name := config.containerName
+	namespace := config.namespace
+	labels := kubeSessionLabels(name)
+
+	portList, portsErr := getExposedPorts(config.RootCommandConfig)
+	if portsErr != nil {
+		return portsErr
+	}
+	projectDir, err := getProjectDir(config.RootCommandConfig)
+	if err != nil {
+		return err
+	}
+	// in the cluster, the project and the controller are already in volumes, from a laptop they are copied to the pod
+	workspaceClaim := ""
+	controller := ""
+	if config.Buildah {
+		workspaceClaim = "appsody-workspace"
+	} else {
+		controller, err = getMountedController(config.RootCommandConfig)
+		if err != nil {
+			return err
+		}
+	}
+	projectMount, err := getProjectContainerDir(config.RootCommandConfig)
+	if err != nil {
+		return err
+	}
+	if projectMount == "" {
+		return errors.New("Could not determine the project directory in the container: the stack does not set APPSODY_MOUNTS or APPSODY_PROJECT_DIR")
+	}
+	deploymentYaml, err := GenDeploymentYaml(name, platformDefinition, portList, projectDir, labels, namespace, workspaceClaim, path.Clean(projectMount), dryrun)
+	if err != nil {
+		return err
+	}
+	serviceYaml, err := GenServiceYaml(name, portList, projectDir, labels, namespace, dryrun)
+	if err != nil {
+		return err
+	}
+	manifests := []string{deploymentYaml, serviceYaml}
+	port := getIngressPort(config.RootCommandConfig)
+	// Generate the Ingress only if it makes sense - i.e. there's a port to expose
+	if port > 0 {
+		routeYaml, err := GenRouteYaml(name, projectDir, port, labels, namespace, dryrun)
+		if err != nil {
+			return err
+		}
+		manifests = append(manifests, routeYaml)
+	}
+
+	// delete what was applied if the command is interrupted from now on
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	sessionEnded := make(chan struct{})
+	cancelled := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	cleaned := make(chan error, 1)
+	go func() {
+		select {
+		case <-c:
+		case <-sessionEnded:
+			// the signal that ended the session may be delivered after it ended
+			select {
+			case <-c:
+			default:
+				interrupted <- false
+				return
+			}
+		}
+		close(cancelled)
+		interrupted <- true
+		cleaned <- deleteKubeSession(name, namespace, dryrun)
+	}()
+
+	logPhase(phaseRunning, name)
+	err = applyAndFollowKubeSession(config, manifests, controller, cancelled)
+	// no signal is delivered once the notifications are stopped, so the goroutine decides whether it was interrupted
+	signal.Stop(c)
+	close(sessionEnded)
+	if <-interrupted {
+		cleanupErr := <-cleaned
+		if cleanupErr != nil {
+			return cleanupErr
+		}
+		Info.log("Closing down, development environment was interrupted.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	Info.logf("The development environment is still running in Kubernetes, run 'appsody stop --target kubernetes --name %s' to remove it.", name)
+	return nil
+}
+
+// applyAndFollowKubeSession applies the manifests, copies the controller to the pod unless it is "",
+// waits for the deployment and streams its logs. Closing cancel stops the wait for the pod.
+func applyAndFollowKubeSession(config *devCommonConfig, manifests []string, controller string, cancel <-chan struct{}) error {
+	for _, manifest := range manifests {
+		err := KubeApply(manifest, config.namespace, config.Dryrun)
+		if err != nil {
+			return err
+		}
+	}
+	if controller != "" {
+		err := copyControllerToKube(config, controller, cancel)
+		if err != nil {
+			return err
+		}
+	}
+	err := waitForKubeRollout(config.containerName, config.namespace, config.Dryrun)
+	if err != nil {
+		return err
+	}
+	if !config.Buildah {
+		syncer, syncErr := newKubeSync(config)
+		if syncErr != nil {
+			return syncErr
+		}
+		syncErr = syncer.start()
+		if syncErr != nil {
+			return syncErr
+		}
+		stopSync := make(chan struct{})
+		defer close(stopSync)
+		go syncer.run(stopSync)
+	}
+	logsArgs := []string{"logs", "deployment/" + config.containerName, "--follow"}
+	if config.namespace != "" {
+		logsArgs = append(logsArgs, "--namespace", config.namespace)
+	}
+	execCmd, err := RunKubeCommandAndListen(logsArgs, Container, config.interactive, config.Verbose, config.Dryrun)
+	if config.Dryrun {
+		Info.log("Dry Run - Skipping execCmd.Wait")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return waitCommand(execCmd)
+}
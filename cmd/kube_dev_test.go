@@ -0,0 +1,260 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appsody/appsody/cmd"
+	"github.com/appsody/appsody/cmd/cmdtest"
+	"gopkg.in/yaml.v2"
+)
+
+func TestGenDeploymentYamlLabels(t *testing.T) {
+	projectDir, err := ioutil.TempDir("", "appsody-kube")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(projectDir)
+	labels := map[string]string{"app.kubernetes.io/managed-by": "appsody-cli", "dev.appsody/session": "my-project-dev"}
+	deploymentFile, err := cmd.GenDeploymentYaml("my-project-dev", "appsody/nodejs:0.3", []string{"3000"}, projectDir, labels, "dev", "appsody-workspace", "/project/user-app", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deploymentFile != filepath.Join(projectDir, ".appsody", "k8s", "deployment.yaml") {
+		t.Errorf("Expected the deployment to be generated in .appsody/k8s, but it is %s", deploymentFile)
+	}
+	deploymentBytes, err := ioutil.ReadFile(deploymentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deployment struct {
+		Metadata struct {
+			Namespace string            `yaml:"namespace"`
+			Labels    map[string]string `yaml:"labels"`
+		} `yaml:"metadata"`
+		Spec struct {
+			Template struct {
+				Metadata struct {
+					Labels map[string]string `yaml:"labels"`
+				} `yaml:"metadata"`
+			} `yaml:"template"`
+		} `yaml:"spec"`
+	}
+	err = yaml.Unmarshal(deploymentBytes, &deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployment.Metadata.Namespace != "dev" {
+		t.Errorf("Expected the namespace dev, but it is %s", deployment.Metadata.Namespace)
+	}
+	for key, value := range labels {
+		if deployment.Metadata.Labels[key] != value || deployment.Spec.Template.Metadata.Labels[key] != value {
+			t.Errorf("Expected the label %s=%s on the deployment and its pods:\n%s", key, value, deploymentBytes)
+		}
+	}
+	// in the cluster, the controller comes from the volume claim of the cluster
+	if !strings.Contains(string(deploymentBytes), "claimName: appsody-controller") || strings.Contains(string(deploymentBytes), "initContainers") {
+		t.Errorf("Expected the controller volume claim and no init container:\n%s", deploymentBytes)
+	}
+}
+
+func TestGenDeploymentYamlSyncedWorkspace(t *testing.T) {
+	projectDir, err := ioutil.TempDir("", "appsody-kube")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(projectDir)
+	deploymentFile, err := cmd.GenDeploymentYaml("my-project-dev", "appsody/nodejs:0.3", []string{"3000"}, projectDir, nil, "", "", "/opt/app", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deploymentBytes, err := ioutil.ReadFile(deploymentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployment := string(deploymentBytes)
+	// without a workspace claim the project is synced into an empty volume
+	if !strings.Contains(deployment, "emptyDir: {}") || strings.Contains(deployment, "claimName: appsody-workspace") || strings.Contains(deployment, "subPath") {
+		t.Errorf("Expected the workspace to be an emptyDir volume:\n%s", deployment)
+	}
+	if !strings.Contains(deployment, "mountPath: /opt/app") {
+		t.Errorf("Expected the workspace to be mounted in the project directory of the stack:\n%s", deployment)
+	}
+	// and the controller is copied by the CLI, so the pod needs no claim or service account of the cluster
+	if strings.Contains(deployment, "claimName") || strings.Contains(deployment, "serviceAccountName") {
+		t.Errorf("Expected no volume claim or service account:\n%s", deployment)
+	}
+	var parsed struct {
+		Spec struct {
+			Template struct {
+				Spec struct {
+					InitContainers []struct {
+						Name         string   `yaml:"name"`
+						Image        string   `yaml:"image"`
+						Command      []string `yaml:"command"`
+						VolumeMounts []struct {
+							Name      string `yaml:"name"`
+							MountPath string `yaml:"mountPath"`
+						} `yaml:"volumeMounts"`
+					} `yaml:"initContainers"`
+				} `yaml:"spec"`
+			} `yaml:"template"`
+		} `yaml:"spec"`
+	}
+	err = yaml.Unmarshal(deploymentBytes, &parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initContainers := parsed.Spec.Template.Spec.InitContainers
+	if len(initContainers) != 1 || initContainers[0].Name != "appsody-controller-init" || initContainers[0].Image != "appsody/nodejs:0.3" ||
+		len(initContainers[0].VolumeMounts) != 1 || initContainers[0].VolumeMounts[0].Name != "appsody-controller" || initContainers[0].VolumeMounts[0].MountPath != "/.appsody" {
+		t.Errorf("Expected an init container of the stack image mounting the controller volume:\n%s", deployment)
+	}
+	if len(initContainers) == 1 && !strings.Contains(strings.Join(initContainers[0].Command, " "), "/.appsody/.controller-ready") {
+		t.Errorf("Expected the init container to wait for the controller:\n%s", deployment)
+	}
+}
+
+func TestRunStopKubernetesTarget(t *testing.T) {
+	home, err := ioutil.TempDir("", "appsody-kube")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	configFile := filepath.Join(home, "config.yaml")
+	err = ioutil.WriteFile(configFile, []byte("home: "+home+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	projectDir := filepath.Join(home, "kube-project")
+	err = os.MkdirAll(projectDir, os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(projectDir, ".appsody-config.yaml"), []byte("stack: test/kube-stack:0.1.0\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/images/test/kube-stack:0.1.0/json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Id": "sha256:9abc", "Config": {"Env": ["APPSODY_MOUNTS=.:/opt/app-root/src/"], "ExposedPorts": {}}}`))
+	})
+	dockerHost, cleanup := startFakeDockerDaemon(t, mux)
+	defer cleanup()
+	oldDockerHost := os.Getenv("DOCKER_HOST")
+	os.Setenv("DOCKER_HOST", dockerHost)
+	defer os.Setenv("DOCKER_HOST", oldDockerHost)
+
+	output, err := cmdtest.RunAppsodyCmd([]string{"run", "--config", configFile, "--engine", "docker-api", "--dryrun", "--pull", "missing", "--target", "kubernetes", "--namespace", "dev"}, projectDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestDir := filepath.Join(projectDir, ".appsody", "k8s")
+	for _, expected := range []string{
+		"kubectl apply -f " + filepath.Join(manifestDir, "deployment.yaml") + " --namespace dev",
+		"kubectl apply -f " + filepath.Join(manifestDir, "service.yaml") + " --namespace dev",
+		"kubectl exec -i kube-project-dev -c appsody-controller-init --namespace dev -- sh -c cat > /.appsody/appsody-controller.tmp",
+		"kubectl rollout status deployment/kube-project-dev --timeout=5m --namespace dev",
+		"kubectl exec -i kube-project-dev -c kube-project-dev --namespace dev -- tar xf - -C /opt/app-root/src",
+		"kubectl logs deployment/kube-project-dev --follow --namespace dev",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %s. CLI output:\n%s", expected, output)
+		}
+	}
+
+	output, err = cmdtest.RunAppsodyCmd([]string{"stop", "--config", configFile, "--dryrun", "--target", "kubernetes", "--namespace", "dev"}, projectDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "kubectl delete deployment,service,ingress --selector app.kubernetes.io/managed-by=appsody-cli,dev.appsody/session=kube-project-dev --ignore-not-found --namespace dev"
+	if !strings.Contains(output, expected) {
+		t.Errorf("Expected %s. CLI output:\n%s", expected, output)
+	}
+}
+
+func TestSyncPullBack(t *testing.T) {
+	home, err := ioutil.TempDir("", "appsody-sync-back")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	localDir := filepath.Join(home, "project")
+	remoteDir := filepath.Join(home, "container")
+	// kubectl exec runs the command locally, in a container whose project directory is remoteDir
+	binDir := filepath.Join(home, "bin")
+	for _, dir := range []string{localDir, filepath.Join(remoteDir, "target"), filepath.Join(home, "tmp"), binDir} {
+		err = os.MkdirAll(dir, os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	fakeKubectl := "#!/bin/sh\nwhile [ \"$1\" != -- ]; do shift; done\nshift\nTMPDIR=" + filepath.Join(home, "tmp") + " exec \"$@\"\n"
+	err = ioutil.WriteFile(filepath.Join(binDir, "kubectl"), []byte(fakeKubectl), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", binDir+string(os.PathListSeparator)+oldPath)
+	defer os.Setenv("PATH", oldPath)
+	writeRemote := func(name string, content string, modTime time.Time) {
+		file := filepath.Join(remoteDir, "target", name)
+		err := ioutil.WriteFile(file, []byte(content), 0644)
+		if err == nil {
+			err = os.Chtimes(file, modTime, modTime)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	readLocal := func(name string) string {
+		content, err := ioutil.ReadFile(filepath.Join(localDir, "target", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+	writeRemote("a.txt", "a1", time.Now().Add(-time.Hour))
+	writeRemote("b.txt", "b1", time.Now().Add(-time.Hour))
+	pullBack := cmd.PullBack(localDir, remoteDir, []string{"target"}, "sync-project")
+
+	// the first pull back copies all the files
+	err = pullBack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, b := readLocal("a.txt"), readLocal("b.txt"); a != "a1" || b != "b1" {
+		t.Errorf("Expected all the files to be pulled back, but got %s %s", a, b)
+	}
+
+	// then only the files changed since the previous pull back
+	writeRemote("a.txt", "a2", time.Now().Add(-time.Hour))
+	writeRemote("b.txt", "b2", time.Now().Add(time.Minute))
+	err = pullBack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, b := readLocal("a.txt"), readLocal("b.txt"); a != "a1" || b != "b2" {
+		t.Errorf("Expected only the changed b.txt to be pulled back, but got %s %s", a, b)
+	}
+}
+
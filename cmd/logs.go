@@ -0,0 +1,185 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// The default retention of the CLI logs, a limit of 0 disables it
+const (
+	defaultLogMaxFiles = 100
+	defaultLogMaxAge   = "720h"
+	defaultLogMaxSize  = 100 // MB
+)
+
+// currentLogFile is the log file of this invocation, which the retention keeps
+var currentLogFile string
+
+type logsCliCommandConfig struct {
+	*RootCommandConfig
+	last bool
+}
+
+func getLogDir() (string, error) {
+	homeDirectory, err := homeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDirectory, ".appsody", "logs"), nil
+}
+
+// cliLogFiles returns the log files the CLI created in the log directory, the newest first
+func cliLogFiles(logDir string) ([]os.FileInfo, error) {
+	entries, err := ioutil.ReadDir(logDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Errorf("Could not read the log directory %s: %v", logDir, err)
+	}
+	var logFiles []os.FileInfo
+	for _, entry := range entries {
+		if entry.Mode().IsRegular() && strings.HasPrefix(entry.Name(), "appsody") && strings.HasSuffix(entry.Name(), ".log") {
+			logFiles = append(logFiles, entry)
+		}
+	}
+	sort.Slice(logFiles, func(i, j int) bool {
+		return logFiles[i].ModTime().After(logFiles[j].ModTime())
+	})
+	return logFiles, nil
+}
+
+// enforceLogRetention deletes the CLI logs beyond the logmaxfiles, logmaxage and logmaxsize (in MB) config settings,
+// starting with the oldest
+func enforceLogRetention(config *RootCommandConfig) {
+	maxFiles := config.CliConfig.GetInt("logmaxfiles")
+	maxSize := int64(config.CliConfig.GetInt("logmaxsize")) * 1024 * 1024
+	var maxAge time.Duration
+	if ageSetting := config.CliConfig.GetString("logmaxage"); ageSetting != "" && ageSetting != "0" {
+		var err error
+		maxAge, err = time.ParseDuration(ageSetting)
+		if err != nil {
+			Warning.log("Ignoring the logmaxage config setting: ", err)
+			maxAge = 0
+		}
+	}
+	logDir, err := getLogDir()
+	if err != nil {
+		Warning.log("Could not clean up the CLI logs: ", err)
+		return
+	}
+	logFiles, err := cliLogFiles(logDir)
+	if err != nil {
+		Warning.log("Could not clean up the CLI logs: ", err)
+		return
+	}
+
+	kept := 0
+	var keptSize int64
+	for _, logFile := range logFiles {
+		logPath := filepath.Join(logDir, logFile.Name())
+		if logPath == currentLogFile {
+			continue
+		}
+		expired := (maxFiles > 0 && kept >= maxFiles) ||
+			(maxAge > 0 && time.Since(logFile.ModTime()) > maxAge) ||
+			(maxSize > 0 && keptSize+logFile.Size() > maxSize)
+		if !expired {
+			kept++
+			keptSize += logFile.Size()
+			continue
+		}
+		if config.Dryrun {
+			Info.log("Dry Run - Skip removing log file ", logPath)
+			continue
+		}
+		Debug.log("Removing log file ", logPath)
+		err = os.Remove(logPath)
+		if err != nil {
+			Warning.log("Could not remove log file ", logPath, ": ", err)
+		}
+	}
+}
+
+func newLogsCmd(rootConfig *RootCommandConfig) *cobra.Command {
+	// logsCmd represents the logs command
+	var logsCmd = &cobra.Command{
+		Use:   "logs",
+		Short: "Locate and print logs",
+	}
+	logsCmd.AddCommand(newLogsCliCmd(rootConfig))
+	return logsCmd
+}
+
+func newLogsCliCmd(rootConfig *RootCommandConfig) *cobra.Command {
+	config := &logsCliCommandConfig{RootCommandConfig: rootConfig}
+	var logsCliCmd = &cobra.Command{
+		Use:   "cli",
+		Short: "List the recent logs of the CLI, or print the last one",
+		Long: `List the logs the CLI writes to $HOME/.appsody/logs when it runs with --verbose, the newest first. Use --last to print the most recent one.
+
+Old logs are removed according to the logmaxfiles, logmaxage and logmaxsize (in MB) settings of the config file. A limit of 0 disables it.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logDir, err := getLogDir()
+			if err != nil {
+				return err
+			}
+			logFiles, err := cliLogFiles(logDir)
+			if err != nil {
+				return err
+			}
+			// the log of this invocation is not a recent log
+			var recentLogs []os.FileInfo
+			for _, logFile := range logFiles {
+				if filepath.Join(logDir, logFile.Name()) != currentLogFile {
+					recentLogs = append(recentLogs, logFile)
+				}
+			}
+			if len(recentLogs) == 0 {
+				Info.log("There are no CLI logs in ", logDir, ". Run appsody with --verbose to write one.")
+				return nil
+			}
+
+			if config.last {
+				lastLog := filepath.Join(logDir, recentLogs[0].Name())
+				content, err := ioutil.ReadFile(lastLog)
+				if err != nil {
+					return errors.Errorf("Could not read the log file %s: %v", lastLog, err)
+				}
+				Info.log(strings.TrimRight(string(content), "\n"))
+				return nil
+			}
+			table := uitable.New()
+			table.AddRow("LOG FILE", "SIZE", "MODIFIED")
+			for _, logFile := range recentLogs {
+				table.AddRow(filepath.Join(logDir, logFile.Name()), formatBytes(logFile.Size()), logFile.ModTime().Format("2006-01-02 15:04:05"))
+			}
+			Info.log("\n", table)
+			return nil
+		},
+	}
+	logsCliCmd.PersistentFlags().BoolVar(&config.last, "last", false, "Print the most recent log")
+	return logsCliCmd
+}
@@ -0,0 +1,142 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appsody/appsody/cmd/cmdtest"
+)
+
+func TestLogFile(t *testing.T) {
+	home, err := ioutil.TempDir("", "appsody-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	configFile := filepath.Join(home, "config.yaml")
+	err = ioutil.WriteFile(configFile, []byte("home: "+home+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logFile := filepath.Join(home, "artifacts", "appsody.log")
+
+	// klog keeps writing to the first log file of the process, so run the CLI in its own process
+	output, err := cmdtest.RunAppsodyCmdExec([]string{"version", "--config", configFile, "--log-file", logFile}, home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "Logging to file "+logFile) {
+		t.Errorf("Expected the CLI to log to %s. CLI output:\n%s", logFile, output)
+	}
+	content, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "[Info] appsody v") {
+		t.Errorf("Expected the output of the command in %s, but it is:\n%s", logFile, content)
+	}
+}
+
+// retentionLog is a file of the log directory, modified age ago
+type retentionLog struct {
+	name string
+	age  time.Duration
+	size int
+}
+
+func TestLogRetention(t *testing.T) {
+	// files that are not logs of the CLI are never removed
+	others := []retentionLog{{"other.log", 1000 * time.Hour, 10}, {"appsody-notes.txt", 1000 * time.Hour, 10}}
+	var tests = []struct {
+		testName string
+		settings string
+		logs     []retentionLog
+		kept     []string
+	}{
+		{"max files", "logmaxfiles: 2\n",
+			[]retentionLog{{"appsody-1.log", 0, 10}, {"appsody-2.log", time.Minute, 10}, {"appsody-3.log", 2 * time.Minute, 10}},
+			[]string{"appsody-1.log", "appsody-2.log"}},
+		{"max age", "logmaxage: 24h\n",
+			[]retentionLog{{"appsody-new.log", time.Hour, 10}, {"appsody-old.log", 48 * time.Hour, 10}},
+			[]string{"appsody-new.log"}},
+		{"max size", "logmaxsize: 1\n",
+			[]retentionLog{{"appsody-new.log", 0, 600 * 1024}, {"appsody-older.log", time.Minute, 600 * 1024}, {"appsody-small.log", 2 * time.Minute, 100}},
+			[]string{"appsody-new.log", "appsody-small.log"}},
+		{"defaults", "",
+			[]retentionLog{{"appsody-new.log", 0, 10}, {"appsody-old.log", 31 * 24 * time.Hour, 10}},
+			[]string{"appsody-new.log"}},
+		{"disabled", "logmaxfiles: 0\nlogmaxage: 0\nlogmaxsize: 0\n",
+			[]retentionLog{{"appsody-new.log", 0, 10}, {"appsody-old.log", 1000 * time.Hour, 10}},
+			[]string{"appsody-new.log", "appsody-old.log"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			home, err := ioutil.TempDir("", "appsody-logs")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(home)
+			oldHome := os.Getenv("HOME")
+			os.Setenv("HOME", home)
+			defer os.Setenv("HOME", oldHome)
+			configFile := filepath.Join(home, "config.yaml")
+			err = ioutil.WriteFile(configFile, []byte("home: "+filepath.Join(home, ".appsody")+"\n"+tt.settings), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			logDir := filepath.Join(home, ".appsody", "logs")
+			err = os.MkdirAll(logDir, os.ModePerm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, log := range append(tt.logs, others...) {
+				file := filepath.Join(logDir, log.name)
+				err = ioutil.WriteFile(file, make([]byte, log.size), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				modified := time.Now().Add(-log.age)
+				err = os.Chtimes(file, modified, modified)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			output, err := cmdtest.RunAppsodyCmd([]string{"version", "--config", configFile}, home)
+			if err != nil {
+				t.Fatalf("%v. CLI output:\n%s", err, output)
+			}
+			entries, err := ioutil.ReadDir(logDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var remaining []string
+			for _, entry := range entries {
+				remaining = append(remaining, entry.Name())
+			}
+			expected := append([]string{"appsody-notes.txt", "other.log"}, tt.kept...)
+			sort.Strings(expected)
+			if strings.Join(remaining, ",") != strings.Join(expected, ",") {
+				t.Errorf("Expected the log directory to have %v, but it has %v", expected, remaining)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// TestMain runs the tests with their own home directory, as every command removes the CLI logs of
+// $HOME/.appsody/logs beyond the retention limits
+func TestMain(m *testing.M) {
+	home, err := ioutil.TempDir("", "appsody-test-home")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("HOME", home)
+	os.Setenv("USERPROFILE", home)
+	// the tests that need another home directory set HOME themselves
+	homedir.DisableCache = true
+	code := m.Run()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
@@ -0,0 +1,175 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The formats of the console output
+const (
+	outputFormatText  = "text"
+	outputFormatJSONL = "jsonl"
+)
+
+var supportedOutputFormats = []string{outputFormatText, outputFormatJSONL}
+
+// outputEventSchema is the version of the event schema, increased when a field changes meaning or is removed
+const outputEventSchema = 1
+
+// The types of the events
+const (
+	eventLog    = "log"
+	eventOutput = "output"
+	eventPhase  = "phase"
+	eventResult = "result"
+)
+
+// The phases reported with phase events
+const (
+	phasePulling    = "pulling"
+	phaseExtracting = "extracting"
+	phaseBuilding   = "building"
+	phaseRunning    = "running"
+)
+
+// outputEvent is one line of the --output-format=jsonl output.
+// log events have a level, output events the source of the output (container, initscript or docker),
+// phase events the phase and result events the command and its status (success or failure).
+type outputEvent struct {
+	Schema  int    `json:"schema"`
+	Time    string `json:"time"`
+	Type    string `json:"type"`
+	Level   string `json:"level,omitempty"`
+	Source  string `json:"source,omitempty"`
+	Phase   string `json:"phase,omitempty"`
+	Command string `json:"command,omitempty"`
+	Status  string `json:"status,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// jsonlOutput is set when the console output is one JSON event per line
+var jsonlOutput bool
+
+// events are written by the loggers and the goroutines copying the container output
+var eventLock sync.Mutex
+
+// initOutputFormat checks the --output-format flag once all the flags of the command are parsed
+func initOutputFormat(config *RootCommandConfig) error {
+	for _, supportedFormat := range supportedOutputFormats {
+		if config.OutputFormat == supportedFormat {
+			jsonlOutput = config.OutputFormat == outputFormatJSONL
+			return nil
+		}
+	}
+	jsonlOutput = false
+	return errors.Errorf("Unsupported output format %s. Use one of: %s", config.OutputFormat, strings.Join(supportedOutputFormats, ", "))
+}
+
+func writeEvent(event outputEvent) {
+	event.Schema = outputEventSchema
+	event.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	event.Message = ansiRegexp.ReplaceAllString(event.Message, "")
+	eventLock.Lock()
+	defer eventLock.Unlock()
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(event)
+}
+
+// logEvent writes the message of a logger as a log event, or an output event
+// for the loggers of the output of the commands the CLI runs
+func (l appsodylogger) logEvent(msgString string) {
+	switch l.name {
+	case Container.name, InitScript.name, DockerLog.name:
+		writeEvent(outputEvent{Type: eventOutput, Source: strings.ToLower(l.name), Message: msgString})
+	default:
+		writeEvent(outputEvent{Type: eventLog, Level: strings.ToLower(l.name), Message: msgString})
+	}
+}
+
+// eventWriter writes each line of the output of a command run by the CLI as an output event of the logger,
+// and to the log file. A line is written as soon as it is complete, and Flush writes the last line when it does
+// not end with a newline, so that the events are all written when the command ends.
+// The stdout and stderr of the command share the writer, exec writes to it from a goroutine for each.
+type eventWriter struct {
+	logger appsodylogger
+	// the output is also copied to copy, if it is set
+	copy io.Writer
+	lock sync.Mutex
+	line []byte
+}
+
+func (w *eventWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.copy != nil {
+		_, _ = w.copy.Write(p)
+	}
+	w.line = append(w.line, p...)
+	for {
+		newline := bytes.IndexByte(w.line, '\n')
+		if newline < 0 {
+			return len(p), nil
+		}
+		w.writeLine(strings.TrimSuffix(string(w.line[:newline]), "\r"))
+		w.line = w.line[newline+1:]
+	}
+}
+
+// Flush writes the rest of the output, once the command ended
+func (w *eventWriter) Flush() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if len(w.line) > 0 {
+		w.writeLine(strings.TrimSuffix(string(w.line), "\r"))
+		w.line = nil
+	}
+}
+
+func (w *eventWriter) writeLine(line string) {
+	w.logger.LogSkipConsole(line)
+	w.logger.logEvent(line)
+}
+
+// logPhase reports that the command enters a phase, such as pulling the stack image.
+// The console text output already describes the phases, so they are only written as events.
+func logPhase(phase string, detail string) {
+	Debug.log("Entering phase ", phase, " ", detail)
+	if jsonlOutput {
+		writeEvent(outputEvent{Type: eventPhase, Phase: phase, Message: detail})
+	}
+}
+
+// logResult reports the outcome of the command
+func logResult(command string, err error) {
+	if !jsonlOutput {
+		return
+	}
+	event := outputEvent{Type: eventResult, Command: command, Status: "success"}
+	if err != nil {
+		event.Status = "failure"
+		event.Message = err.Error()
+	}
+	writeEvent(event)
+}
@@ -0,0 +1,113 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd/cmdtest"
+)
+
+type outputEvent struct {
+	Schema  int    `json:"schema"`
+	Time    string `json:"time"`
+	Type    string `json:"type"`
+	Level   string `json:"level"`
+	Source  string `json:"source"`
+	Phase   string `json:"phase"`
+	Command string `json:"command"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+func TestRunOutputFormatJSONL(t *testing.T) {
+	project, cleanup := newTestProject(t, "jsonl-project", "test/jsonl-stack:0.1.0",
+		`{"Id": "sha256:9abc", "Config": {"Env": ["APPSODY_MOUNTS=.:/project/user-app"], "ExposedPorts": {}}}`)
+	defer cleanup()
+
+	// the output format is given after the run flags, so it only takes effect once all the flags are parsed
+	output, err := cmdtest.RunAppsodyCmd(project.appsodyArgs("run", "--dryrun", "--output-format", "jsonl"), project.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []outputEvent
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		var event outputEvent
+		err = json.Unmarshal([]byte(line), &event)
+		if err != nil {
+			t.Fatalf("Expected only JSON events, but got %s. CLI output:\n%s", line, output)
+		}
+		if event.Schema != 1 || event.Time == "" || event.Type == "" {
+			t.Errorf("Expected the schema, time and type of every event, but got %s", line)
+		}
+		events = append(events, event)
+	}
+	var running, dockerRun bool
+	for _, event := range events {
+		if event.Type == "phase" && event.Phase == "running" && event.Message == "jsonl-project-dev" {
+			running = true
+		}
+		if event.Type == "log" && event.Level == "info" && strings.Contains(event.Message, "docker run") {
+			dockerRun = true
+		}
+	}
+	if !running {
+		t.Errorf("Expected the running phase event. CLI output:\n%s", output)
+	}
+	if !dockerRun {
+		t.Errorf("Expected the docker run command as an info log event. CLI output:\n%s", output)
+	}
+	result := events[len(events)-1]
+	if result.Type != "result" || result.Command != "appsody run" || result.Status != "success" {
+		t.Errorf("Expected the last event to be the successful result of appsody run, but it is %+v", result)
+	}
+}
+
+func TestRunOutputFormatJSONLContainerOutput(t *testing.T) {
+	project, cleanup := newTestProject(t, "jsonl-project", "test/jsonl-stack:0.1.0",
+		`{"Id": "sha256:9abc", "Config": {"Env": ["APPSODY_MOUNTS=.:/project/user-app"], "ExposedPorts": {}}}`)
+	defer cleanup()
+	// the docker command the container is run with writes to its stdout and stderr
+	restorePath := project.installFakeDocker(t, "if [ \"$1\" = run ]; then\n  echo 'Server listening on port 3000'\n  printf '\\033[32mApp started\\033[0m\\n' >&2\n  printf 'Error: the app stopped' >&2\nfi\n")
+	defer restorePath()
+	// the controller is only mounted in the container
+	oldController := os.Getenv("APPSODY_MOUNT_CONTROLLER")
+	os.Setenv("APPSODY_MOUNT_CONTROLLER", filepath.Join(project.home, "bin", "appsody-controller"))
+	defer os.Setenv("APPSODY_MOUNT_CONTROLLER", oldController)
+
+	output, err := cmdtest.RunAppsodyCmd(project.appsodyArgs("run", "--output-format", "jsonl"), project.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var containerOutput []string
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		var event outputEvent
+		err = json.Unmarshal([]byte(line), &event)
+		if err != nil {
+			t.Fatalf("Expected only JSON events, but got %s. CLI output:\n%s", line, output)
+		}
+		if event.Type == "output" && event.Source == "container" {
+			containerOutput = append(containerOutput, event.Message)
+		}
+	}
+	// the last line has no newline
+	expected := []string{"Server listening on port 3000", "App started", "Error: the app stopped"}
+	if strings.Join(containerOutput, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected the container output events %q without the ANSI colors, but got %q. CLI output:\n%s", expected, containerOutput, output)
+	}
+}
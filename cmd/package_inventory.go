@@ -0,0 +1,423 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// inventoryPackage is a dependency declared by a manifest of the build context
+type inventoryPackage struct {
+	// the ecosystem of the package, as the type of its package URL: npm, maven, golang or pypi
+	Type string
+	Name string
+	// the pinned version of the package, empty when the manifest declares a range
+	Version string
+	// the version range or the other specifier the manifest declares instead of a pinned version
+	Range string
+	// the path of the manifest in the build context
+	Source string
+}
+
+// purl returns the package URL of the package, see https://github.com/package-url/purl-spec
+func (pkg inventoryPackage) purl() string {
+	name := pkg.Name
+	switch pkg.Type {
+	case "npm":
+		name = strings.Replace(name, "@", "%40", 1)
+	case "maven":
+		name = strings.Replace(name, ":", "/", 1)
+	case "pypi":
+		name = strings.ToLower(strings.Replace(name, "_", "-", -1))
+	}
+	purl := "pkg:" + pkg.Type + "/" + name
+	if pkg.Version != "" {
+		purl += "@" + url.PathEscape(pkg.Version)
+	}
+	return purl
+}
+
+// the manifests the packages are read from. The package.json of a directory is only read when it has no package-lock.json.
+var inventoryParsers = map[string]func(content []byte, source string) ([]inventoryPackage, error){
+	"package-lock.json": parsePackageLock,
+	"package.json":      parsePackageJSON,
+	"pom.xml":           parsePom,
+	"go.mod":            parseGoMod,
+	"requirements.txt":  parseRequirements,
+}
+
+// the directories of installed dependencies, which have manifests of their own
+var inventorySkippedDirs = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+	"target":       true,
+}
+
+// inventoryManifests returns the files of the directory that packages are read from, by their slash separated path
+func inventoryManifests(dir string) (map[string]string, error) {
+	manifests := make(map[string]string)
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		relative, err := filepath.Rel(dir, file)
+		if err != nil || relative == "." {
+			return err
+		}
+		if info.IsDir() {
+			if inventorySkippedDirs[info.Name()] || strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if _, found := inventoryParsers[info.Name()]; found && info.Mode().IsRegular() {
+			manifests[filepath.ToSlash(relative)] = file
+		}
+		return nil
+	})
+	return manifests, err
+}
+
+// projectManifests returns the files of the mounts of the project that packages are read from,
+// by their path in the extract directory
+func projectManifests(config *RootCommandConfig) (map[string]string, error) {
+	containerProjectDir, err := getExtractDir(config)
+	if err != nil {
+		return nil, err
+	}
+	volumeMaps, err := getVolumeArgs(config)
+	if err != nil {
+		return nil, err
+	}
+	localFiles, _, err := scanProjectMounts(config, volumeMaps, containerProjectDir)
+	if err != nil {
+		return nil, err
+	}
+	manifests := make(map[string]string)
+	for extractPath, file := range localFiles {
+		if _, found := inventoryParsers[path.Base(extractPath)]; !found || file.Mode.IsDir() {
+			continue
+		}
+		skipped := false
+		for _, dir := range strings.Split(path.Dir(extractPath), "/") {
+			if inventorySkippedDirs[dir] || (strings.HasPrefix(dir, ".") && dir != ".") {
+				skipped = true
+			}
+		}
+		if !skipped {
+			manifests[extractPath] = file.source
+		}
+	}
+	return manifests, nil
+}
+
+// readInventory returns the packages declared by the manifests, sorted by type, name and version.
+// A manifest that cannot be parsed is skipped with a warning.
+func readInventory(manifests map[string]string) ([]inventoryPackage, []string) {
+	var sources []string
+	for source := range manifests {
+		if path.Base(source) == "package.json" {
+			if _, found := manifests[path.Join(path.Dir(source), "package-lock.json")]; found {
+				continue
+			}
+		}
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	var packages []inventoryPackage
+	var read []string
+	for _, source := range sources {
+		content, err := ioutil.ReadFile(manifests[source])
+		if err == nil {
+			var sourcePackages []inventoryPackage
+			sourcePackages, err = inventoryParsers[path.Base(source)](content, source)
+			packages = append(packages, sourcePackages...)
+		}
+		if err != nil {
+			Warning.logf("Could not read the packages of %s: %v", source, err)
+			continue
+		}
+		read = append(read, source)
+	}
+	sort.SliceStable(packages, func(i, j int) bool {
+		if packages[i].Type != packages[j].Type {
+			return packages[i].Type < packages[j].Type
+		}
+		if packages[i].Name != packages[j].Name {
+			return packages[i].Name < packages[j].Name
+		}
+		if packages[i].Version != packages[j].Version {
+			return packages[i].Version < packages[j].Version
+		}
+		return packages[i].Range < packages[j].Range
+	})
+	// the same package may be declared by several manifests
+	var unique []inventoryPackage
+	for i, pkg := range packages {
+		if i > 0 && pkg.Type == packages[i-1].Type && pkg.Name == packages[i-1].Name && pkg.Version == packages[i-1].Version && pkg.Range == packages[i-1].Range {
+			continue
+		}
+		unique = append(unique, pkg)
+	}
+	return unique, read
+}
+
+// parsePackageLock reads the installed packages of a package-lock.json, the packages of lockfileVersion 2 and 3,
+// or the nested dependencies of lockfileVersion 1. The dev dependencies are not installed in the image.
+func parsePackageLock(content []byte, source string) ([]inventoryPackage, error) {
+	type lockDependency struct {
+		Version      string                     `json:"version"`
+		Dev          bool                       `json:"dev"`
+		Dependencies map[string]json.RawMessage `json:"dependencies"`
+	}
+	var lock struct {
+		Packages map[string]struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+			Link    bool   `json:"link"`
+			Dev     bool   `json:"dev"`
+		} `json:"packages"`
+		Dependencies map[string]json.RawMessage `json:"dependencies"`
+	}
+	err := json.Unmarshal(content, &lock)
+	if err != nil {
+		return nil, err
+	}
+	var packages []inventoryPackage
+	if len(lock.Packages) > 0 {
+		for location, lockPackage := range lock.Packages {
+			// the empty location is the project itself
+			if location == "" || lockPackage.Link || lockPackage.Dev {
+				continue
+			}
+			name := lockPackage.Name
+			if name == "" {
+				name = location[strings.LastIndex(location, "node_modules/")+len("node_modules/"):]
+			}
+			packages = append(packages, inventoryPackage{Type: "npm", Name: name, Version: lockPackage.Version, Source: source})
+		}
+		return packages, nil
+	}
+	var addDependencies func(dependencies map[string]json.RawMessage) error
+	addDependencies = func(dependencies map[string]json.RawMessage) error {
+		for name, raw := range dependencies {
+			var dependency lockDependency
+			err := json.Unmarshal(raw, &dependency)
+			if err != nil {
+				return err
+			}
+			// the dependencies of a dev dependency are dev dependencies too
+			if dependency.Dev {
+				continue
+			}
+			packages = append(packages, inventoryPackage{Type: "npm", Name: name, Version: dependency.Version, Source: source})
+			err = addDependencies(dependency.Dependencies)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return packages, addDependencies(lock.Dependencies)
+}
+
+// npmVersion matches the exact versions of the dependencies of a package.json, the other specifiers are ranges,
+// tags or locations
+var npmVersion = regexp.MustCompile(`^[=v]?(\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?)$`)
+
+// parsePackageJSON reads the declared dependencies of a package.json. Only the exact versions are versions,
+// the installed version of a range is not known without the package-lock.json.
+func parsePackageJSON(content []byte, source string) ([]inventoryPackage, error) {
+	var packageJSON struct {
+		Dependencies map[string]string `json:"dependencies"`
+	}
+	err := json.Unmarshal(content, &packageJSON)
+	if err != nil {
+		return nil, err
+	}
+	var packages []inventoryPackage
+	for name, specifier := range packageJSON.Dependencies {
+		pkg := inventoryPackage{Type: "npm", Name: name, Source: source}
+		if match := npmVersion.FindStringSubmatch(strings.TrimSpace(specifier)); match != nil {
+			pkg.Version = match[1]
+		} else {
+			pkg.Range = specifier
+		}
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
+
+// pomProperty matches the ${property} references of a pom.xml
+var pomProperty = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// parsePom reads the dependencies of a pom.xml, resolving the properties the pom defines.
+// The test dependencies are not packaged in the image.
+func parsePom(content []byte, source string) ([]inventoryPackage, error) {
+	var pom struct {
+		Version string `xml:"version"`
+		Parent  struct {
+			Version string `xml:"version"`
+		} `xml:"parent"`
+		Properties struct {
+			Entries []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:"properties"`
+		Dependencies []struct {
+			GroupID    string `xml:"groupId"`
+			ArtifactID string `xml:"artifactId"`
+			Version    string `xml:"version"`
+			Scope      string `xml:"scope"`
+		} `xml:"dependencies>dependency"`
+	}
+	err := xml.Unmarshal(content, &pom)
+	if err != nil {
+		return nil, err
+	}
+	properties := map[string]string{"project.version": pom.Version, "project.parent.version": pom.Parent.Version}
+	if pom.Version == "" {
+		properties["project.version"] = pom.Parent.Version
+	}
+	for _, entry := range pom.Properties.Entries {
+		properties[entry.XMLName.Local] = strings.TrimSpace(entry.Value)
+	}
+	var packages []inventoryPackage
+	for _, dependency := range pom.Dependencies {
+		if strings.TrimSpace(dependency.Scope) == "test" {
+			continue
+		}
+		version := pomProperty.ReplaceAllStringFunc(strings.TrimSpace(dependency.Version), func(reference string) string {
+			if value, found := properties[reference[2:len(reference)-1]]; found {
+				return value
+			}
+			return reference
+		})
+		name := strings.TrimSpace(dependency.GroupID) + ":" + strings.TrimSpace(dependency.ArtifactID)
+		pkg := inventoryPackage{Type: "maven", Name: name, Version: version, Source: source}
+		// a version range, or a property of a parent pom, is not the resolved version
+		if strings.ContainsAny(version, "[(,") || strings.Contains(version, "${") {
+			pkg.Version, pkg.Range = "", version
+		}
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
+
+// parseGoMod reads the required modules of a go.mod
+func parseGoMod(content []byte, source string) ([]inventoryPackage, error) {
+	var packages []inventoryPackage
+	inRequire := false
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if comment := strings.Index(line, "//"); comment >= 0 {
+			line = line[:comment]
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			continue
+		case inRequire && fields[0] == ")":
+			inRequire = false
+			continue
+		case fields[0] == "require" && len(fields) == 2 && fields[1] == "(":
+			inRequire = true
+			continue
+		case fields[0] == "require":
+			fields = fields[1:]
+		case !inRequire:
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, errors.Errorf("invalid require %s", strings.TrimSpace(line))
+		}
+		packages = append(packages, inventoryPackage{Type: "golang", Name: fields[0], Version: fields[1], Source: source})
+	}
+	return packages, scanner.Err()
+}
+
+// requirement matches the name and the version specifier of a line of requirements.txt
+var requirement = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)(\[[^\]]*\])?\s*(.*)$`)
+
+// parseRequirements reads the requirements of a requirements.txt. The version of a requirement pinned with == is
+// its version, the others have the range of their specifier.
+func parseRequirements(content []byte, source string) ([]inventoryPackage, error) {
+	// a line that ends with a backslash continues on the next line, unless it is a comment
+	var lines []string
+	continued := ""
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	for scanner.Scan() {
+		line := continued + scanner.Text()
+		if strings.HasSuffix(line, "\\") && !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continued = strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		lines = append(lines, line)
+		continued = ""
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	lines = append(lines, continued)
+
+	var packages []inventoryPackage
+	for _, line := range lines {
+		if comment := strings.Index(line, "#"); comment >= 0 {
+			line = line[:comment]
+		}
+		// environment markers do not change the package
+		line = strings.TrimSpace(strings.SplitN(line, ";", 2)[0])
+		// the options of a requirement, such as --hash, follow its specifier
+		if fields := strings.Fields(line); len(fields) > 1 {
+			for i, field := range fields[1:] {
+				if strings.HasPrefix(field, "-") {
+					line = strings.Join(fields[:i+1], " ")
+					break
+				}
+			}
+		}
+		// options, such as -r other.txt or --index-url, and URLs are not packages
+		if line == "" || strings.HasPrefix(line, "-") || strings.Contains(line, "://") {
+			continue
+		}
+		match := requirement.FindStringSubmatch(line)
+		if match == nil {
+			return nil, errors.Errorf("invalid requirement %s", line)
+		}
+		pkg := inventoryPackage{Type: "pypi", Name: match[1], Source: source}
+		specifier := strings.Replace(match[3], " ", "", -1)
+		if strings.HasPrefix(specifier, "==") && !strings.ContainsAny(specifier, ",*") {
+			pkg.Version = strings.TrimPrefix(specifier, "==")
+		} else {
+			pkg.Range = specifier
+		}
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
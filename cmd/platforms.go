@@ -0,0 +1,93 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// stackPlatformsLabel lists the platforms a stack image supports, separated by commas.
+// appsody stack package sets it from the platforms of stack.yaml.
+const stackPlatformsLabel = "dev.appsody.stack.platforms"
+
+// a platform is os/arch with an optional variant, such as linux/arm/v7
+var platformFormat = regexp.MustCompile(`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`)
+
+// parsePlatforms splits a comma separated list of platforms and checks their format
+func parsePlatforms(platforms string) ([]string, error) {
+	var parsed []string
+	for _, platform := range strings.Split(platforms, ",") {
+		platform = strings.TrimSpace(platform)
+		if platform == "" {
+			continue
+		}
+		if !platformFormat.MatchString(platform) {
+			return nil, errors.Errorf("Invalid platform %s, use the os/arch[/variant] format, for example linux/amd64 or linux/arm64", platform)
+		}
+		parsed = append(parsed, platform)
+	}
+	return uniqueStrings(parsed), nil
+}
+
+// checkStackPlatforms returns an error if the stack declares the platforms it supports and one of the platforms is not
+func checkStackPlatforms(config *RootCommandConfig, platforms []string) error {
+	stackImage, err := inspectStackImage(config)
+	if err != nil {
+		return err
+	}
+	stackPlatforms, err := parsePlatforms(stackImage.Config.Labels[stackPlatformsLabel])
+	if err != nil {
+		return errors.Errorf("The %s label of the stack image is not valid: %v", stackPlatformsLabel, err)
+	}
+	if len(stackPlatforms) == 0 {
+		Debug.log("The stack does not declare the platforms it supports")
+		return nil
+	}
+	var unsupported []string
+	for _, platform := range platforms {
+		if !containsPlatform(stackPlatforms, platform) {
+			unsupported = append(unsupported, platform)
+		}
+	}
+	if len(unsupported) > 0 {
+		projectConfig, _ := getProjectConfig(config)
+		return errors.Errorf("The stack %s does not support the platforms %s. Supported platforms: %s", projectConfig.Platform, strings.Join(unsupported, ", "), strings.Join(stackPlatforms, ", "))
+	}
+	return nil
+}
+
+// containsPlatform reports whether the stack platforms support the platform. A stack platform without variant
+// supports all the variants, a stack platform with a variant only supports that variant.
+func containsPlatform(stackPlatforms []string, platform string) bool {
+	platform = normalizePlatform(platform)
+	for _, stackPlatform := range stackPlatforms {
+		stackPlatform = normalizePlatform(stackPlatform)
+		if stackPlatform == platform || (strings.Count(stackPlatform, "/") == 1 && strings.HasPrefix(platform, stackPlatform+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizePlatform adds the variant of arm64, which only has v8
+func normalizePlatform(platform string) string {
+	if strings.HasSuffix(platform, "/arm64") && strings.Count(platform, "/") == 1 {
+		return platform + "/v8"
+	}
+	return platform
+}
@@ -0,0 +1,72 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd"
+	"github.com/appsody/appsody/cmd/cmdtest"
+)
+
+func TestBuildPlatforms(t *testing.T) {
+	project, cleanup := newTestProject(t, "platforms-project", "test/platforms-stack:0.1",
+		`{"Id": "sha256:9abc", "Config": {"Env": ["APPSODY_MOUNTS=.:/project/user-app", "APPSODY_PROJECT_DIR=/project"], "Labels": {"dev.appsody.stack.platforms": "linux/amd64,linux/arm64/v8"}}}`)
+	defer cleanup()
+
+	output, err := cmdtest.RunAppsodyCmd(project.appsodyArgs("build", "--dryrun", "-t", "registry.example.com/platforms:1.0", "--platform", "linux/amd64,linux/arm64", "--push"), project.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "docker buildx build --platform linux/amd64,linux/arm64 -t registry.example.com/platforms:1.0 --push --metadata-file"
+	if !strings.Contains(output, expected) {
+		t.Errorf("Expected %s. CLI output:\n%s", expected, output)
+	}
+
+	// the build fails before the extract when the stack does not support a platform
+	output, err = cmdtest.RunAppsodyCmdExec(project.appsodyArgs("build", "--dryrun", "--platform", "linux/amd64,linux/s390x"), project.dir)
+	if err == nil {
+		t.Fatalf("Expected the build for linux/s390x to fail. CLI output:\n%s", output)
+	}
+	expected = "does not support the platforms linux/s390x. Supported platforms: linux/amd64, linux/arm64/v8"
+	if !strings.Contains(output, expected) || strings.Contains(output, "Extracting project") {
+		t.Errorf("Expected the build to fail before extracting the project with %s. CLI output:\n%s", expected, output)
+	}
+}
+
+func TestContainsPlatform(t *testing.T) {
+	var tests = []struct {
+		stackPlatforms []string
+		platform       string
+		supported      bool
+	}{
+		{[]string{"linux/amd64", "linux/arm64"}, "linux/amd64", true},
+		{[]string{"linux/amd64"}, "linux/s390x", false},
+		// a stack platform without variant supports all the variants
+		{[]string{"linux/arm"}, "linux/arm/v7", true},
+		{[]string{"linux/arm"}, "linux/arm", true},
+		// a stack platform with a variant only supports that variant
+		{[]string{"linux/arm/v7"}, "linux/arm", false},
+		{[]string{"linux/arm/v7"}, "linux/arm/v6", false},
+		// arm64 only has the v8 variant
+		{[]string{"linux/arm64/v8"}, "linux/arm64", true},
+		{[]string{"linux/arm64"}, "linux/arm64/v8", true},
+	}
+	for _, tt := range tests {
+		if supported := cmd.ContainsPlatform(tt.stackPlatforms, tt.platform); supported != tt.supported {
+			t.Errorf("Expected the support of %s by the stack platforms %v to be %v", tt.platform, tt.stackPlatforms, tt.supported)
+		}
+	}
+}
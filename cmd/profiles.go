@@ -0,0 +1,111 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// RunProfile is a named set of run, debug and test options stored under profiles: in
+// .appsody-config.yaml. The keys are the names of the corresponding flags, for example:
+//
+//	profiles:
+//	  integration:
+//	    network: integration-net
+//	    publish: ["9080:9080"]
+//	    no-watcher: true
+//	    env: ["DB_HOST=db"]
+type RunProfile struct {
+	Ports           []string `mapstructure:"publish"`
+	PublishAllPorts *bool    `mapstructure:"publish-all"`
+	AutoPorts       *bool    `mapstructure:"auto-ports"`
+	Network         string   `mapstructure:"network"`
+	DepsVolume      string   `mapstructure:"deps-volume"`
+	DockerOptions   string   `mapstructure:"docker-options"`
+	Interactive     *bool    `mapstructure:"interactive"`
+	NoWatcher       *bool    `mapstructure:"no-watcher"`
+	Name            string   `mapstructure:"name"`
+	Env             []string `mapstructure:"env"`
+}
+
+func addProfileFlag(cmd *cobra.Command, config *devCommonConfig) {
+	cmd.PersistentFlags().StringVar(&config.profile, "profile", "", "Apply a named profile from the profiles section of .appsody-config.yaml. Flags given on the command line take precedence over the profile.")
+}
+
+// applyRunProfile sets the options of the profile selected with --profile,
+// except the ones whose flags were given on the command line
+func applyRunProfile(cmd *cobra.Command, config *devCommonConfig) error {
+	if config.profile == "" {
+		return nil
+	}
+	projectConfig, err := getProjectConfig(config.RootCommandConfig)
+	if err != nil {
+		return err
+	}
+	// viper lower cases the keys of the config file
+	profile, found := projectConfig.Profiles[strings.ToLower(config.profile)]
+	if !found {
+		var names []string
+		for name := range projectConfig.Profiles {
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			return errors.Errorf("Profile %s not found: the project config %s does not define any profiles", config.profile, ConfigFile)
+		}
+		sort.Strings(names)
+		return errors.Errorf("Profile %s not found in %s. Available profiles: %s", config.profile, ConfigFile, strings.Join(names, ", "))
+	}
+	Debug.logf("Applying profile %s: %+v", config.profile, profile)
+	for _, env := range profile.Env {
+		if !strings.Contains(env, "=") {
+			return errors.Errorf("Invalid env entry %s in profile %s, use NAME=value", env, config.profile)
+		}
+	}
+
+	flags := cmd.Flags()
+	if profile.Ports != nil && !flags.Changed("publish") {
+		config.ports = profile.Ports
+	}
+	if profile.PublishAllPorts != nil && !flags.Changed("publish-all") {
+		config.publishAllPorts = *profile.PublishAllPorts
+	}
+	if profile.AutoPorts != nil && !flags.Changed("auto-ports") {
+		config.autoPorts = *profile.AutoPorts
+	}
+	if profile.Network != "" && !flags.Changed("network") {
+		config.dockerNetwork = profile.Network
+	}
+	if profile.DepsVolume != "" && !flags.Changed("deps-volume") {
+		config.depsVolumeName = profile.DepsVolume
+	}
+	if profile.DockerOptions != "" && !flags.Changed("docker-options") {
+		config.dockerOptions = profile.DockerOptions
+	}
+	if profile.Interactive != nil && !flags.Changed("interactive") {
+		config.interactive = *profile.Interactive
+	}
+	if profile.NoWatcher != nil && !flags.Changed("no-watcher") {
+		config.disableWatcher = *profile.NoWatcher
+	}
+	if profile.Name != "" && !flags.Changed("name") {
+		config.containerName = profile.Name
+	}
+	config.envVars = profile.Env
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd/cmdtest"
+)
+
+const profilesProjectConfig = `stack: test/profile-stack:0.1.0
+profiles:
+  integration:
+    network: integration-net
+    no-watcher: true
+    docker-options: "--memory 512m"
+    env: ["DB_HOST=db"]
+`
+
+var profileTests = []struct {
+	testName string
+	args     []string
+	expected []string // strings expected in the docker run command
+	excluded []string // strings not expected in the docker run command
+}{
+	{"no profile", nil, nil, []string{"integration-net", "--no-watcher", "DB_HOST=db"}},
+	{"profile", []string{"--profile", "integration"}, []string{"--network integration-net", "--no-watcher", "-e DB_HOST=db", "--memory 512m"}, nil},
+	{"flag overrides profile", []string{"--profile", "integration", "--network", "other-net"}, []string{"--network other-net", "--no-watcher"}, []string{"integration-net"}},
+}
+
+func TestRunProfile(t *testing.T) {
+	project, cleanup := newTestProject(t, "profile-project", "test/profile-stack:0.1.0",
+		`{"Id": "sha256:5678", "Config": {"Env": ["APPSODY_MOUNTS=.:/project/user-app"], "ExposedPorts": {}}}`)
+	defer cleanup()
+	project.writeFiles(t, map[string]string{".appsody-config.yaml": profilesProjectConfig})
+
+	for _, tt := range profileTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			args := append(project.appsodyArgs("run", "--dryrun"), tt.args...)
+			output, err := cmdtest.RunAppsodyCmd(args, project.dir)
+			if err != nil {
+				t.Fatalf("%v. CLI output:\n%s", err, output)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(output, expected) {
+					t.Errorf("Expected %s in the docker run command. CLI output:\n%s", expected, output)
+				}
+			}
+			for _, excluded := range tt.excluded {
+				if strings.Contains(output, excluded) {
+					t.Errorf("Did not expect %s in the docker run command. CLI output:\n%s", excluded, output)
+				}
+			}
+		})
+	}
+}
+
+func TestRunProfileNotFound(t *testing.T) {
+	projectDir, err := ioutil.TempDir("", "appsody-profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(projectDir)
+	err = ioutil.WriteFile(filepath.Join(projectDir, ".appsody-config.yaml"), []byte(profilesProjectConfig), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := cmdtest.RunAppsodyCmdExec([]string{"run", "--dryrun", "--profile", "missing"}, projectDir)
+	if err == nil || !strings.Contains(output, "Available profiles: integration") {
+		t.Errorf("Expected an error listing the available profiles. CLI output:\n%s", output)
+	}
+}
@@ -15,8 +15,6 @@
 package cmd
 
 import (
-	"bufio"
-	"os/exec"
 	"strings"
 
 	"github.com/gosuri/uitable"
@@ -40,7 +38,7 @@ func newPsCmd(rootConfig *RootCommandConfig) *cobra.Command {
 		Long:  `This command lists all stack-based containers, that are currently running in the local docker envionment.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 
-			containers, err := listContainers()
+			containers, err := listContainers(rootConfig)
 			if err != nil {
 				return err
 			}
@@ -58,51 +56,25 @@ func newPsCmd(rootConfig *RootCommandConfig) *cobra.Command {
 	return psCmd
 }
 
-func listContainers() ([]StackContainer, error) {
+func listContainers(config *RootCommandConfig) ([]StackContainer, error) {
 	var containers = []StackContainer{}
-
-	// We are going to do a 'docker ps' and parse the output into fields. At least one of these
-	// fields can have white space in it (Status), so we need a way of splitting up the output.
-	// To do this we use the --format option and include a string of illegal characters as a
-	// seperator, which we then subsequently use to parse.
-	strSep := "$!$!$!"
-	cmdName := "docker"
-	cmdArgs := []string{
-		"ps",
-		"--no-trunc",
-		"--format",
-		"{{.ID}}" + strSep + "{{.Image}}" + strSep + "{{.Status}}" +
-			strSep + "{{.Names}}" + strSep + "{{.Command}}"}
-
-	cmd := exec.Command(cmdName, cmdArgs...)
-	cmdReader, err := cmd.StdoutPipe()
+	engine, err := getContainerEngine(config)
 	if err != nil {
-		Error.log("Error creating StdoutPipe for Cmd", err)
 		return nil, err
 	}
-
-	outScanner := bufio.NewScanner(cmdReader)
-	outScanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
-	go func() {
-		for outScanner.Scan() {
-			fields := strings.Split(outScanner.Text(), strSep)
-			if strings.Contains(fields[4], "appsody-controller") {
-				containers = append(containers, StackContainer{fields[0][0:12], fields[1], fields[2], fields[3]})
-			}
-		}
-	}()
-
-	err = cmd.Start()
+	allContainers, err := engine.ListContainers(false)
 	if err != nil {
-		Error.log("Error running command", err)
 		return nil, err
 	}
-	err = cmd.Wait()
-	if err != nil {
-		Error.log("Error waiting for command", err)
-		return nil, err
+	for _, container := range allContainers {
+		if strings.Contains(container.Command, "appsody-controller") {
+			id := container.ID
+			if len(id) > 12 {
+				id = id[0:12]
+			}
+			containers = append(containers, StackContainer{id, container.Image, container.Status, container.Names})
+		}
 	}
-
 	return containers, nil
 }
 
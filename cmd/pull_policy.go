@@ -0,0 +1,206 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	pullAlways  = "always"
+	pullIfStale = "if-stale"
+	pullMissing = "missing"
+	pullNever   = "never"
+)
+
+var pullPolicies = []string{pullAlways, pullIfStale, pullMissing, pullNever}
+
+// a tag with a full version, such as 1.2.3 or v1.2.3-beta, is not expected to move
+var fixedVersionTag = regexp.MustCompile(`^v?[0-9]+\.[0-9]+\.[0-9]+([-+].*)?$`)
+
+func addPullPolicyFlag(cmd *cobra.Command, config *RootCommandConfig) {
+	cmd.PersistentFlags().StringVar(&config.PullPolicy, "pull", "", "When to pull the stack image: always, if-stale, missing or never. if-stale pulls floating tags such as latest at most once per pullinterval, and does not pull the fixed versions that are available locally. Defaults to APPSODY_PULL_POLICY, then to the pullpolicy config setting (if-stale).")
+}
+
+// getPullPolicy returns the --pull flag, or APPSODY_PULL_POLICY, or the pullpolicy config setting.
+// The Always and IfNotPresent values of APPSODY_PULL_POLICY are still accepted. Any other unknown value
+// is an error, where earlier versions of appsody fell back to always pulling.
+func getPullPolicy(config *RootCommandConfig) (string, error) {
+	policy := config.PullPolicy
+	source := "--pull"
+	if policy == "" {
+		policy = os.Getenv("APPSODY_PULL_POLICY")
+		source = "APPSODY_PULL_POLICY"
+	}
+	if policy == "" {
+		policy = config.CliConfig.GetString("pullpolicy")
+		source = "the pullpolicy config setting"
+	}
+	switch strings.ToLower(policy) {
+	case pullAlways:
+		return pullAlways, nil
+	case pullIfStale:
+		return pullIfStale, nil
+	case pullMissing, "ifnotpresent":
+		return pullMissing, nil
+	case pullNever:
+		return pullNever, nil
+	}
+	if source == "APPSODY_PULL_POLICY" {
+		// it was ignored before the pull policies
+		return "", errors.Errorf("Invalid pull policy %s in %s, which is no longer treated as always. Use one of: %s, or IfNotPresent", policy, source, strings.Join(pullPolicies, ", "))
+	}
+	return "", errors.Errorf("Invalid pull policy %s in %s. Use one of: %s", policy, source, strings.Join(pullPolicies, ", "))
+}
+
+// isFloatingTag reports whether the image reference can point to a different image over time.
+// Images referenced by digest or by a full version tag are considered fixed.
+func isFloatingTag(image string) bool {
+	if strings.Contains(image, "@") {
+		return false
+	}
+	repository, tag := splitImageTag(image)
+	if repository == image || tag == "latest" {
+		return true
+	}
+	return !fixedVersionTag.MatchString(tag)
+}
+
+func getPullTimesFile(config *RootCommandConfig, engine ContainerEngine) string {
+	return filepath.Join(getHome(config), "cache", "pulls-"+engine.Command()+".json")
+}
+
+// loadPullTimes reads the time each image was last pulled, a missing or unreadable file gives no times
+func loadPullTimes(pullTimesFile string) map[string]time.Time {
+	pullTimes := map[string]time.Time{}
+	pullTimesBytes, err := ioutil.ReadFile(pullTimesFile)
+	if err != nil {
+		return pullTimes
+	}
+	err = json.Unmarshal(pullTimesBytes, &pullTimes)
+	if err != nil {
+		Debug.log("Ignoring the image pull times ", pullTimesFile, ": ", err)
+		return map[string]time.Time{}
+	}
+	return pullTimes
+}
+
+func savePullTime(pullTimesFile string, image string) error {
+	pullTimes := loadPullTimes(pullTimesFile)
+	pullTimes[image] = time.Now()
+	pullTimesBytes, err := json.MarshalIndent(pullTimes, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(pullTimesFile, pullTimesBytes, 0644)
+}
+
+// pulledRecently reports whether the image was pulled within the pullinterval config setting
+func pulledRecently(image string, config *RootCommandConfig, engine ContainerEngine) bool {
+	interval, err := time.ParseDuration(config.CliConfig.GetString("pullinterval"))
+	if err != nil {
+		Warning.log("Ignoring the pullinterval config setting: ", err)
+		return false
+	}
+	lastPull, found := loadPullTimes(getPullTimesFile(config, engine))[image]
+	if !found {
+		return false
+	}
+	Debug.log("Image ", image, " was last pulled at ", lastPull)
+	return time.Since(lastPull) < interval
+}
+
+//pullImage
+// pulls the stack image according to the pull policy:
+// always pulls the image.
+// if-stale pulls the image, unless it is available locally and either has a fixed version or
+// was pulled within the pullinterval.
+// missing only pulls the image when it is not available locally.
+// never does not pull, the image must be available locally.
+func pullImage(imageToPull string, config *RootCommandConfig) error {
+	if config.imagePulled == nil {
+		config.imagePulled = make(map[string]bool)
+	}
+	Debug.logf("%s image pulled status: %t", imageToPull, config.imagePulled[imageToPull])
+	if config.imagePulled[imageToPull] {
+		Debug.log("Image has been pulled already: ", imageToPull)
+		return nil
+	}
+	engine, engineErr := getContainerEngine(config)
+	if engineErr != nil {
+		return engineErr
+	}
+	policy, policyErr := getPullPolicy(config)
+	if policyErr != nil {
+		return policyErr
+	}
+	Debug.log("Pull policy ", policy)
+	config.imagePulled[imageToPull] = true
+
+	localImageFound := engine.ImageExists(imageToPull)
+	switch policy {
+	case pullNever:
+		if !localImageFound && !config.Dryrun {
+			return errors.Errorf("The image %s is not available locally and the pull policy is never. Load the image, or use --pull=missing or --pull=always", imageToPull)
+		}
+		Info.log("Using local cache for image ", imageToPull)
+		return nil
+	case pullMissing:
+		if localImageFound {
+			Info.log("Using local cache for image ", imageToPull)
+			return nil
+		}
+	case pullIfStale:
+		if localImageFound {
+			if !isFloatingTag(imageToPull) {
+				Debug.log("Image ", imageToPull, " has a fixed version, not pulling it again")
+				Info.log("Using local cache for image ", imageToPull)
+				return nil
+			}
+			if pulledRecently(imageToPull, config, engine) {
+				Debug.log("Image ", imageToPull, " was pulled within the pull interval, not pulling it again")
+				Info.log("Using local cache for image ", imageToPull)
+				return nil
+			}
+		}
+	}
+
+	logPhase(phasePulling, imageToPull)
+	err := engine.Pull(imageToPull, config.Dryrun)
+	if err != nil {
+		if !localImageFound {
+			return errors.Errorf("Could not find the image either in docker hub or locally: %s", imageToPull)
+		}
+		Info.log("Using local cache for image ", imageToPull)
+		return nil
+	}
+	if !config.Dryrun {
+		invalidateImageCache(config, imageToPull)
+		saveErr := savePullTime(getPullTimesFile(config, engine), imageToPull)
+		if saveErr != nil {
+			Warning.log("Could not record the pull time of image ", imageToPull, ": ", saveErr)
+		}
+	}
+	return nil
+}
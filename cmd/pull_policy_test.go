@@ -0,0 +1,111 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd"
+	"github.com/spf13/viper"
+)
+
+func TestPullPolicy(t *testing.T) {
+	pulls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/images/create", func(w http.ResponseWriter, r *http.Request) {
+		pulls++
+		_, _ = w.Write([]byte(`{"status": "Pulling from test/stack"}`))
+	})
+	mux.HandleFunc("/images/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/images/test/missing") {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message": "No such image"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"Id": "sha256:aaaa", "Config": {"Env": ["PORT=3000"]}}`))
+	})
+	dockerHost, cleanup := startFakeDockerDaemon(t, mux)
+	defer cleanup()
+
+	home, err := ioutil.TempDir("", "appsody-pull-policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	os.Setenv("DOCKER_HOST", dockerHost)
+	defer os.Unsetenv("DOCKER_HOST")
+
+	var tests = []struct {
+		testName      string
+		image         string
+		pullFlag      string
+		configPolicy  string
+		envPolicy     string
+		expectedPulls int
+		expectedError string
+	}{
+		{"Never with a local image", "test/stack:0.2", "never", "", "", 0, ""},
+		{"Never without a local image", "test/missing:0.2", "never", "", "", 0, "is not available locally and the pull policy is never"},
+		{"Never from the config", "test/missing:0.2", "", "never", "", 0, "is not available locally and the pull policy is never"},
+		{"Missing with a local image", "test/stack:0.2", "missing", "", "", 0, ""},
+		{"Missing without a local image", "test/missing:0.2", "missing", "", "", 1, "Could not inspect the image"},
+		{"IfNotPresent from the environment", "test/stack:0.2", "", "", "IfNotPresent", 0, ""},
+		{"Default with a fixed version", "test/stack:1.2.3", "", "", "", 0, ""},
+		{"Default with a floating tag", "test/stack:0.2", "", "", "", 1, ""},
+		{"Default with a recently pulled floating tag", "test/stack:0.2", "", "", "", 0, ""},
+		{"If-stale from the command line with a recently pulled floating tag", "test/stack:0.2", "if-stale", "", "", 0, ""},
+		{"Always from the command line", "test/stack:0.2", "always", "", "", 1, ""},
+		{"Always from the config with a recently pulled floating tag", "test/stack:0.2", "", "always", "", 1, ""},
+		{"Always from the config with a fixed version", "test/stack:1.2.3", "", "always", "", 1, ""},
+		{"Always from the environment", "test/stack:1.2.3", "", "if-stale", "Always", 1, ""},
+		{"Invalid policy", "test/stack:0.2", "sometimes", "", "", 0, "Invalid pull policy sometimes in --pull"},
+		{"Invalid policy in the environment", "test/stack:0.2", "", "", "sometimes", 0, "Invalid pull policy sometimes in APPSODY_PULL_POLICY, which is no longer treated as always"},
+	}
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			pulls = 0
+			cliConfig := viper.New()
+			cliConfig.Set("home", home)
+			cliConfig.SetDefault("pullpolicy", "if-stale")
+			cliConfig.SetDefault("pullinterval", "24h")
+			if test.configPolicy != "" {
+				cliConfig.Set("pullpolicy", test.configPolicy)
+			}
+			if test.envPolicy != "" {
+				os.Setenv("APPSODY_PULL_POLICY", test.envPolicy)
+				defer os.Unsetenv("APPSODY_PULL_POLICY")
+			}
+			config := &cmd.RootCommandConfig{
+				Engine:        "docker-api",
+				PullPolicy:    test.pullFlag,
+				CliConfig:     cliConfig,
+				ProjectConfig: &cmd.ProjectConfig{Platform: test.image},
+			}
+			_, err := cmd.GetEnvVar("PORT", config)
+			if test.expectedError == "" && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if test.expectedError != "" && (err == nil || !strings.Contains(err.Error(), test.expectedError)) {
+				t.Errorf("Expected an error containing %s but got %v", test.expectedError, err)
+			}
+			if pulls != test.expectedPulls {
+				t.Errorf("Expected %d pulls but found %d", test.expectedPulls, pulls)
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// dockerHubRegistry is the registry of the repositories without a registry host, as docker login names it
+const dockerHubRegistry = "https://index.docker.io/v1/"
+
+// registryCredentials are the credentials of a registry
+type registryCredentials struct {
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	ServerAddress string `json:"serveraddress,omitempty"`
+}
+
+// explicitCredentials are the credentials given on the command line, by registry
+var explicitCredentials = map[string]registryCredentials{}
+
+// The attempts to push an image, and the delay before the first retry, which doubles for each retry
+const pushAttempts = 3
+
+var pushRetryDelay = 2 * time.Second
+
+// registryOf returns the registry of the repository, the Docker Hub when it has no registry host
+func registryOf(repository string) string {
+	if hasRegistry(repository) {
+		return repository[:strings.Index(repository, "/")]
+	}
+	return dockerHubRegistry
+}
+
+// sameRegistry compares a server of the docker config with a registry, ignoring the scheme
+func sameRegistry(server string, registry string) bool {
+	trim := func(address string) string {
+		address = strings.TrimPrefix(strings.TrimPrefix(address, "https://"), "http://")
+		return strings.TrimSuffix(address, "/")
+	}
+	return server == registry || trim(server) == trim(registry)
+}
+
+// lookupCredentials returns the credentials of the registry of the repository: the ones given on the command line,
+// or the ones stored by docker login in the docker config file, either in the file or in a credential helper.
+// The credentials are empty when there are none.
+func lookupCredentials(repository string) registryCredentials {
+	registry := registryOf(repository)
+	if credentials, found := explicitCredentials[registry]; found {
+		return credentials
+	}
+	dockerConfigDir := os.Getenv("DOCKER_CONFIG")
+	if dockerConfigDir == "" {
+		dockerConfigDir = filepath.Join(UserHomeDir(), ".docker")
+	}
+	var dockerConfig struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+		CredsStore  string            `json:"credsStore"`
+		CredHelpers map[string]string `json:"credHelpers"`
+	}
+	configBytes, err := ioutil.ReadFile(filepath.Join(dockerConfigDir, "config.json"))
+	if err != nil || json.Unmarshal(configBytes, &dockerConfig) != nil {
+		Debug.log("No credentials for ", registry, ": could not read the docker config in ", dockerConfigDir)
+		return registryCredentials{}
+	}
+	for server, helper := range dockerConfig.CredHelpers {
+		if sameRegistry(server, registry) {
+			return credentialsFromHelper(helper, server)
+		}
+	}
+	for server, serverAuth := range dockerConfig.Auths {
+		if !sameRegistry(server, registry) {
+			continue
+		}
+		if serverAuth.Auth == "" && dockerConfig.CredsStore != "" {
+			// docker login records the server, the credentials are in the store
+			return credentialsFromHelper(dockerConfig.CredsStore, server)
+		}
+		decoded, decodeErr := base64.StdEncoding.DecodeString(serverAuth.Auth)
+		if decodeErr != nil {
+			Debug.log("Could not decode the credentials for ", server, ": ", decodeErr)
+			return registryCredentials{}
+		}
+		userPassword := strings.SplitN(string(decoded), ":", 2)
+		if len(userPassword) == 2 {
+			return registryCredentials{Username: userPassword[0], Password: userPassword[1], ServerAddress: server}
+		}
+		return registryCredentials{}
+	}
+	if dockerConfig.CredsStore != "" {
+		return credentialsFromHelper(dockerConfig.CredsStore, registry)
+	}
+	return registryCredentials{}
+}
+
+// credentialsFromHelper gets the credentials of the server from the docker-credential-<helper> program
+func credentialsFromHelper(helper string, server string) registryCredentials {
+	helperCmd := exec.Command("docker-credential-"+helper, "get")
+	helperCmd.Stdin = strings.NewReader(server)
+	output, err := helperCmd.Output()
+	if err != nil {
+		Debug.log("The credential helper ", helper, " has no credentials for ", server, ": ", err)
+		return registryCredentials{}
+	}
+	var helperCredentials struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	err = json.Unmarshal(output, &helperCredentials)
+	if err != nil {
+		Debug.log("Could not decode the credentials of the credential helper ", helper, ": ", err)
+		return registryCredentials{}
+	}
+	return registryCredentials{Username: helperCredentials.Username, Password: helperCredentials.Secret, ServerAddress: server}
+}
+
+// readPasswordStdin reads the password given with --password-stdin
+func readPasswordStdin() (string, error) {
+	password, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return "", errors.Errorf("Could not read the password from stdin: %v", err)
+	}
+	trimmed := strings.TrimRight(string(password), "\r\n")
+	if trimmed == "" {
+		return "", errors.New("The password read from stdin is empty")
+	}
+	return trimmed, nil
+}
+
+// loginConfigDir is the temporary docker config directory the engine commands log in to with the explicit credentials,
+// so that they are not stored in the docker config of the user. loginEnv has the variables it replaced.
+var (
+	loginConfigDir string
+	loginEnv       map[string]*string
+)
+
+// The variables that point docker, and podman and buildah, to the credentials of loginConfigDir
+var loginEnvVars = []string{"DOCKER_CONFIG", "REGISTRY_AUTH_FILE"}
+
+// useLoginConfig creates loginConfigDir and points the engine commands run after it to it.
+// The CLI plugins and buildx builders of the docker config of the user are linked in it, so that buildx still works,
+// and its config.json starts with the credentials of the user, so that the FROM images of private registries are still pulled.
+func useLoginConfig() error {
+	if loginConfigDir != "" {
+		return nil
+	}
+	configDir, err := ioutil.TempDir("", "appsody-login")
+	if err != nil {
+		return errors.Errorf("Could not create the temporary docker config directory to log in: %v", err)
+	}
+	userConfigDir := os.Getenv("DOCKER_CONFIG")
+	if userConfigDir == "" {
+		userConfigDir = filepath.Join(UserHomeDir(), ".docker")
+	}
+	for _, shared := range []string{"cli-plugins", "buildx"} {
+		if _, statErr := os.Stat(filepath.Join(userConfigDir, shared)); statErr == nil {
+			linkErr := os.Symlink(filepath.Join(userConfigDir, shared), filepath.Join(configDir, shared))
+			if linkErr != nil {
+				Debug.log("Could not link ", shared, " of the docker config: ", linkErr)
+			}
+		}
+	}
+	err = copyUserCredentials(filepath.Join(userConfigDir, "config.json"), filepath.Join(configDir, "config.json"))
+	if err != nil {
+		os.RemoveAll(configDir)
+		return errors.Errorf("Could not copy the credentials of the docker config to the temporary docker config: %v", err)
+	}
+	loginEnv = map[string]*string{}
+	for _, name := range loginEnvVars {
+		if value, found := os.LookupEnv(name); found {
+			loginEnv[name] = &value
+		} else {
+			loginEnv[name] = nil
+		}
+	}
+	os.Setenv("DOCKER_CONFIG", configDir)
+	os.Setenv("REGISTRY_AUTH_FILE", filepath.Join(configDir, "config.json"))
+	loginConfigDir = configDir
+	Debug.log("Logging in with the temporary docker config ", configDir)
+	return nil
+}
+
+// copyUserCredentials writes the docker config of the user, with its credentials, credential store and helpers,
+// to the config file, and adds the registries of the podman and buildah auth file that the docker config does not have
+func copyUserCredentials(userConfigFile string, configFile string) error {
+	config := map[string]interface{}{}
+	configBytes, err := ioutil.ReadFile(userConfigFile)
+	if err == nil {
+		err = json.Unmarshal(configBytes, &config)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	authFile := os.Getenv("REGISTRY_AUTH_FILE")
+	if authFile == "" && os.Getenv("XDG_RUNTIME_DIR") != "" {
+		authFile = filepath.Join(os.Getenv("XDG_RUNTIME_DIR"), "containers", "auth.json")
+	}
+	var podmanAuths struct {
+		Auths map[string]interface{} `json:"auths"`
+	}
+	if authBytes, readErr := ioutil.ReadFile(authFile); authFile != "" && readErr == nil && json.Unmarshal(authBytes, &podmanAuths) == nil && len(podmanAuths.Auths) > 0 {
+		auths, _ := config["auths"].(map[string]interface{})
+		if auths == nil {
+			auths = map[string]interface{}{}
+		}
+		for server, auth := range podmanAuths.Auths {
+			if _, found := auths[server]; !found {
+				auths[server] = auth
+			}
+		}
+		config["auths"] = auths
+	}
+	if len(config) == 0 {
+		return nil
+	}
+	configBytes, err = json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(configFile, configBytes, 0600)
+}
+
+// useFileCredentials makes the login to the registry store its credentials in the config.json of loginConfigDir,
+// with an empty credential helper, rather than in the credential store of the user
+func useFileCredentials(registry string) error {
+	configFile := filepath.Join(loginConfigDir, "config.json")
+	config := map[string]interface{}{}
+	configBytes, err := ioutil.ReadFile(configFile)
+	if err == nil {
+		err = json.Unmarshal(configBytes, &config)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if _, found := config["credsStore"]; !found && config["credHelpers"] == nil {
+		return nil
+	}
+	credHelpers, _ := config["credHelpers"].(map[string]interface{})
+	if credHelpers == nil {
+		credHelpers = map[string]interface{}{}
+	}
+	credHelpers[registry] = ""
+	// docker looks up the helper by host name for the pulls and pushes
+	if host := strings.TrimSuffix(strings.TrimPrefix(registry, "https://"), "/v1/"); host != registry {
+		credHelpers[host] = ""
+	}
+	config["credHelpers"] = credHelpers
+	configBytes, err = json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(configFile, configBytes, 0600)
+}
+
+// removeLoginConfig removes loginConfigDir with the credentials, and restores the variables it replaced
+func removeLoginConfig() {
+	if loginConfigDir == "" {
+		return
+	}
+	for name, value := range loginEnv {
+		if value == nil {
+			os.Unsetenv(name)
+		} else {
+			os.Setenv(name, *value)
+		}
+	}
+	err := os.RemoveAll(loginConfigDir)
+	if err != nil {
+		Warning.log("Could not remove the temporary docker config ", loginConfigDir, ": ", err)
+	}
+	loginConfigDir = ""
+	loginEnv = nil
+}
+
+// loginCommand runs <command> login with the explicit credentials of the registry, in loginConfigDir,
+// so that the command line of the engine can push to it
+func loginCommand(command string, registry string, dryrun bool) error {
+	credentials, found := explicitCredentials[registry]
+	if !found {
+		return nil
+	}
+	loginArgs := []string{"login", "--username", credentials.Username, "--password-stdin"}
+	if registry != dockerHubRegistry {
+		loginArgs = append(loginArgs, registry)
+	}
+	if dryrun {
+		Info.log("Dry run - skipping execution of: ", command, " ", strings.Join(loginArgs, " "))
+		return nil
+	}
+	err := useLoginConfig()
+	if err == nil {
+		err = useFileCredentials(registry)
+	}
+	if err != nil {
+		return err
+	}
+	Debug.log("Running command: ", command, " ", strings.Join(loginArgs, " "))
+	loginCmd := exec.Command(command, loginArgs...)
+	loginCmd.Stdin = strings.NewReader(credentials.Password)
+	var stderr bytes.Buffer
+	loginCmd.Stderr = &stderr
+	_, err = loginCmd.Output()
+	if err != nil {
+		return errors.Errorf("Could not log in to %s as %s: %v %s", registry, credentials.Username, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// The errors of a push that may succeed if it is retried: network failures and the 5xx statuses of the registry
+var transientPushErrors = regexp.MustCompile(`connection refused|connection reset|broken pipe|timeout|timed out|unexpected eof|temporary failure in name resolution|network is unreachable|server misbehaving|(status|code):? 5\d\d|5\d\d (internal server error|bad gateway|service unavailable|gateway timeout)`)
+
+// isTransientPushError reports whether a push may succeed if it is retried. Other failures,
+// such as the registry refusing the credentials or a missing image, are not retried.
+func isTransientPushError(err error) bool {
+	return transientPushErrors.MatchString(strings.ToLower(err.Error()))
+}
+
+// pushWithRetries pushes the image, retrying transient failures, and returns its digest
+func pushWithRetries(image string, push func() (string, error)) (string, error) {
+	delay := pushRetryDelay
+	for attempt := 1; ; attempt++ {
+		digest, err := push()
+		if err == nil {
+			return digest, nil
+		}
+		if attempt == pushAttempts || !isTransientPushError(err) {
+			return "", errors.Errorf("Could not push the image %s: %v", image, err)
+		}
+		Warning.logf("Pushing %s failed, retrying in %s: %v", image, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd"
+)
+
+func TestIsTransientPushError(t *testing.T) {
+	var tests = []struct {
+		message   string
+		transient bool
+	}{
+		{"Get https://registry.example.com/v2/: dial tcp 10.0.0.1:443: connect: connection refused", true},
+		{"Put https://registry.example.com/v2/app/blobs/uploads/1: net/http: TLS handshake timeout", true},
+		{"read tcp 10.0.0.2:51234->10.0.0.1:443: read: connection reset by peer", true},
+		{"dial tcp: lookup registry.example.com: Temporary failure in name resolution", true},
+		{"received unexpected HTTP status: 503 Service Unavailable", true},
+		{"Docker API POST /images/app/push failed with status 500: registry error", true},
+		{"unauthorized: authentication required", false},
+		{"denied: requested access to the resource is denied", false},
+		{"An image does not exist locally with the tag: registry.example.com/app", false},
+		{"Docker API POST /images/app/push failed with status 404: No such image: app:latest", false},
+		{"invalid reference format", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			if transient := cmd.IsTransientPushError(errors.New(tt.message)); transient != tt.transient {
+				t.Errorf("Expected the error to be transient: %v, but it is %v", tt.transient, transient)
+			}
+		})
+	}
+}
+
+func TestPushWithRetries(t *testing.T) {
+	oldDelay := *cmd.PushRetryDelay
+	*cmd.PushRetryDelay = 0
+	defer func() { *cmd.PushRetryDelay = oldDelay }()
+
+	var tests = []struct {
+		testName string
+		// the errors of the successive attempts, an attempt after them succeeds
+		errors           []string
+		expectedAttempts int
+		expectedError    string
+	}{
+		{"success", nil, 1, ""},
+		{"transient failure", []string{"connection reset by peer"}, 2, ""},
+		{"permanent failure", []string{"unauthorized: authentication required"}, 1, "unauthorized"},
+		{"transient then permanent failure", []string{"502 Bad Gateway", "denied: requested access to the resource is denied"}, 2, "denied"},
+		{"all attempts fail", []string{"i/o timeout", "i/o timeout", "i/o timeout", "i/o timeout"}, 3, "i/o timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			attempts := 0
+			digest, err := cmd.PushWithRetries("registry.example.com/app", func() (string, error) {
+				attempts++
+				if attempts <= len(tt.errors) {
+					return "", errors.New(tt.errors[attempts-1])
+				}
+				return "sha256:1234", nil
+			})
+			if attempts != tt.expectedAttempts {
+				t.Errorf("Expected %d attempts, but there were %d", tt.expectedAttempts, attempts)
+			}
+			if tt.expectedError == "" {
+				if err != nil || digest != "sha256:1234" {
+					t.Errorf("Expected the push to succeed with the digest sha256:1234, but got %s %v", digest, err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.expectedError) || !strings.Contains(err.Error(), "registry.example.com/app") {
+				t.Errorf("Expected the push of registry.example.com/app to fail with %s, but got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestBuildxPushRetries(t *testing.T) {
+	oldDelay := *cmd.PushRetryDelay
+	*cmd.PushRetryDelay = 0
+	defer func() { *cmd.PushRetryDelay = oldDelay }()
+	dir, err := ioutil.TempDir("", "appsody-buildx-push-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the first build fails to push with a transient error, the next one writes the digest to the metadata file
+	fakeDocker := filepath.Join(dir, "docker")
+	script := "#!/bin/sh\nif [ ! -f \"" + dir + "/attempted\" ]; then\n  touch \"" + dir + "/attempted\"\n  echo 'failed to push: 503 Service Unavailable' >&2\n  exit 1\nfi\n" +
+		"while [ \"$1\" != --metadata-file ]; do shift; done\necho '{\"containerimage.digest\": \"sha256:5678\"}' > \"$2\"\n"
+	err = ioutil.WriteFile(fakeDocker, []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest, err := cmd.BuildxPush(fakeDocker, []string{"registry.example.com/app"}, []string{"linux/amd64", "linux/arm64"})
+	if err != nil || digest != "sha256:5678" {
+		t.Errorf("Expected the push to be retried and succeed with the digest sha256:5678, but got %s %v", digest, err)
+	}
+}
+
+func TestLoginTemporaryDockerConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "appsody-login-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the docker config of the user, with a buildx plugin and the credentials of a private registry
+	userConfigDir := filepath.Join(dir, "docker-config")
+	err = os.MkdirAll(filepath.Join(userConfigDir, "cli-plugins"), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userConfig := `{"auths": {"private.example.com": {}}, "credsStore": "desktop"}`
+	err = ioutil.WriteFile(filepath.Join(userConfigDir, "config.json"), []byte(userConfig), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldDockerConfig := os.Getenv("DOCKER_CONFIG")
+	os.Setenv("DOCKER_CONFIG", userConfigDir)
+	defer os.Setenv("DOCKER_CONFIG", oldDockerConfig)
+	// docker login stores the credentials in the docker config
+	binDir := filepath.Join(dir, "bin")
+	err = os.MkdirAll(binDir, os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeDocker := "#!/bin/sh\nif [ \"$1\" = login ]; then\n  cp \"$DOCKER_CONFIG/config.json\" \"$DOCKER_CONFIG/before-login.json\"\n  cat > \"$DOCKER_CONFIG/config.json\"\nfi\n"
+	err = ioutil.WriteFile(filepath.Join(binDir, "docker"), []byte(fakeDocker), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", binDir+string(os.PathListSeparator)+oldPath)
+	defer os.Setenv("PATH", oldPath)
+
+	oldAuthFile, authFileSet := os.LookupEnv("REGISTRY_AUTH_FILE")
+	removeLoginConfig, err := cmd.LoginCommand("docker", "registry.example.com", "builder", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loginConfigDir := os.Getenv("DOCKER_CONFIG")
+	if loginConfigDir == userConfigDir {
+		removeLoginConfig()
+		t.Fatal("Expected the login to use a temporary docker config")
+	}
+	credentials, err := ioutil.ReadFile(filepath.Join(loginConfigDir, "config.json"))
+	if err != nil || string(credentials) != "s3cret" {
+		t.Errorf("Expected the credentials in the temporary docker config, but got %s %v", credentials, err)
+	}
+	if os.Getenv("REGISTRY_AUTH_FILE") != filepath.Join(loginConfigDir, "config.json") {
+		t.Errorf("Expected REGISTRY_AUTH_FILE to be the config.json of the temporary docker config, but it is %s", os.Getenv("REGISTRY_AUTH_FILE"))
+	}
+	if _, err := os.Stat(filepath.Join(loginConfigDir, "cli-plugins")); err != nil {
+		t.Errorf("Expected the CLI plugins of the docker config in the temporary docker config: %v", err)
+	}
+	// the login starts from the credentials of the user, without storing its own in the credential store of the user
+	var beforeLogin struct {
+		Auths       map[string]interface{} `json:"auths"`
+		CredsStore  string                 `json:"credsStore"`
+		CredHelpers map[string]string      `json:"credHelpers"`
+	}
+	beforeLoginBytes, err := ioutil.ReadFile(filepath.Join(loginConfigDir, "before-login.json"))
+	if err == nil {
+		err = json.Unmarshal(beforeLoginBytes, &beforeLogin)
+	}
+	if err != nil {
+		t.Errorf("Expected the temporary docker config to have a config.json before the login: %v", err)
+	}
+	if _, found := beforeLogin.Auths["private.example.com"]; !found || beforeLogin.CredsStore != "desktop" {
+		t.Errorf("Expected the temporary docker config to have the credentials of the user, but it is %s", beforeLoginBytes)
+	}
+	if helper, found := beforeLogin.CredHelpers["registry.example.com"]; !found || helper != "" {
+		t.Errorf("Expected the login to store the credentials of registry.example.com in the temporary docker config, but it is %s", beforeLoginBytes)
+	}
+	removeLoginConfig()
+
+	if _, err := os.Stat(loginConfigDir); !os.IsNotExist(err) {
+		t.Errorf("Expected the temporary docker config %s to be removed: %v", loginConfigDir, err)
+	}
+	if config, err := ioutil.ReadFile(filepath.Join(userConfigDir, "config.json")); err != nil || string(config) != userConfig {
+		t.Errorf("Expected the docker config of the user to be unchanged, but it is %s %v", config, err)
+	}
+	if os.Getenv("DOCKER_CONFIG") != userConfigDir {
+		t.Errorf("Expected DOCKER_CONFIG to be restored to %s, but it is %s", userConfigDir, os.Getenv("DOCKER_CONFIG"))
+	}
+	if authFile, found := os.LookupEnv("REGISTRY_AUTH_FILE"); found != authFileSet || authFile != oldAuthFile {
+		t.Errorf("Expected REGISTRY_AUTH_FILE to be restored, but it is %s", authFile)
+	}
+}
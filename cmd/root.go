@@ -41,8 +41,12 @@ type RootCommandConfig struct {
 	CfgFile          string
 	Dryrun           bool
 	Verbose          bool
+	OutputFormat     string
+	LogFile          string
 	CliConfig        *viper.Viper
 	Buildah          bool
+	Engine           string
+	PullPolicy       string
 	ProjectConfig    *ProjectConfig
 	ProjectDir       string
 	UnsupportedRepos []string
@@ -51,11 +55,15 @@ type RootCommandConfig struct {
 	setupConfigRun bool
 	imagePulled    map[string]bool
 	cachedEnvVars  map[string]string
+	stackImages    map[string]*ImageInspect
+	engine         ContainerEngine
 }
 
 // Regular expression to match ANSI terminal commands so that we can remove them from the log
 const ansi = "[\u001B\u009B][[\\]()#;?]*(?:(?:(?:[a-zA-Z\\d]*(?:;[-a-zA-Z\\d\\/#&.:=?%@~_\\s]*)*)?(\u0007|^G))|(?:(?:\\d{1,4}(?:;\\d{0,4})*)?[\\dA-PR-TZcf-ntqry=><~]))"
 
+var ansiRegexp = regexp.MustCompile(ansi)
+
 func homeDir() (string, error) {
 	home, err := homedir.Dir()
 	if err != nil {
@@ -80,26 +88,39 @@ func newRootCmd(projectDir string, args []string) (*cobra.Command, error) {
 
 Complete documentation is available at https://appsody.dev`,
 		//Run: no run action for the root command
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return initOutputFormat(rootConfig)
+		},
 	}
 
 	rootCmd.PersistentFlags().StringVar(&rootConfig.CfgFile, "config", "", "config file (default is $HOME/.appsody/.appsody.yaml)")
 	rootCmd.PersistentFlags().BoolVarP(&rootConfig.Verbose, "verbose", "v", false, "Turns on debug output and logging to a file in $HOME/.appsody/logs")
+	rootCmd.PersistentFlags().StringVar(&rootConfig.LogFile, "log-file", "", "Write the log to this file instead of a new file in $HOME/.appsody/logs. Turns on --verbose.")
 	rootCmd.PersistentFlags().BoolVar(&rootConfig.Dryrun, "dryrun", false, "Turns on dry run mode")
+	rootCmd.PersistentFlags().StringVar(&rootConfig.OutputFormat, "output-format", outputFormatText, "The format of the console output: text, or jsonl to write every log line, phase, container output and the result of the command as one JSON event per line")
+	rootCmd.PersistentFlags().StringVar(&rootConfig.Engine, "engine", "", "The container engine to use: docker, podman or docker-api (default is the engine setting of the config file, or docker)")
 
 	// parse the root flags and init logging before adding all the other commands in case those log messages
+	// the flags of the commands are not known yet, skip them so that root flags after them, such as
+	// --output-format, still apply to the log messages of the setup
 	rootCmd.SetArgs(args)
+	rootCmd.FParseErrWhitelist.UnknownFlags = true
 	_ = rootCmd.ParseFlags(args) // ignore flag errors here because we haven't added all the commands
+	rootCmd.FParseErrWhitelist.UnknownFlags = false
 	initLogging(rootConfig)
 
 	rootCmd.AddCommand(
 		newInitCmd(rootConfig),
 		newBuildCmd(rootConfig),
+		newCleanCmd(rootConfig),
 		newExtractCmd(rootConfig),
+		newImageCmd(rootConfig),
 		newCompletionCmd(rootCmd),
 		newDebugCmd(rootConfig),
 		newDeployCmd(rootConfig),
 		newDocsCmd(rootConfig, rootCmd),
 		newListCmd(rootConfig),
+		newLogsCmd(rootConfig),
 		newOperatorCmd(rootConfig),
 		newPsCmd(rootConfig),
 		newRepoCmd(rootConfig),
@@ -107,6 +128,7 @@ Complete documentation is available at https://appsody.dev`,
 		newStackCmd(rootConfig),
 		newStopCmd(rootConfig),
 		newTestCmd(rootConfig),
+		newVolumesCmd(rootConfig),
 		newVersionCmd(rootCmd),
 	)
 
@@ -114,6 +136,7 @@ Complete documentation is available at https://appsody.dev`,
 	if setupErr != nil {
 		return rootCmd, setupErr
 	}
+	enforceLogRetention(rootConfig)
 	appsodyOnK8S := os.Getenv("APPSODY_K8S_EXPERIMENTAL")
 	if appsodyOnK8S == "TRUE" {
 		rootConfig.Buildah = true
@@ -152,6 +175,12 @@ func InitConfig(config *RootCommandConfig) error {
 	cliConfig.SetDefault("operator", operatorHome)
 	cliConfig.SetDefault("tektonserver", "")
 	cliConfig.SetDefault("lastversioncheck", "none")
+	cliConfig.SetDefault("engine", engineDocker)
+	cliConfig.SetDefault("pullpolicy", pullIfStale)
+	cliConfig.SetDefault("pullinterval", "24h")
+	cliConfig.SetDefault("logmaxfiles", defaultLogMaxFiles)
+	cliConfig.SetDefault("logmaxage", defaultLogMaxAge)
+	cliConfig.SetDefault("logmaxsize", defaultLogMaxSize)
 	if config.CfgFile != "" {
 		// Use config file from the flag.
 		cliConfig.SetConfigFile(config.CfgFile)
@@ -193,10 +222,11 @@ func ExecuteE(version string, projectDir string, args []string) error {
 		Error.log(err)
 	}
 	Debug.log("Running with command line args: appsody ", strings.Join(args[1:], " "))
-	err = rootCmd.Execute()
+	executedCmd, err := rootCmd.ExecuteC()
 	if err != nil {
 		Error.log(err)
 	}
+	logResult(executedCmd.CommandPath(), err)
 	return err
 }
 
@@ -257,6 +287,7 @@ func (l appsodylogger) internalLog(msgString string, skipConsole bool, args ...i
 		return
 	}
 
+	rawMsgString := msgString
 	if l.verbose || l != Info {
 		msgString = "[" + string(l.name) + "] " + msgString
 	}
@@ -271,7 +302,9 @@ func (l appsodylogger) internalLog(msgString string, skipConsole bool, args ...i
 		}
 	}
 
-	if !skipConsole {
+	if !skipConsole && jsonlOutput {
+		l.logEvent(rawMsgString)
+	} else if !skipConsole {
 		// Print to console
 		if l == Info {
 			fmt.Fprintln(os.Stdout, msgString)
@@ -285,7 +318,6 @@ func (l appsodylogger) internalLog(msgString string, skipConsole bool, args ...i
 	// Print to log file
 	if l.verbose && l.klogInitialized {
 		// Remove ansi commands
-		ansiRegexp := regexp.MustCompile(ansi)
 		msgString = ansiRegexp.ReplaceAllString(msgString, "")
 		klog.InfoDepth(2, msgString)
 		klog.Flush()
@@ -293,17 +325,29 @@ func (l appsodylogger) internalLog(msgString string, skipConsole bool, args ...i
 }
 
 func initLogging(config *RootCommandConfig) {
+	jsonlOutput = config.OutputFormat == outputFormatJSONL // set again once all the flags are parsed
+	currentLogFile = ""
+	if config.LogFile != "" {
+		config.Verbose = true
+	}
 	if config.Verbose {
 		for _, l := range allLoggers {
 			l.verbose = true
 		}
 
-		homeDirectory, dirErr := homeDir()
+		logDir, dirErr := getLogDir()
 		if dirErr != nil {
 			os.Exit(1)
 		}
-
-		logDir := filepath.Join(homeDirectory, ".appsody", "logs")
+		if config.LogFile != "" {
+			logFile, err := filepath.Abs(config.LogFile)
+			if err != nil {
+				Error.logf("Could not use the log file %s: %s", config.LogFile, err)
+				os.Exit(1)
+			}
+			logDir = filepath.Dir(logFile)
+			currentLogFile = logFile
+		}
 
 		_, errPath := os.Stat(logDir)
 		if errPath != nil {
@@ -313,9 +357,12 @@ func initLogging(config *RootCommandConfig) {
 			}
 		}
 
-		currentTimeValues := strings.Split(time.Now().Local().String(), " ")
-		fileName := strings.ReplaceAll("appsody"+currentTimeValues[0]+"T"+currentTimeValues[1]+".log", ":", "-")
-		pathString := filepath.Join(homeDirectory, ".appsody", "logs", fileName)
+		if currentLogFile == "" {
+			currentTimeValues := strings.Split(time.Now().Local().String(), " ")
+			fileName := strings.ReplaceAll("appsody"+currentTimeValues[0]+"T"+currentTimeValues[1]+".log", ":", "-")
+			currentLogFile = filepath.Join(logDir, fileName)
+		}
+		pathString := currentLogFile
 		klogFlags := flag.NewFlagSet("klog", flag.ExitOnError)
 		klog.InitFlags(klogFlags)
 		_ = klogFlags.Set("v", "4")
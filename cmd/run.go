@@ -18,41 +18,20 @@ import (
 	"github.com/spf13/cobra"
 )
 
-func dockerStop(imageName string, dryrun bool) error {
-	cmdName := "docker"
-	cmdArgs := []string{"stop", imageName}
-	err := execAndWait(cmdName, cmdArgs, Debug, dryrun)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func containerRemove(imageName string, buildah bool, dryrun bool) error {
-	cmdName := "docker"
-	//Added "-f" to force removal if container is still running or image has containers
-	cmdArgs := []string{"rm", imageName, "-f"}
-	if buildah {
-		cmdName = "buildah"
-		cmdArgs = []string{"rm", imageName}
-	}
-	err := execAndWait(cmdName, cmdArgs, Debug, dryrun)
-	if err != nil {
-		return err
-	}
-	return nil
-
-}
-
 func newRunCmd(rootConfig *RootCommandConfig) *cobra.Command {
 	config := &devCommonConfig{RootCommandConfig: rootConfig}
 	// runCmd represents the run command
 	var runCmd = &cobra.Command{
 		Use:   "run",
 		Short: "Run the local Appsody environment for your project",
-		Long:  `This starts a docker based continuous build environment for your project.`,
-		RunE: func(cmd *cobra.Command, args []string) error {
+		Long: `This starts a docker based continuous build environment for your project.
 
+With --target kubernetes, the environment runs in a deployment in the cluster of the current kubectl context instead. The generated manifests are kept in .appsody/k8s, and the resources are deleted when the command is interrupted or by "appsody stop --target kubernetes".`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := applyRunProfile(cmd, config)
+			if err != nil {
+				return err
+			}
 			Info.log("Running development environment...")
 			return commonCmd(config, "run")
 
@@ -60,5 +39,6 @@ func newRunCmd(rootConfig *RootCommandConfig) *cobra.Command {
 	}
 
 	addDevCommonFlags(runCmd, config)
+	runCmd.PersistentFlags().BoolVar(&config.resetDeps, "reset-deps", false, "Remove and recreate the dependency volume before starting, for when the dependency cache is corrupted.")
 	return runCmd
 }
@@ -0,0 +1,396 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The formats of the SBOM of appsody build --sbom
+const (
+	sbomSPDXJSON      = "spdx-json"
+	sbomCycloneDXJSON = "cyclonedx-json"
+)
+
+// sbomRequest is an SBOM appsody build writes, to $HOME/.appsody/build/<project>.<format>.json and to file when it is set
+type sbomRequest struct {
+	format string
+	file   string
+}
+
+// sbomFile is an SBOM written by appsody build, as recorded in the build metadata
+type sbomFile struct {
+	Format string   `json:"format"`
+	Files  []string `json:"files"`
+}
+
+// parseSBOMRequests parses the <format>[=<file>] values of --sbom
+func parseSBOMRequests(values []string) ([]sbomRequest, error) {
+	var requests []sbomRequest
+	formats := make(map[string]bool)
+	for _, value := range values {
+		formatFile := strings.SplitN(value, "=", 2)
+		request := sbomRequest{format: strings.TrimSpace(formatFile[0])}
+		if request.format != sbomSPDXJSON && request.format != sbomCycloneDXJSON {
+			return nil, errors.Errorf("Unsupported --sbom format %s, use %s=<file> or %s=<file>", request.format, sbomSPDXJSON, sbomCycloneDXJSON)
+		}
+		if formats[request.format] {
+			return nil, errors.Errorf("The --sbom format %s is given more than once", request.format)
+		}
+		formats[request.format] = true
+		if len(formatFile) == 2 {
+			if strings.TrimSpace(formatFile[1]) == "" {
+				return nil, errors.Errorf("Invalid --sbom %s, the file is empty", value)
+			}
+			file, err := filepath.Abs(formatFile[1])
+			if err != nil {
+				return nil, err
+			}
+			request.file = file
+		}
+		requests = append(requests, request)
+	}
+	return requests, nil
+}
+
+// getSBOMInventory returns the packages of the build context. With --dryrun the project is not extracted,
+// so only the packages of the project files are listed.
+func getSBOMInventory(config *RootCommandConfig, extractDir string) ([]inventoryPackage, error) {
+	var manifests map[string]string
+	var err error
+	if config.Dryrun {
+		Info.log("Dry Run - The project is not extracted, the SBOM only lists the packages of the project files")
+		manifests, err = projectManifests(config)
+	} else {
+		manifests, err = inventoryManifests(extractDir)
+	}
+	if err != nil {
+		return nil, errors.Errorf("Could not list the package manifests of the build context: %v", err)
+	}
+	packages, read := readInventory(manifests)
+	if len(read) == 0 {
+		Warning.log("The build context has no package-lock.json, package.json, pom.xml, go.mod or requirements.txt, the SBOM only lists the stack")
+	} else {
+		Info.logf("The SBOM lists %d packages from %s", len(packages), strings.Join(read, ", "))
+	}
+	return packages, nil
+}
+
+// writeSBOMs writes the SBOMs of the build and returns their files, for the build metadata
+func writeSBOMs(config *RootCommandConfig, requests []sbomRequest, metadata buildMetadata, packages []inventoryPackage) ([]sbomFile, error) {
+	var written []sbomFile
+	for _, request := range requests {
+		var document interface{}
+		var err error
+		if request.format == sbomSPDXJSON {
+			document, err = newSPDXDocument(metadata, packages)
+		} else {
+			document, err = newCycloneDXDocument(metadata, packages)
+		}
+		if err != nil {
+			return nil, err
+		}
+		files := []string{filepath.Join(getHome(config), "build", metadata.Project+"."+strings.TrimSuffix(request.format, "-json")+".json")}
+		if request.file != "" {
+			files = append(files, request.file)
+		}
+		written = append(written, sbomFile{Format: request.format, Files: files})
+		if config.Dryrun {
+			Info.logf("Dry Run - Skip writing the %s SBOM %s", request.format, strings.Join(files, ", "))
+			continue
+		}
+		documentBytes, err := json.MarshalIndent(document, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			err = os.MkdirAll(filepath.Dir(file), os.ModePerm)
+			if err == nil {
+				err = ioutil.WriteFile(file, documentBytes, 0644)
+			}
+			if err != nil {
+				return nil, errors.Errorf("Could not write the SBOM %s: %v", file, err)
+			}
+			Info.logf("Wrote the %s SBOM %s", request.format, file)
+		}
+	}
+	return written, nil
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() (string, error) {
+	uuid := make([]byte, 16)
+	_, err := rand.Read(uuid)
+	if err != nil {
+		return "", err
+	}
+	uuid[6] = uuid[6]&0x0f | 0x40
+	uuid[8] = uuid[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:]), nil
+}
+
+// stackRepoDigest returns the sha256 digest of the repository digest of the stack image, it is empty when the stack
+// image has no repository digest
+func stackRepoDigest(stack stackMetadata) string {
+	at := strings.LastIndex(stack.Digest, "@")
+	if at < 0 || !strings.HasPrefix(stack.Digest[at+1:], "sha256:") {
+		return ""
+	}
+	return stack.Digest[at+1:]
+}
+
+// stackPURL returns the package URL of the stack image of the build
+func stackPURL(stack stackMetadata) string {
+	repository, tag := splitImageTag(stack.Image)
+	purl := "pkg:oci/" + repository[strings.LastIndex(repository, "/")+1:]
+	if digest := stackRepoDigest(stack); digest != "" {
+		purl += "@" + strings.Replace(digest, ":", "%3A", 1)
+	}
+	return purl + "?repository_url=" + repository + "&tag=" + tag
+}
+
+// The parts of an SPDX 2.3 document appsody build writes, see https://spdx.github.io/spdx-spec/v2.3/
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	PrimaryPurpose   string            `json:"primaryPackagePurpose,omitempty"`
+	SourceInfo       string            `json:"sourceInfo,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	Comment          string            `json:"comment,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+func newSPDXDocument(metadata buildMetadata, packages []inventoryPackage) (*spdxDocument, error) {
+	uuid, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	creator := "Tool: appsody"
+	if VERSION != "" {
+		creator += "-" + VERSION
+	}
+	document := &spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              metadata.Image,
+		DocumentNamespace: "https://appsody.dev/spdx/" + metadata.Project + "-" + uuid,
+		CreationInfo:      spdxCreationInfo{Created: metadata.BuildTime, Creators: []string{creator}},
+	}
+	_, tag := splitImageTag(metadata.Image)
+	image := spdxPackage{
+		Name:             metadata.Image,
+		SPDXID:           "SPDXRef-Image",
+		VersionInfo:      tag,
+		DownloadLocation: "NOASSERTION",
+		PrimaryPurpose:   "CONTAINER",
+		LicenseConcluded: "NOASSERTION",
+		LicenseDeclared:  "NOASSERTION",
+		CopyrightText:    "NOASSERTION",
+	}
+	stack := spdxPackage{
+		Name:             metadata.Stack.Image,
+		SPDXID:           "SPDXRef-Stack",
+		VersionInfo:      metadata.Stack.Version,
+		DownloadLocation: "NOASSERTION",
+		PrimaryPurpose:   "CONTAINER",
+		LicenseConcluded: "NOASSERTION",
+		LicenseDeclared:  "NOASSERTION",
+		CopyrightText:    "NOASSERTION",
+		Comment:          "The Appsody stack " + metadata.Stack.ID + " the image is built from",
+		ExternalRefs:     []spdxExternalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: stackPURL(metadata.Stack)}},
+	}
+	if digest := stackRepoDigest(metadata.Stack); digest != "" {
+		stack.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: strings.TrimPrefix(digest, "sha256:")}}
+	}
+	document.Packages = []spdxPackage{image, stack}
+	document.Relationships = []spdxRelationship{
+		{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: image.SPDXID},
+		{SPDXElementID: image.SPDXID, RelationshipType: "DESCENDANT_OF", RelatedSPDXElement: stack.SPDXID},
+	}
+	for i, pkg := range packages {
+		spdxID := fmt.Sprintf("SPDXRef-Package-%d", i+1)
+		spdxPkg := spdxPackage{
+			Name:             pkg.Name,
+			SPDXID:           spdxID,
+			VersionInfo:      pkg.Version,
+			DownloadLocation: "NOASSERTION",
+			PrimaryPurpose:   "LIBRARY",
+			SourceInfo:       "declared by " + pkg.Source,
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  "NOASSERTION",
+			CopyrightText:    "NOASSERTION",
+			ExternalRefs:     []spdxExternalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: pkg.purl()}},
+		}
+		if pkg.Range != "" {
+			spdxPkg.Comment = "The installed version is not known, the declared version range is " + pkg.Range
+		}
+		document.Packages = append(document.Packages, spdxPkg)
+		document.Relationships = append(document.Relationships, spdxRelationship{SPDXElementID: image.SPDXID, RelationshipType: "CONTAINS", RelatedSPDXElement: spdxID})
+	}
+	return document, nil
+}
+
+// The parts of a CycloneDX 1.4 document appsody build writes, see https://cyclonedx.org/docs/1.4/json/
+type cycloneDXDocument struct {
+	BOMFormat    string                `json:"bomFormat"`
+	SpecVersion  string                `json:"specVersion"`
+	SerialNumber string                `json:"serialNumber"`
+	Version      int                   `json:"version"`
+	Metadata     cycloneDXMetadata     `json:"metadata"`
+	Components   []cycloneDXComponent  `json:"components"`
+	Dependencies []cycloneDXDependency `json:"dependencies"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp  string              `json:"timestamp"`
+	Tools      []cycloneDXTool     `json:"tools"`
+	Component  cycloneDXComponent  `json:"component"`
+	Properties []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+type cycloneDXTool struct {
+	Vendor  string `json:"vendor"`
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type cycloneDXComponent struct {
+	Type       string              `json:"type"`
+	BOMRef     string              `json:"bom-ref"`
+	Name       string              `json:"name"`
+	Version    string              `json:"version,omitempty"`
+	PURL       string              `json:"purl,omitempty"`
+	Hashes     []cycloneDXHash     `json:"hashes,omitempty"`
+	Properties []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+type cycloneDXHash struct {
+	Algorithm string `json:"alg"`
+	Content   string `json:"content"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cycloneDXDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+func newCycloneDXDocument(metadata buildMetadata, packages []inventoryPackage) (*cycloneDXDocument, error) {
+	uuid, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	_, tag := splitImageTag(metadata.Image)
+	stack := cycloneDXComponent{
+		Type:    "container",
+		BOMRef:  "stack",
+		Name:    metadata.Stack.Image,
+		Version: metadata.Stack.Version,
+		PURL:    stackPURL(metadata.Stack),
+	}
+	if digest := stackRepoDigest(metadata.Stack); digest != "" {
+		stack.Hashes = []cycloneDXHash{{Algorithm: "SHA-256", Content: strings.TrimPrefix(digest, "sha256:")}}
+	}
+	document := &cycloneDXDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.4",
+		SerialNumber: "urn:uuid:" + uuid,
+		Version:      1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: metadata.BuildTime,
+			Tools:     []cycloneDXTool{{Vendor: "Appsody", Name: "appsody", Version: VERSION}},
+			Component: cycloneDXComponent{Type: "container", BOMRef: "image", Name: metadata.Image, Version: tag},
+			Properties: []cycloneDXProperty{
+				{Name: stackIDLabel, Value: metadata.Stack.ID},
+				{Name: stackVersionLabel, Value: metadata.Stack.Version},
+			},
+		},
+		Components: []cycloneDXComponent{stack},
+	}
+	if stackRepoDigest(metadata.Stack) != "" {
+		document.Metadata.Properties = append(document.Metadata.Properties, cycloneDXProperty{Name: "dev.appsody.stack.digest", Value: metadata.Stack.Digest})
+	}
+	imageDependencies := cycloneDXDependency{Ref: "image", DependsOn: []string{stack.BOMRef}}
+	for i, pkg := range packages {
+		// the packages without a version have the same package URL for all their ranges
+		component := cycloneDXComponent{
+			Type:       "library",
+			BOMRef:     fmt.Sprintf("package-%d", i+1),
+			Name:       pkg.Name,
+			Version:    pkg.Version,
+			PURL:       pkg.purl(),
+			Properties: []cycloneDXProperty{{Name: "appsody:source", Value: pkg.Source}},
+		}
+		if pkg.Range != "" {
+			component.Properties = append(component.Properties, cycloneDXProperty{Name: "appsody:versionRange", Value: pkg.Range})
+		}
+		document.Components = append(document.Components, component)
+		imageDependencies.DependsOn = append(imageDependencies.DependsOn, component.BOMRef)
+	}
+	document.Dependencies = []cycloneDXDependency{imageDependencies}
+	return document, nil
+}
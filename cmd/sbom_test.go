@@ -0,0 +1,284 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd/cmdtest"
+)
+
+// the packages of the SBOM of the files of TestBuildSBOM, by their package URL, with their version and range
+var sbomPackages = map[string][2]string{
+	"pkg:golang/github.com/pkg/errors@v0.8.1":                      {"v0.8.1", ""},
+	"pkg:golang/golang.org/x/text@v0.3.2":                          {"v0.3.2", ""},
+	"pkg:maven/com.fasterxml.jackson.core/jackson-databind@2.10.1": {"2.10.1", ""},
+	"pkg:maven/org.apache.commons/commons-lang3":                   {"", "[3.0,4.0)"},
+	"pkg:npm/debug@2.6.9":                                          {"2.6.9", ""},
+	"pkg:npm/express@4.17.1":                                       {"4.17.1", ""},
+	"pkg:npm/lodash@4.17.15":                                       {"4.17.15", ""},
+	"pkg:npm/ms@2.1.2":                                             {"2.1.2", ""},
+	"pkg:npm/react":                                                {"", "^16.12.0"},
+	"pkg:pypi/certifi@2019.11.28":                                  {"2019.11.28", ""},
+	"pkg:pypi/flask@1.1.1":                                         {"1.1.1", ""},
+	"pkg:pypi/idna@2.8":                                            {"2.8", ""},
+	"pkg:pypi/requests":                                            {"", ">=2.0"},
+}
+
+func TestBuildSBOM(t *testing.T) {
+	files := map[string]string{
+		// the package.json of a directory with a package-lock.json is not read, nor are the dev dependencies
+		"package.json":             `{"name": "sbom-project", "dependencies": {"express": "^4.17.1"}}`,
+		"package-lock.json":        `{"name": "sbom-project", "lockfileVersion": 2, "packages": {"": {"name": "sbom-project"}, "node_modules/express": {"version": "4.17.1"}, "node_modules/debug": {"version": "2.6.9"}, "node_modules/@types/node": {"version": "12.0.0", "dev": true}}}`,
+		"legacy/package-lock.json": `{"name": "legacy", "lockfileVersion": 1, "dependencies": {"ms": {"version": "2.1.2"}, "mocha": {"version": "6.2.2", "dev": true, "dependencies": {"debug": {"version": "3.2.6", "dev": true}}}}}`,
+		// only the exact versions of a package.json are versions
+		"web/package.json": `{"name": "web", "dependencies": {"react": "^16.12.0", "lodash": "4.17.15"}, "devDependencies": {"jest": "24.9.0"}}`,
+		"service/go.mod":   "module example.com/service\n\ngo 1.13\n\nrequire (\n\tgithub.com/pkg/errors v0.8.1\n\tgolang.org/x/text v0.3.2 // indirect\n)\n",
+		// the hashes of pinned requirements follow them, on the same line or on continuation lines
+		"requirements.txt": "# runtime\nflask==1.1.1\nrequests>=2.0\n-r dev-requirements.txt\n" +
+			"certifi==2019.11.28 \\\n    --hash=sha256:017c25db2a153ce562900032d5bc68e9f191e44e9a0f762f373977de9df1fbb3 \\\n    --hash=sha256:25b64c7da4cd7479594d035c08c2d809eb4aab3a26e5a990ea98cc450c320f1f\n" +
+			"idna==2.8 --hash=sha256:ea8b7f6188e6fa117537c3df7da9fc686d485087abf6ac197f9c46432f7e4a3c\n",
+		"pom.xml": "<project><version>1.0</version><properties><jackson.version>2.10.1</jackson.version></properties><dependencies>" +
+			"<dependency><groupId>com.fasterxml.jackson.core</groupId><artifactId>jackson-databind</artifactId><version>${jackson.version}</version></dependency>" +
+			"<dependency><groupId>org.apache.commons</groupId><artifactId>commons-lang3</artifactId><version>[3.0,4.0)</version></dependency>" +
+			"<dependency><groupId>junit</groupId><artifactId>junit</artifactId><version>4.12</version><scope>test</scope></dependency></dependencies></project>",
+		// installed dependencies are not read
+		"node_modules/express/package.json": `{"name": "express", "dependencies": {"accepts": "~1.3.7"}}`,
+	}
+	var expectedPURLs []string
+	for purl := range sbomPackages {
+		expectedPURLs = append(expectedPURLs, purl)
+	}
+	sort.Strings(expectedPURLs)
+
+	tests := []struct {
+		name string
+		// the repository digest of the stack image, if it was pulled from a registry
+		repoDigest string
+		stackPURL  string
+	}{
+		{"pulled stack image", "test/sbom-stack@sha256:1234", "pkg:oci/sbom-stack@sha256%3A1234?repository_url=test/sbom-stack&tag=0.1"},
+		// the image ID of a local stack image is not a digest of the registry
+		{"local stack image", "", "pkg:oci/sbom-stack?repository_url=test/sbom-stack&tag=0.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stackInspect := `{"Id": "sha256:4abc", "Config": {"Env": ["APPSODY_MOUNTS=.:/project/user-app", "APPSODY_PROJECT_DIR=/project"]}}`
+			if test.repoDigest != "" {
+				stackInspect = `{"Id": "sha256:4abc", "RepoDigests": ["` + test.repoDigest + `"], "Config": {"Env": ["APPSODY_MOUNTS=.:/project/user-app", "APPSODY_PROJECT_DIR=/project"]}}`
+			}
+			project, cleanup := newTestProject(t, "sbom-project", "test/sbom-stack:0.1", stackInspect)
+			defer cleanup()
+			project.writeFiles(t, files)
+			project.writePreviousExtract(t, "sha256:4abc", map[string]string{"Dockerfile": "FROM scratch\n"})
+			restorePath := project.installFakeDocker(t, "exit 0\n")
+			defer restorePath()
+			project.mux.HandleFunc("/images/registry.example.com/sbom-project:1.0/json", func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(`{"Id": "sha256:beef"}`))
+			})
+
+			spdxFile := filepath.Join(project.home, "sbom.spdx.json")
+			cycloneDXFile := filepath.Join(project.home, "build", "sbom-project.cyclonedx.json")
+			output, err := cmdtest.RunAppsodyCmd(project.appsodyArgs("build", "-t", "registry.example.com/sbom-project:1.0", "--sbom", "spdx-json="+spdxFile, "--sbom", "cyclonedx-json"), project.dir)
+			if err != nil {
+				t.Fatalf("%v. CLI output:\n%s", err, output)
+			}
+			expected := []string{
+				"The SBOM lists 13 packages from user-app/legacy/package-lock.json, user-app/package-lock.json, user-app/pom.xml, user-app/requirements.txt, user-app/service/go.mod, user-app/web/package.json",
+				"Wrote the spdx-json SBOM " + filepath.Join(project.home, "build", "sbom-project.spdx.json"),
+				"Wrote the spdx-json SBOM " + spdxFile,
+				"Wrote the cyclonedx-json SBOM " + cycloneDXFile,
+			}
+			for _, line := range expected {
+				if !strings.Contains(output, line) {
+					t.Errorf("Expected %s. CLI output:\n%s", line, output)
+				}
+			}
+			stackDigest := strings.TrimPrefix(test.repoDigest, "test/sbom-stack@sha256:")
+
+			var spdx struct {
+				SPDXVersion string `json:"spdxVersion"`
+				Packages    []struct {
+					Name         string `json:"name"`
+					SPDXID       string `json:"SPDXID"`
+					VersionInfo  string `json:"versionInfo"`
+					Comment      string `json:"comment"`
+					ExternalRefs []struct {
+						ReferenceType    string `json:"referenceType"`
+						ReferenceLocator string `json:"referenceLocator"`
+					} `json:"externalRefs"`
+					Checksums []struct {
+						Algorithm     string `json:"algorithm"`
+						ChecksumValue string `json:"checksumValue"`
+					} `json:"checksums"`
+				} `json:"packages"`
+				Relationships []struct {
+					SPDXElementID      string `json:"spdxElementId"`
+					RelationshipType   string `json:"relationshipType"`
+					RelatedSPDXElement string `json:"relatedSpdxElement"`
+				} `json:"relationships"`
+			}
+			readSBOM(t, spdxFile, &spdx)
+			if spdx.SPDXVersion != "SPDX-2.3" || len(spdx.Packages) != 2+len(sbomPackages) {
+				t.Fatalf("Expected an SPDX 2.3 document with the image, the stack and %d packages, but got %+v", len(sbomPackages), spdx)
+			}
+			image, stack := spdx.Packages[0], spdx.Packages[1]
+			if image.SPDXID != "SPDXRef-Image" || image.Name != "registry.example.com/sbom-project:1.0" || image.VersionInfo != "1.0" {
+				t.Errorf("Expected the image package first, but got %+v", image)
+			}
+			if stack.SPDXID != "SPDXRef-Stack" || stack.Name != "test/sbom-stack:0.1" || len(stack.ExternalRefs) != 1 || stack.ExternalRefs[0].ReferenceLocator != test.stackPURL {
+				t.Errorf("Expected the stack package with the purl %s, but got %+v", test.stackPURL, stack)
+			}
+			if test.repoDigest == "" && len(stack.Checksums) != 0 {
+				t.Errorf("Expected no checksum of the stack image without a repository digest, but got %+v", stack.Checksums)
+			}
+			if test.repoDigest != "" && (len(stack.Checksums) != 1 || stack.Checksums[0].Algorithm != "SHA256" || stack.Checksums[0].ChecksumValue != stackDigest) {
+				t.Errorf("Expected the SHA256 checksum %s of the stack image, but got %+v", stackDigest, stack.Checksums)
+			}
+			var spdxPURLs []string
+			contained := make(map[string]bool)
+			for _, relationship := range spdx.Relationships {
+				if relationship.SPDXElementID == "SPDXRef-Image" && relationship.RelationshipType == "CONTAINS" {
+					contained[relationship.RelatedSPDXElement] = true
+				}
+			}
+			for _, pkg := range spdx.Packages[2:] {
+				if len(pkg.ExternalRefs) != 1 || pkg.ExternalRefs[0].ReferenceType != "purl" {
+					t.Errorf("Expected the purl of the package, but got %+v", pkg)
+					continue
+				}
+				purl := pkg.ExternalRefs[0].ReferenceLocator
+				spdxPURLs = append(spdxPURLs, purl)
+				versionRange := sbomPackages[purl]
+				if pkg.VersionInfo != versionRange[0] || (versionRange[1] != "" && !strings.Contains(pkg.Comment, versionRange[1])) {
+					t.Errorf("Expected the package %s to have the version %q and the range %q, but got %+v", purl, versionRange[0], versionRange[1], pkg)
+				}
+				if !contained[pkg.SPDXID] {
+					t.Errorf("Expected the image to contain the package %s", pkg.SPDXID)
+				}
+			}
+			if !reflect.DeepEqual(spdxPURLs, expectedPURLs) {
+				t.Errorf("Expected the SPDX packages\n%v\nbut got\n%v", expectedPURLs, spdxPURLs)
+			}
+			if len(spdx.Relationships) != 2+len(sbomPackages) || spdx.Relationships[0].RelationshipType != "DESCRIBES" || spdx.Relationships[0].RelatedSPDXElement != "SPDXRef-Image" ||
+				spdx.Relationships[1].RelationshipType != "DESCENDANT_OF" || spdx.Relationships[1].RelatedSPDXElement != "SPDXRef-Stack" {
+				t.Errorf("Expected the document to describe the image, which descends from the stack, but got %+v", spdx.Relationships)
+			}
+
+			type cycloneDXProperty struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+			}
+			var cycloneDX struct {
+				BOMFormat   string `json:"bomFormat"`
+				SpecVersion string `json:"specVersion"`
+				Metadata    struct {
+					Component struct {
+						BOMRef string `json:"bom-ref"`
+						Name   string `json:"name"`
+					} `json:"component"`
+					Properties []cycloneDXProperty `json:"properties"`
+				} `json:"metadata"`
+				Components []struct {
+					Type    string `json:"type"`
+					BOMRef  string `json:"bom-ref"`
+					Name    string `json:"name"`
+					Version string `json:"version"`
+					PURL    string `json:"purl"`
+					Hashes  []struct {
+						Algorithm string `json:"alg"`
+						Content   string `json:"content"`
+					} `json:"hashes"`
+					Properties []cycloneDXProperty `json:"properties"`
+				} `json:"components"`
+				Dependencies []struct {
+					Ref       string   `json:"ref"`
+					DependsOn []string `json:"dependsOn"`
+				} `json:"dependencies"`
+			}
+			readSBOM(t, cycloneDXFile, &cycloneDX)
+			if cycloneDX.BOMFormat != "CycloneDX" || cycloneDX.SpecVersion != "1.4" || len(cycloneDX.Components) != 1+len(sbomPackages) {
+				t.Fatalf("Expected a CycloneDX 1.4 document with the stack and %d packages, but got %+v", len(sbomPackages), cycloneDX)
+			}
+			if cycloneDX.Metadata.Component.BOMRef != "image" || cycloneDX.Metadata.Component.Name != "registry.example.com/sbom-project:1.0" {
+				t.Errorf("Expected the image to be the component of the metadata, but got %+v", cycloneDX.Metadata.Component)
+			}
+			stackComponent := cycloneDX.Components[0]
+			if stackComponent.Type != "container" || stackComponent.PURL != test.stackPURL {
+				t.Errorf("Expected the stack component with the purl %s, but got %+v", test.stackPURL, stackComponent)
+			}
+			digestProperty := false
+			for _, property := range cycloneDX.Metadata.Properties {
+				digestProperty = digestProperty || (property.Name == "dev.appsody.stack.digest" && property.Value == test.repoDigest)
+			}
+			if test.repoDigest == "" && (len(stackComponent.Hashes) != 0 || len(cycloneDX.Metadata.Properties) != 2) {
+				t.Errorf("Expected no hash nor digest of the stack image without a repository digest, but got %+v %+v", stackComponent.Hashes, cycloneDX.Metadata.Properties)
+			}
+			if test.repoDigest != "" && (len(stackComponent.Hashes) != 1 || stackComponent.Hashes[0].Algorithm != "SHA-256" || stackComponent.Hashes[0].Content != stackDigest || !digestProperty) {
+				t.Errorf("Expected the SHA-256 hash and the digest property of the stack image, but got %+v %+v", stackComponent.Hashes, cycloneDX.Metadata.Properties)
+			}
+			var cycloneDXPURLs []string
+			dependsOn := []string{stackComponent.BOMRef}
+			for _, component := range cycloneDX.Components[1:] {
+				cycloneDXPURLs = append(cycloneDXPURLs, component.PURL)
+				dependsOn = append(dependsOn, component.BOMRef)
+				versionRange := sbomPackages[component.PURL]
+				expectedProperties := []cycloneDXProperty{{"appsody:source", component.Properties[0].Value}}
+				if versionRange[1] != "" {
+					expectedProperties = append(expectedProperties, cycloneDXProperty{"appsody:versionRange", versionRange[1]})
+				}
+				if component.Type != "library" || component.Version != versionRange[0] || !reflect.DeepEqual(component.Properties, expectedProperties) {
+					t.Errorf("Expected the component %s to have the version %q and the range %q, but got %+v", component.PURL, versionRange[0], versionRange[1], component)
+				}
+			}
+			if !reflect.DeepEqual(cycloneDXPURLs, expectedPURLs) {
+				t.Errorf("Expected the CycloneDX components\n%v\nbut got\n%v", expectedPURLs, cycloneDXPURLs)
+			}
+			if len(cycloneDX.Dependencies) != 1 || cycloneDX.Dependencies[0].Ref != "image" || !reflect.DeepEqual(cycloneDX.Dependencies[0].DependsOn, dependsOn) {
+				t.Errorf("Expected the image to depend on the stack and the packages %v, but got %+v", dependsOn, cycloneDX.Dependencies)
+			}
+		})
+	}
+}
+
+// readSBOM decodes the SBOM file written by appsody build
+func readSBOM(t *testing.T, file string, document interface{}) {
+	sbomBytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Expected the SBOM %s: %v", file, err)
+	}
+	err = json.Unmarshal(sbomBytes, document)
+	if err != nil {
+		t.Fatalf("Could not decode the SBOM %s: %v\n%s", file, err, sbomBytes)
+	}
+}
+
+func TestBuildSBOMUnsupportedFormat(t *testing.T) {
+	project, cleanup := newTestProject(t, "sbom-project", "test/sbom-stack:0.1", defaultStackInspect)
+	defer cleanup()
+	output, err := cmdtest.RunAppsodyCmdExec(project.appsodyArgs("build", "--dryrun", "--sbom", "spdx-tag-value=sbom.spdx"), project.dir)
+	if err == nil {
+		t.Fatalf("Expected an error for an unsupported SBOM format. CLI output:\n%s", output)
+	}
+	if !strings.Contains(output, "Unsupported --sbom format spdx-tag-value") {
+		t.Errorf("Expected the unsupported SBOM format to be reported. CLI output:\n%s", output)
+	}
+}
@@ -27,5 +27,6 @@ func newStackCmd(rootConfig *RootCommandConfig) *cobra.Command {
 	stackCmd.AddCommand(newStackLintCmd(rootConfig))
 	stackCmd.AddCommand(newStackValidateCmd(rootConfig))
 	stackCmd.AddCommand(newStackPackageCmd(rootConfig))
+	stackCmd.AddCommand(newStackDescribeCmd(rootConfig))
 	return stackCmd
 }
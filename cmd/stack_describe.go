@@ -0,0 +1,101 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newStackDescribeCmd(rootConfig *RootCommandConfig) *cobra.Command {
+	var stackDescribeCmd = &cobra.Command{
+		Use:   "describe [stack image]",
+		Short: "Describe the build args and platforms of a stack image",
+		Long: `Describe the stack image, the build args its Dockerfile accepts and the platforms it supports.
+
+By default, the stack image of the Appsody project in the current directory is described.`,
+		Example: `  appsody stack describe
+  Describes the stack of the project in the current directory
+
+  appsody stack describe appsody/nodejs-express:0.4
+  Describes the appsody/nodejs-express:0.4 stack image`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var stackImage *ImageInspect
+			var imageName string
+			var err error
+			if len(args) == 0 {
+				projectConfig, err := getProjectConfig(rootConfig)
+				if err != nil {
+					return err
+				}
+				imageName = projectConfig.Platform
+				stackImage, err = inspectStackImage(rootConfig)
+				if err != nil {
+					return err
+				}
+			} else {
+				imageName = args[0]
+				err = pullImage(imageName, rootConfig)
+				if err != nil {
+					return err
+				}
+				engine, err := getContainerEngine(rootConfig)
+				if err != nil {
+					return err
+				}
+				stackImage, err = engine.InspectImage(imageName)
+				if err != nil {
+					return errors.Errorf("Could not inspect the stack image %s: %v", imageName, err)
+				}
+			}
+			return describeStack(imageName, stackImage)
+		},
+	}
+	addPullPolicyFlag(stackDescribeCmd, rootConfig)
+	return stackDescribeCmd
+}
+
+func describeStack(imageName string, stackImage *ImageInspect) error {
+	labels := stackImage.Config.Labels
+	Info.log("Stack image: ", imageName)
+	for _, label := range []string{stackIDLabel, stackVersionLabel, stackPlatformsLabel} {
+		if value, found := labels[label]; found {
+			Info.logf("%s: %s", label, value)
+		}
+	}
+	stackBuildArgs, err := getStackBuildArgs(stackImage)
+	if err != nil {
+		return err
+	}
+	if stackBuildArgs == nil {
+		Info.log("The stack does not declare the build args it accepts")
+		return nil
+	}
+	if len(stackBuildArgs) == 0 {
+		Info.log("The stack accepts no build arg")
+		return nil
+	}
+	table := uitable.New()
+	table.MaxColWidth = 80
+	table.Wrap = true
+	table.AddRow("BUILD ARG", "DESCRIPTION")
+	for _, stackBuildArg := range stackBuildArgs {
+		table.AddRow(stackBuildArg.Name, stackBuildArg.Description)
+	}
+	Info.log("\n", table)
+	return nil
+}
@@ -14,10 +14,12 @@
 package cmd
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -32,7 +34,9 @@ type StackYaml struct {
 	License         string `yaml:"license"`
 	Language        string `yaml:"language"`
 	Maintainers     []Maintainer
-	DefaultTemplate string `yaml:"default-template"`
+	DefaultTemplate string          `yaml:"default-template"`
+	Platforms       []string        `yaml:"platforms"`
+	BuildArgs       []StackBuildArg `yaml:"build-args"`
 }
 type Maintainer struct {
 	Name     string `yaml:"name"`
@@ -191,14 +195,33 @@ func newStackPackageCmd(rootConfig *RootCommandConfig) *cobra.Command {
 			Info.Log("dockerFile is: ", dockerFile)
 
 			cmdArgs := []string{"-t", buildImage}
+			if len(stackYaml.Platforms) > 0 {
+				// appsody build checks the platforms it is asked to build for against this label
+				cmdArgs = append(cmdArgs, "--label", stackPlatformsLabel+"="+strings.Join(stackYaml.Platforms, ","))
+			}
+			if len(stackYaml.BuildArgs) > 0 {
+				// appsody build checks the build args of the projects against this label
+				buildArgsLabel, err := json.Marshal(stackYaml.BuildArgs)
+				if err != nil {
+					return errors.Errorf("Error encoding the build-args of stack.yaml: %v", err)
+				}
+				cmdArgs = append(cmdArgs, "--label", stackBuildArgsLabel+"="+string(buildArgsLabel))
+			}
 
 			cmdArgs = append(cmdArgs, "-f", dockerFile, imageDir)
 			Info.Log("cmdArgs is: ", cmdArgs)
 
-			err = DockerBuild(cmdArgs, DockerLog, rootConfig.Verbose, rootConfig.Dryrun)
+			engine, err := getContainerEngine(rootConfig)
+			if err != nil {
+				return err
+			}
+			err = engine.Build(cmdArgs, DockerLog, rootConfig.Verbose, rootConfig.Dryrun)
 			if err != nil {
 				return errors.Errorf("Error during docker build: %v", err)
 			}
+			if !rootConfig.Dryrun {
+				invalidateImageCache(rootConfig, buildImage)
+			}
 
 			// tar the templates
 
@@ -14,7 +14,6 @@
 package cmd
 
 import (
-	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -298,7 +297,7 @@ func TestBuild(stack string, projectDir string) error {
 	}
 
 	// use docker image ls to check for the image
-	fmt.Println("calling docker image ls to check for the image")
+	Info.log("calling docker image ls to check for the image")
 	imageBuilt := false
 	dockerOutput, dockerErr := RunDockerCmdExec([]string{"image", "ls", imageName})
 	if dockerErr != nil {
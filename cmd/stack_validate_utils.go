@@ -16,12 +16,12 @@ package cmd
 import (
 	"bufio"
 	"bytes"
-	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 )
 
 // RunAppsodyCmdExec runs the appsody CLI with the given args in a new process
@@ -50,7 +50,7 @@ func RunAppsodyCmdExec(args []string, workingDir string) (string, error) {
 
 	cmdArgs := []string{executable, "-v"}
 	cmdArgs = append(cmdArgs, args...)
-	fmt.Println(cmdArgs)
+	Info.log("Running command: ", strings.Join(cmdArgs, " "))
 
 	execCmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
 	outReader, outWriter, err := os.Pipe()
@@ -71,7 +71,7 @@ func RunAppsodyCmdExec(args []string, workingDir string) (string, error) {
 			out := outScanner.Bytes()
 			outBuffer.Write(out)
 			outBuffer.WriteByte('\n')
-			fmt.Println(string(out))
+			Info.log(string(out))
 		}
 	}()
 
@@ -98,7 +98,7 @@ func RunDockerCmdExec(args []string) (string, error) {
 
 	cmdArgs := []string{"docker"}
 	cmdArgs = append(cmdArgs, args...)
-	fmt.Println(cmdArgs)
+	Info.log("Running command: ", strings.Join(cmdArgs, " "))
 
 	execCmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
 	outReader, outWriter, err := os.Pipe()
@@ -119,7 +119,7 @@ func RunDockerCmdExec(args []string) (string, error) {
 			out := outScanner.Bytes()
 			outBuffer.Write(out)
 			outBuffer.WriteByte('\n')
-			fmt.Println(string(out))
+			DockerLog.log(string(out))
 		}
 	}()
 
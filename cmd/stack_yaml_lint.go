@@ -33,6 +33,8 @@ type StackDetails struct {
 	License     string            `yaml:"license"`
 	Language    string            `yaml:"language"`
 	Maintainers []StackMaintainer `yaml:"maintainers"`
+	Platforms   []string          `yaml:"platforms"`
+	BuildArgs   []StackBuildArg   `yaml:"build-args"`
 }
 
 type StackMaintainer struct {
@@ -61,6 +63,8 @@ func (s *StackDetails) validateYaml(stackPath string) int {
 	stackLintErrorCount += s.validateFields()
 	stackLintErrorCount += s.checkVersion()
 	stackLintErrorCount += s.checkDescLength()
+	stackLintErrorCount += s.checkPlatforms()
+	stackLintErrorCount += s.checkBuildArgs()
 	return stackLintErrorCount
 }
 
@@ -160,3 +164,35 @@ func (s *StackDetails) checkDescLength() int {
 
 	return stackLintErrorCount
 }
+
+func (s *StackDetails) checkPlatforms() int {
+	stackLintErrorCount := 0
+
+	for _, platform := range s.Platforms {
+		if !platformFormat.MatchString(platform) {
+			Error.log("Platform ", platform, " must be in the os/arch[/variant] format, for example linux/amd64")
+			stackLintErrorCount++
+		}
+	}
+
+	return stackLintErrorCount
+}
+
+func (s *StackDetails) checkBuildArgs() int {
+	stackLintErrorCount := 0
+	names := make(map[string]bool)
+
+	for _, buildArg := range s.BuildArgs {
+		if !buildArgName.MatchString(buildArg.Name) {
+			Error.log("Build arg ", buildArg.Name, " must only have letters, digits and underscores, and not start with a digit")
+			stackLintErrorCount++
+		}
+		if names[buildArg.Name] {
+			Error.log("Build arg ", buildArg.Name, " is declared more than once")
+			stackLintErrorCount++
+		}
+		names[buildArg.Name] = true
+	}
+
+	return stackLintErrorCount
+}
@@ -20,6 +20,8 @@ import (
 
 func newStopCmd(rootConfig *RootCommandConfig) *cobra.Command {
 	var containerName string
+	var target string
+	var namespace string
 	// stopCmd represents the stop command
 	var stopCmd = &cobra.Command{
 		Use:   "stop",
@@ -28,42 +30,38 @@ func newStopCmd(rootConfig *RootCommandConfig) *cobra.Command {
 
 Stops the docker container specified by the --name flag. 
 If --name is not specified, the container name is determined from the current working directory (see default below).
-To see a list of all your running docker containers, run the command "docker ps". The name is in the last column.`,
+To see a list of all your running docker containers, run the command "docker ps". The name is in the last column.
+
+With --target kubernetes, deletes the Kubernetes resources that "appsody run --target kubernetes" created for the --name.`,
 
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if !rootConfig.Buildah {
+			err := checkTarget(target)
+			if err != nil {
+				return err
+			}
+			if !rootConfig.Buildah && target != targetKubernetes {
 				Info.log("Stopping development environment")
-				err := dockerStop(containerName, rootConfig.Dryrun)
+				engine, err := getContainerEngine(rootConfig)
+				if err != nil {
+					return err
+				}
+				err = engine.Stop(containerName, rootConfig.Dryrun)
 				if err != nil {
 					return err
 				}
 				//dockerRemove(imageName) is not needed due to --rm flag
 				//os.Exit(1)
 			} else {
-				// this is the k8s path, runs kubectl delete for the ingress, service and deployment
-				// Note for k8s the containerName does not need -dev
-				serviceArgName := containerName + "-service"
-				ingressArgName := containerName + "-ingress"
-				deploymentArgName := containerName
-				serviceArgs := []string{"service", serviceArgName}
-				deploymentArgs := []string{"deployment", deploymentArgName}
-				ingressArgs := []string{"ingress", ingressArgName}
-				_, err := RunKubeDelete(ingressArgs, rootConfig.Dryrun)
+				// this is the k8s path, deletes the resources labelled with the dev session name
+				err = deleteKubeSession(containerName, namespace, rootConfig.Dryrun)
 				if err != nil {
-					Error.logf("kubectl delete failed for ingress %s, due to %v", ingressArgName, err)
-				}
-				_, err = RunKubeDelete(serviceArgs, rootConfig.Dryrun)
-				if err != nil {
-					Error.logf("kubectl delete failed for service %s, due to %v", serviceArgName, err)
-				}
-				_, err = RunKubeDelete(deploymentArgs, rootConfig.Dryrun)
-				if err != nil {
-					Error.logf("kubectl delete failed for deployment %s, due to %v", deploymentArgName, err)
+					return err
 				}
 			}
 			return nil
 		},
 	}
 	addNameFlag(stopCmd, &containerName, rootConfig)
+	addTargetFlags(stopCmd, &target, &namespace)
 	return stopCmd
 }
@@ -0,0 +1,518 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// how often the project directory is checked for changes
+const syncInterval = 1 * time.Second
+
+// the files generated in the container are pulled back every syncBackEvery checks
+const syncBackEvery = 5
+
+// syncBackScript archives the sync back paths, given after the project directory, that changed since the
+// previous pull back. The time of a pull back is only kept once the CLI read all of its files, as it says
+// with the first argument.
+const syncBackScript = `marker=${TMPDIR:-/tmp}/.appsody-sync-back
+[ "$1" = pulled ] && mv -f "$marker.next" "$marker"
+cd "$2" || exit 1
+shift 2
+touch "$marker.next"
+if [ -f "$marker" ]; then
+  find "$@" -type f -newer "$marker" 2>/dev/null
+else
+  find "$@" -type f 2>/dev/null
+fi | tar cf - -T -`
+
+// directories that are never synced to the container
+var syncAlwaysIgnored = []string{".git", ".appsody", ".appsody_init"}
+
+// syncFileState is what the sync compares to find the changed files
+type syncFileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// kubeSync keeps the project directory of a remote dev pod in sync with the local project directory.
+// The paths it handles are relative to the project directory, with / separators.
+type kubeSync struct {
+	localDir   string
+	remoteDir  string
+	watchDirs  []string
+	watchRegex *regexp.Regexp
+	ignoreDirs []string
+	ignore     *ignoreRules
+	syncBack   []string
+	appName    string
+	namespace  string
+	pod        string
+	dryrun     bool
+	snapshot   map[string]syncFileState
+	// whether the files of the previous pull back were all read
+	pulled bool
+}
+
+// newKubeSync configures the sync from the APPSODY_WATCH_DIR, APPSODY_WATCH_REGEX and
+// APPSODY_WATCH_IGNORE_DIR variables of the stack, which use container paths
+func newKubeSync(config *devCommonConfig) (*kubeSync, error) {
+	localDir, err := getProjectDir(config.RootCommandConfig)
+	if err != nil {
+		return nil, err
+	}
+	remoteDir, err := getProjectContainerDir(config.RootCommandConfig)
+	if err != nil {
+		return nil, err
+	}
+	if remoteDir == "" {
+		return nil, errors.New("Could not determine the project directory in the container: the stack does not set APPSODY_MOUNTS or APPSODY_PROJECT_DIR")
+	}
+	syncer := &kubeSync{
+		localDir:  localDir,
+		remoteDir: path.Clean(remoteDir),
+		appName:   config.containerName,
+		namespace: config.namespace,
+		dryrun:    config.Dryrun,
+		snapshot:  map[string]syncFileState{},
+	}
+	syncer.ignore, err = loadIgnoreRules(localDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, syncBack := range config.syncBack {
+		syncer.syncBack = append(syncer.syncBack, path.Clean(filepath.ToSlash(syncBack)))
+	}
+
+	watchDirs, err := GetEnvVar("APPSODY_WATCH_DIR", config.RootCommandConfig)
+	if err != nil {
+		return nil, err
+	}
+	syncer.watchDirs = syncer.toProjectPaths(watchDirs, "APPSODY_WATCH_DIR")
+	ignoreDirs, err := GetEnvVar("APPSODY_WATCH_IGNORE_DIR", config.RootCommandConfig)
+	if err != nil {
+		return nil, err
+	}
+	syncer.ignoreDirs = append(syncer.toProjectPaths(ignoreDirs, "APPSODY_WATCH_IGNORE_DIR"), syncAlwaysIgnored...)
+	watchRegex, err := GetEnvVar("APPSODY_WATCH_REGEX", config.RootCommandConfig)
+	if err != nil {
+		return nil, err
+	}
+	if watchRegex != "" {
+		syncer.watchRegex, err = regexp.Compile(watchRegex)
+		if err != nil {
+			return nil, errors.Errorf("The APPSODY_WATCH_REGEX of the stack is not a valid regular expression: %v", err)
+		}
+	}
+	Debug.logf("Sync of %s to %s, watching %v, ignoring %v", syncer.localDir, syncer.remoteDir, syncer.watchDirs, syncer.ignoreDirs)
+	return syncer, nil
+}
+
+// toProjectPaths turns a ; separated list of container paths into paths relative to the project directory,
+// skipping the ones outside of it, which are not synced
+func (syncer *kubeSync) toProjectPaths(containerPaths string, variable string) []string {
+	var projectPaths []string
+	for _, containerPath := range strings.Split(containerPaths, ";") {
+		containerPath = strings.TrimSpace(containerPath)
+		if containerPath == "" {
+			continue
+		}
+		containerPath = path.Clean(containerPath)
+		if containerPath == syncer.remoteDir {
+			projectPaths = append(projectPaths, ".")
+		} else if strings.HasPrefix(containerPath, syncer.remoteDir+"/") {
+			projectPaths = append(projectPaths, strings.TrimPrefix(containerPath, syncer.remoteDir+"/"))
+		} else {
+			Debug.logf("Ignoring %s %s, it is outside of the project directory %s", variable, containerPath, syncer.remoteDir)
+		}
+	}
+	return projectPaths
+}
+
+// inDir reports whether the project path is the directory or in it
+func inDir(projectPath string, dir string) bool {
+	return dir == "." || projectPath == dir || strings.HasPrefix(projectPath, dir+"/")
+}
+
+func (syncer *kubeSync) ignored(projectPath string) bool {
+	for _, ignoreDir := range syncer.ignoreDirs {
+		if inDir(projectPath, ignoreDir) {
+			return true
+		}
+	}
+	return syncer.ignore.ignored(projectPath)
+}
+
+// watched reports whether a change to the file is synced while the environment runs:
+// the file must be in one of the watched directories and match the watch regex
+func (syncer *kubeSync) watched(projectPath string) bool {
+	inWatchDir := len(syncer.watchDirs) == 0
+	for _, watchDir := range syncer.watchDirs {
+		if inDir(projectPath, watchDir) {
+			inWatchDir = true
+		}
+	}
+	if !inWatchDir {
+		return false
+	}
+	return syncer.watchRegex == nil || syncer.watchRegex.MatchString(path.Join(syncer.remoteDir, projectPath))
+}
+
+// scan returns the state of the files of the project that are not ignored
+func (syncer *kubeSync) scan() (map[string]syncFileState, error) {
+	files := map[string]syncFileState{}
+	err := filepath.Walk(syncer.localDir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			// the file may have been removed during the walk
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		relative, err := filepath.Rel(syncer.localDir, file)
+		if err != nil {
+			return err
+		}
+		projectPath := filepath.ToSlash(relative)
+		if projectPath == "." {
+			return nil
+		}
+		if syncer.ignored(projectPath) {
+			// an exception of .appsodyignore may include some of the content of the directory
+			if info.IsDir() && (syncer.ignore.skipDir(projectPath) || !syncer.ignore.ignored(projectPath)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			files[projectPath] = syncFileState{info.ModTime(), info.Size()}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Errorf("Could not scan the project directory %s: %v", syncer.localDir, err)
+	}
+	return files, nil
+}
+
+// kubectlExec runs a command in the dev container, with the input on its stdin
+func (syncer *kubeSync) kubectlExec(input io.Reader, command ...string) ([]byte, error) {
+	return kubeExec(syncer.pod, syncer.appName, syncer.namespace, input, syncer.dryrun, command...)
+}
+
+// kubectlExecRead runs a command in the dev container and passes its output to read as it is written
+func (syncer *kubeSync) kubectlExecRead(read func(output io.Reader) error, command ...string) error {
+	kargs := kubeExecArgs(syncer.pod, syncer.appName, syncer.namespace, command)
+	Debug.log("Running command: kubectl ", strings.Join(kargs, " "))
+	execCmd := exec.Command("kubectl", kargs...)
+	var stderr bytes.Buffer
+	execCmd.Stderr = &stderr
+	output, err := execCmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = execCmd.Start()
+	if err != nil {
+		return err
+	}
+	readErr := read(output)
+	// the rest of the output is drained, so that kubectl does not block writing it
+	_, _ = io.Copy(ioutil.Discard, output)
+	err = execCmd.Wait()
+	if err != nil {
+		return errors.Errorf("kubectl exec failed: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return readErr
+}
+
+func kubeExecArgs(pod string, container string, namespace string, command []string) []string {
+	kargs := []string{"exec", "-i", pod, "-c", container}
+	if namespace != "" {
+		kargs = append(kargs, "--namespace", namespace)
+	}
+	kargs = append(kargs, "--")
+	return append(kargs, command...)
+}
+
+// kubeExec runs a command in a container of the pod, with the input on its stdin
+func kubeExec(pod string, container string, namespace string, input io.Reader, dryrun bool, command ...string) ([]byte, error) {
+	kargs := kubeExecArgs(pod, container, namespace, command)
+	if dryrun {
+		Info.log("Dry run - skipping execution of: kubectl ", strings.Join(kargs, " "))
+		return nil, nil
+	}
+	Debug.log("Running command: kubectl ", strings.Join(kargs, " "))
+	execCmd := exec.Command("kubectl", kargs...)
+	execCmd.Stdin = input
+	var stderr bytes.Buffer
+	execCmd.Stderr = &stderr
+	output, err := execCmd.Output()
+	if err != nil {
+		return output, errors.Errorf("kubectl exec failed: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+// findPod returns the running pod of the dev deployment
+func (syncer *kubeSync) findPod() (string, error) {
+	if syncer.dryrun {
+		return syncer.appName, nil
+	}
+	getArgs := []string{"pods", "--selector", "app=" + syncer.appName, "--field-selector", "status.phase=Running", "-o", "jsonpath={.items[0].metadata.name}"}
+	pod, err := KubeGet(getArgs, syncer.namespace, syncer.dryrun)
+	if err != nil {
+		return "", err
+	}
+	pod = strings.TrimSpace(pod)
+	if pod == "" {
+		return "", errors.Errorf("There is no running pod for %s", syncer.appName)
+	}
+	return pod, nil
+}
+
+// push copies the files into the container, as a tar archive extracted in the project directory.
+// The archive is streamed to kubectl as it is written.
+func (syncer *kubeSync) push(files []string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	command := []string{"tar", "xf", "-", "-C", syncer.remoteDir}
+	if syncer.dryrun {
+		_, err := syncer.kubectlExec(nil, command...)
+		return err
+	}
+	reader, writer := io.Pipe()
+	archived := make(chan error, 1)
+	go func() {
+		err := syncer.writeArchive(writer, files)
+		writer.CloseWithError(err)
+		archived <- err
+	}()
+	_, err := syncer.kubectlExec(reader, command...)
+	// stops the archive if kubectl exited before reading all of it
+	reader.Close()
+	archiveErr := <-archived
+	if err != nil {
+		return err
+	}
+	return archiveErr
+}
+
+// writeArchive writes the files as a tar archive
+func (syncer *kubeSync) writeArchive(archive io.Writer, files []string) error {
+	tarWriter := tar.NewWriter(archive)
+	for _, projectPath := range files {
+		file := filepath.Join(syncer.localDir, filepath.FromSlash(projectPath))
+		info, err := os.Stat(file)
+		if err != nil {
+			// removed since the scan, the next scan reports it
+			continue
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = projectPath
+		err = tarWriter.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		content, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tarWriter, content)
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return tarWriter.Close()
+}
+
+// remove deletes the files from the container
+func (syncer *kubeSync) remove(files []string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	command := []string{"rm", "-f", "--"}
+	for _, projectPath := range files {
+		command = append(command, path.Join(syncer.remoteDir, projectPath))
+	}
+	_, err := syncer.kubectlExec(nil, command...)
+	return err
+}
+
+// start finds the pod and copies the whole project into it
+func (syncer *kubeSync) start() error {
+	pod, err := syncer.findPod()
+	if err != nil {
+		return err
+	}
+	syncer.pod = pod
+	files, err := syncer.scan()
+	if err != nil {
+		return err
+	}
+	var all []string
+	for projectPath := range files {
+		all = append(all, projectPath)
+	}
+	sort.Strings(all)
+	Info.logf("Syncing %d files of %s to %s in pod %s", len(all), syncer.localDir, syncer.remoteDir, syncer.pod)
+	err = syncer.push(all)
+	if err != nil {
+		return errors.Errorf("Could not sync the project to the pod %s: %v", syncer.pod, err)
+	}
+	syncer.snapshot = files
+	return nil
+}
+
+// poll syncs the watched files that changed or were removed since the previous poll
+func (syncer *kubeSync) poll() error {
+	files, err := syncer.scan()
+	if err != nil {
+		return err
+	}
+	var changed, removed []string
+	for projectPath, state := range files {
+		previous, found := syncer.snapshot[projectPath]
+		if (!found || previous != state) && syncer.watched(projectPath) {
+			changed = append(changed, projectPath)
+		}
+	}
+	for projectPath := range syncer.snapshot {
+		if _, found := files[projectPath]; !found && syncer.watched(projectPath) {
+			removed = append(removed, projectPath)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(removed)
+	if len(changed) > 0 {
+		Debug.log("Syncing changed files: ", changed)
+	}
+	if len(removed) > 0 {
+		Debug.log("Removing deleted files: ", removed)
+	}
+	err = syncer.push(changed)
+	if err == nil {
+		err = syncer.remove(removed)
+	}
+	if err != nil {
+		return err
+	}
+	syncer.snapshot = files
+	return nil
+}
+
+// pullBack copies the sync back paths that changed since the previous pull back from the container into
+// the project, writing only the files that differ, and records them as synced so they are not pushed again.
+// The archive of the files is read as kubectl writes it.
+func (syncer *kubeSync) pullBack() error {
+	if len(syncer.syncBack) == 0 || syncer.dryrun {
+		return nil
+	}
+	previous := "first"
+	if syncer.pulled {
+		previous = "pulled"
+	}
+	syncer.pulled = false
+	err := syncer.kubectlExecRead(syncer.readSyncBack, append([]string{"sh", "-c", syncBackScript, "sh", previous, syncer.remoteDir}, syncer.syncBack...)...)
+	if err != nil {
+		return err
+	}
+	syncer.pulled = true
+	return nil
+}
+
+// readSyncBack writes the files of the archive into the project
+func (syncer *kubeSync) readSyncBack(archive io.Reader) error {
+	tarReader := tar.NewReader(archive)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Errorf("Could not read the files synced back: %v", err)
+		}
+		projectPath := path.Clean(header.Name)
+		if header.Typeflag != tar.TypeReg || strings.HasPrefix(projectPath, "../") || path.IsAbs(projectPath) {
+			continue
+		}
+		content, err := ioutil.ReadAll(tarReader)
+		if err != nil {
+			return err
+		}
+		file := filepath.Join(syncer.localDir, filepath.FromSlash(projectPath))
+		if existing, readErr := ioutil.ReadFile(file); readErr == nil && bytes.Equal(existing, content) {
+			continue
+		}
+		Debug.log("Syncing back ", projectPath)
+		err = os.MkdirAll(filepath.Dir(file), os.ModePerm)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(file, content, os.FileMode(header.Mode)&os.ModePerm)
+		if err != nil {
+			return err
+		}
+		if info, statErr := os.Stat(file); statErr == nil {
+			syncer.snapshot[projectPath] = syncFileState{info.ModTime(), info.Size()}
+		}
+	}
+}
+
+// run polls the project until stop is closed. If the pod was replaced, the project is synced
+// to the new pod, as its workspace starts empty.
+func (syncer *kubeSync) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+	for polls := 1; ; polls++ {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		err := syncer.poll()
+		if err == nil && polls%syncBackEvery == 0 {
+			err = syncer.pullBack()
+		}
+		if err == nil {
+			continue
+		}
+		Debug.log("Sync failed: ", err)
+		if pod, podErr := syncer.findPod(); podErr == nil && pod != syncer.pod {
+			Info.log("The pod was replaced by ", pod, ", syncing the project again")
+			err = syncer.start()
+		}
+		if err != nil {
+			Warning.log("Could not sync the project to the pod: ", err)
+		}
+	}
+}
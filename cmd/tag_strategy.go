@@ -0,0 +1,182 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// The strategies that compute the tags of the images build and deploy create
+const (
+	tagGitSHA      = "git-sha"
+	tagGitDescribe = "git-describe"
+	tagTimestamp   = "timestamp"
+	tagSemver      = "semver-from-config"
+	tagLatest      = "latest"
+)
+
+var supportedTagStrategies = []string{tagGitSHA, tagGitDescribe, tagTimestamp, tagSemver, tagLatest}
+
+// the length of the commit SHA in git-sha tags
+const gitSHATagLength = 12
+
+var validTag = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+var semverVersion = regexp.MustCompile(`^v?(\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?)(\+[0-9A-Za-z.-]+)?$`)
+
+func addTagStrategyFlag(cmd *cobra.Command, tagStrategy *string) {
+	cmd.PersistentFlags().StringVar(tagStrategy, "tag-strategy", "", "Comma separated list of the tags of the image: git-sha, git-describe, timestamp, semver-from-config (the version of .appsody-config.yaml) or latest, for example git-sha,latest. The first tag is the one deployed. Defaults to the tag-strategy of .appsody-config.yaml.")
+}
+
+// hasRegistry reports whether the first component of the repository is a registry host
+func hasRegistry(repository string) bool {
+	slash := strings.Index(repository, "/")
+	if slash < 0 {
+		return false
+	}
+	host := repository[:slash]
+	return strings.ContainsAny(host, ".:") || host == "localhost"
+}
+
+// inRegistry returns the repository in the registry, unless it has a registry host
+func inRegistry(repository string, registry string) string {
+	registry = strings.TrimSuffix(registry, "/")
+	if registry != "" && !hasRegistry(repository) && !strings.HasPrefix(repository, registry+"/") {
+		return registry + "/" + repository
+	}
+	return repository
+}
+
+// getTagStrategy returns the tag strategy of the flag, which defaults to the tag strategy of the project config
+func getTagStrategy(config *RootCommandConfig, tagStrategy string) (string, error) {
+	if tagStrategy != "" {
+		return tagStrategy, nil
+	}
+	projectConfig, err := getProjectConfig(config)
+	if err != nil {
+		return "", err
+	}
+	return projectConfig.TagStrategy, nil
+}
+
+// imageRepository returns the repository of the image, without its tag
+func imageRepository(image string) string {
+	if lastColon := strings.LastIndex(image, ":"); lastColon > strings.LastIndex(image, "/") {
+		return image[:lastColon]
+	}
+	return image
+}
+
+// getBuildImages returns the images to tag the build with, the first one being the image to deploy.
+// The repository is the one of image, or the project name when image is empty, in the registry,
+// which defaults to the registry of the project config. Without a tag strategy, the image is tagged as given.
+func getBuildImages(config *RootCommandConfig, gitInfo *GitInfo, image string, tagStrategy string, registry string) ([]string, error) {
+	projectConfig, err := getProjectConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if tagStrategy == "" {
+		tagStrategy = projectConfig.TagStrategy
+	}
+	if registry == "" {
+		registry = projectConfig.Registry
+	}
+
+	repository := image
+	var imageTag string
+	if lastColon := strings.LastIndex(image, ":"); lastColon > strings.LastIndex(image, "/") {
+		repository, imageTag = image[:lastColon], image[lastColon+1:]
+	}
+	if repository == "" {
+		repository, err = getProjectName(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	repository = inRegistry(repository, registry)
+
+	if imageTag == "" && tagStrategy == "" {
+		return []string{repository}, nil
+	}
+	tags := []string{imageTag}
+	for _, strategy := range strings.Split(tagStrategy, ",") {
+		strategy = strings.TrimSpace(strategy)
+		if strategy == "" {
+			continue
+		}
+		tag, err := strategyTag(projectConfig, gitInfo, strategy)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	var images []string
+	for _, tag := range uniqueStrings(tags) {
+		if !validTag.MatchString(tag) {
+			return nil, errors.Errorf("%s is not a valid image tag", tag)
+		}
+		images = append(images, repository+":"+tag)
+	}
+	Debug.log("Images of the build: ", images)
+	return images, nil
+}
+
+// strategyTag computes the tag of a tag strategy
+func strategyTag(projectConfig ProjectConfig, gitInfo *GitInfo, strategy string) (string, error) {
+	switch strategy {
+	case tagLatest:
+		return "latest", nil
+	case tagTimestamp:
+		return time.Now().UTC().Format("20060102-150405"), nil
+	case tagSemver:
+		if projectConfig.Version == "" {
+			return "", errors.Errorf("The %s tag strategy needs the version of the project in %s, for example version: 1.0.0", tagSemver, ConfigFile)
+		}
+		match := semverVersion.FindStringSubmatch(projectConfig.Version)
+		if match == nil {
+			return "", errors.Errorf("The version %s in %s is not a semantic version such as 1.0.0", projectConfig.Version, ConfigFile)
+		}
+		// image tags cannot contain the + of the build metadata
+		return match[1] + strings.ReplaceAll(match[3], "+", "_"), nil
+	case tagGitSHA:
+		if gitInfo == nil {
+			return "", errors.Errorf("The %s tag strategy needs the project to be a Git repository", tagGitSHA)
+		}
+		sha := gitInfo.Commit.SHA
+		if sha == "" {
+			return "", errors.Errorf("The %s tag strategy needs a commit in the Git repository of the project", tagGitSHA)
+		}
+		if len(sha) > gitSHATagLength {
+			sha = sha[:gitSHATagLength]
+		}
+		if gitInfo.ChangesMade {
+			sha += "-dirty"
+		}
+		return sha, nil
+	case tagGitDescribe:
+		description, err := RunGitDescribe(false)
+		if err != nil {
+			return "", errors.Errorf("The %s tag strategy needs the project to be a Git repository with a commit: %v", tagGitDescribe, err)
+		}
+		return description, nil
+	}
+	return "", errors.Errorf("Unsupported tag strategy %s. Use one of: %s", strategy, strings.Join(supportedTagStrategies, ", "))
+}
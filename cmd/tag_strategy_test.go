@@ -0,0 +1,54 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd/cmdtest"
+)
+
+func TestBuildTagStrategy(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	project, cleanup := newTestProject(t, "tags-project", "test/tags-stack:0.1", "")
+	defer cleanup()
+	project.writeFiles(t, map[string]string{
+		".appsody-config.yaml": "stack: test/tags-stack:0.1\nversion: 1.2.3+build.5\nregistry: registry.example.com/team\n",
+	})
+	sha := commitGitProject(t, project.dir, "https://github.com/example/tags-project.git")
+
+	var tests = []struct {
+		args     []string
+		expected string
+	}{
+		{nil, "-t registry.example.com/team/tags-project --label"},
+		{[]string{"--tag-strategy", "git-sha,latest"}, "-t registry.example.com/team/tags-project:" + sha[:12] + " -t registry.example.com/team/tags-project:latest --label"},
+		{[]string{"--tag-strategy", "semver-from-config"}, "-t registry.example.com/team/tags-project:1.2.3_build.5 --label"},
+		{[]string{"-t", "quay.io/other/app:rc1", "--tag-strategy", "latest"}, "-t quay.io/other/app:rc1 -t quay.io/other/app:latest --label"},
+	}
+	for _, test := range tests {
+		args := project.appsodyArgs(append([]string{"build", "--dryrun"}, test.args...)...)
+		output, err := cmdtest.RunAppsodyCmd(args, project.dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(output, test.expected) {
+			t.Errorf("Expected build %v to run with %s. CLI output:\n%s", test.args, test.expected, output)
+		}
+	}
+}
@@ -23,7 +23,10 @@ func newTestCmd(rootConfig *RootCommandConfig) *cobra.Command {
 		Short: "Test your project in the local Appsody environment",
 		Long:  `This starts a docker container for your project and runs your test in it.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-
+			err := applyRunProfile(cmd, config)
+			if err != nil {
+				return err
+			}
 			Info.log("Running test environment")
 			return commonCmd(config, "test")
 		},
@@ -0,0 +1,140 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// startFakeDockerDaemon serves the given handler on a unix socket and returns the DOCKER_HOST for it
+func startFakeDockerDaemon(t *testing.T, handler http.Handler) (string, func()) {
+	dir, err := ioutil.TempDir("", "appsody-docker-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: handler}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	return "unix://" + socket, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// the inspect of a stack image that mounts the project in /project/user-app
+const defaultStackInspect = `{"Id": "sha256:9abc", "Config": {"Env": ["APPSODY_MOUNTS=.:/project/user-app", "APPSODY_PROJECT_DIR=/project"]}}`
+
+// testProject is an Appsody project with its own CLI home directory, built with a fake docker daemon
+type testProject struct {
+	// the home directory of the CLI, set in configFile
+	home       string
+	configFile string
+	dir        string
+	// the handlers of the fake docker daemon, which more can be added to
+	mux *http.ServeMux
+}
+
+// newTestProject creates a CLI home directory with its config.yaml and a project directory in it with an
+// .appsody-config.yaml for the stack image. DOCKER_HOST is set to a fake docker daemon that serves stackInspect
+// as the inspect of the stack image, or defaultStackInspect if it is "". The returned function removes the
+// directories, stops the daemon and restores DOCKER_HOST.
+func newTestProject(t *testing.T, projectName string, stack string, stackInspect string) (*testProject, func()) {
+	home, err := ioutil.TempDir("", "appsody-"+projectName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	project := &testProject{
+		home:       home,
+		configFile: filepath.Join(home, "config.yaml"),
+		dir:        filepath.Join(home, projectName),
+		mux:        http.NewServeMux(),
+	}
+	err = ioutil.WriteFile(project.configFile, []byte("home: "+home+"\n"), 0644)
+	if err == nil {
+		err = os.MkdirAll(project.dir, os.ModePerm)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(project.dir, ".appsody-config.yaml"), []byte("stack: "+stack+"\n"), 0644)
+	}
+	if err != nil {
+		os.RemoveAll(home)
+		t.Fatal(err)
+	}
+
+	if stackInspect == "" {
+		stackInspect = defaultStackInspect
+	}
+	project.mux.HandleFunc("/images/"+stack+"/json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(stackInspect))
+	})
+	project.mux.HandleFunc("/_ping", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("OK"))
+	})
+	dockerHost, stopDaemon := startFakeDockerDaemon(t, project.mux)
+	oldDockerHost := os.Getenv("DOCKER_HOST")
+	os.Setenv("DOCKER_HOST", dockerHost)
+	return project, func() {
+		os.Setenv("DOCKER_HOST", oldDockerHost)
+		stopDaemon()
+		os.RemoveAll(home)
+	}
+}
+
+// writeFiles writes the files, by their slash separated path in the project directory
+func (project *testProject) writeFiles(t *testing.T, files map[string]string) {
+	for name, content := range files {
+		file := filepath.Join(project.dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(file), os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(file, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// installFakeDocker puts a docker command that runs the shell script first in the PATH,
+// and returns the function that restores the PATH
+func (project *testProject) installFakeDocker(t *testing.T, script string) func() {
+	binDir := filepath.Join(project.home, "bin")
+	err := os.MkdirAll(binDir, os.ModePerm)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(binDir, "docker"), []byte("#!/bin/sh\n"+script), 0755)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", binDir+string(os.PathListSeparator)+oldPath)
+	return func() { os.Setenv("PATH", oldPath) }
+}
+
+// appsodyArgs returns the args of a command of the project, run with the docker API engine without pulling the stack image
+func (project *testProject) appsodyArgs(args ...string) []string {
+	return append(args, "--config", project.configFile, "--engine", "docker-api", "--pull", "missing")
+}
@@ -19,7 +19,6 @@ import (
 	"bytes"
 	"compress/gzip"
 	"crypto/sha256"
-	"encoding/json"
 	"fmt"
 	"hash"
 	"io"
@@ -41,7 +40,14 @@ import (
 )
 
 type ProjectConfig struct {
-	Platform string
+	Platform    string
+	Profiles    map[string]RunProfile
+	Version     string
+	Registry    string
+	TagStrategy string
+	// BuildArgs are by name, which is case sensitive
+	BuildArgs map[string]string
+	Target    string
 }
 
 type NotAnAppsodyProject string
@@ -67,6 +73,34 @@ func Exists(path string) (bool, error) {
 	return true, err
 }
 
+// writeFileAtomic writes the file through a temporary file in the same directory, so that a concurrent
+// appsody command reads either the previous or the new content, never a partly written file
+func writeFileAtomic(file string, data []byte, perm os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(file), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	tempFile, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+"-*")
+	if err != nil {
+		return err
+	}
+	_, err = tempFile.Write(data)
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tempFile.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), file)
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+	}
+	return err
+}
+
 func GetEnvVar(searchEnvVar string, config *RootCommandConfig) (string, error) {
 	if config.cachedEnvVars == nil {
 		config.cachedEnvVars = make(map[string]string)
@@ -77,60 +111,16 @@ func GetEnvVar(searchEnvVar string, config *RootCommandConfig) (string, error) {
 		return value, nil
 	}
 
-	// Docker and Buildah produce slightly different output
-	// for `inspect` command. Array of maps vs. maps
-	var dataBuildah map[string]interface{}
-	var dataDocker []map[string]interface{}
-	projectConfig, projectConfigErr := getProjectConfig(config)
-	if projectConfigErr != nil {
-		return "", projectConfigErr
-	}
-	imageName := projectConfig.Platform
-	pullErrs := pullImage(imageName, config)
-	if pullErrs != nil {
-		return "", pullErrs
-	}
-	cmdName := "docker"
-	cmdArgs := []string{"image", "inspect", imageName}
-	if config.Buildah {
-		cmdName = "buildah"
-		cmdArgs = []string{"inspect", "--format={{.Config}}", imageName}
-	}
-
-	inspectCmd := exec.Command(cmdName, cmdArgs...)
-	inspectOut, inspectErr := inspectCmd.Output()
+	stackImage, inspectErr := inspectStackImage(config)
 	if inspectErr != nil {
-		return "", errors.Errorf("Could not inspect the image: %v", inspectErr)
-
-	}
-
-	var err error
-	var envVars []interface{}
-	if config.Buildah {
-		err = json.Unmarshal([]byte(inspectOut), &dataBuildah)
-		if err != nil {
-			return "", errors.New("error unmarshaling data from inspect command - exiting")
-		}
-		buildahConfig := dataBuildah["config"].(map[string]interface{})
-		envVars = buildahConfig["Env"].([]interface{})
-
-	} else {
-		err = json.Unmarshal([]byte(inspectOut), &dataDocker)
-		if err != nil {
-			return "", errors.New("error unmarshaling data from inspect command - exiting")
-
-		}
-		dockerConfig := dataDocker[0]["Config"].(map[string]interface{})
-
-		envVars = dockerConfig["Env"].([]interface{})
+		return "", inspectErr
 	}
+	envVars := stackImage.Config.Env
 
 	Debug.log("Number of environment variables in stack image: ", len(envVars))
 	Debug.log("All environment variables in stack image: ", envVars)
 	var varFound = false
-	for _, envVar := range envVars {
-		nameValuePair := strings.SplitN(envVar.(string), "=", 2)
-		name, value := nameValuePair[0], nameValuePair[1]
+	for name, value := range stackImage.envVars() {
 		config.cachedEnvVars[name] = value
 		if name == searchEnvVar {
 			varFound = true
@@ -296,7 +286,33 @@ func getProjectConfig(config *RootCommandConfig) (ProjectConfig, error) {
 			stack = imageRepo + "/" + stack
 		}
 		Debug.log("Pulling stack image as: ", stack)
-		config.ProjectConfig = &ProjectConfig{stack}
+		var profiles map[string]RunProfile
+		err = v.UnmarshalKey("profiles", &profiles)
+		if err != nil {
+			var tempProjectConfig ProjectConfig
+			return tempProjectConfig, errors.Errorf("Error reading the profiles of the project config %v", err)
+		}
+		// viper lowercases the keys of maps, so the build args are read from the YAML
+		var buildConfig struct {
+			BuildArgs map[string]string `yaml:"buildArgs"`
+		}
+		configBytes, err := ioutil.ReadFile(appsodyConfig)
+		if err == nil {
+			err = yaml.Unmarshal(configBytes, &buildConfig)
+		}
+		if err != nil {
+			var tempProjectConfig ProjectConfig
+			return tempProjectConfig, errors.Errorf("Error reading the build args of the project config %v", err)
+		}
+		config.ProjectConfig = &ProjectConfig{
+			Platform:    stack,
+			Profiles:    profiles,
+			Version:     v.GetString("version"),
+			Registry:    v.GetString("registry"),
+			TagStrategy: v.GetString("tag-strategy"),
+			BuildArgs:   buildConfig.BuildArgs,
+			Target:      v.GetString("target"),
+		}
 	}
 	return *config.ProjectConfig, nil
 }
@@ -415,15 +431,12 @@ func copyDir(fromDir string, toDir string) error {
 }
 
 // CheckPrereqs checks the prerequisites to run the CLI
-func CheckPrereqs() error {
-	dockerCmd := "docker"
-	dockerArgs := []string{"ps"}
-	checkDockerCmd := exec.Command(dockerCmd, dockerArgs...)
-	_, cmdErr := checkDockerCmd.Output()
-	if cmdErr != nil {
-		return errors.New("docker does not seem to be installed or running - failed to execute docker ps")
+func CheckPrereqs(config *RootCommandConfig) error {
+	engine, engineErr := getContainerEngine(config)
+	if engineErr != nil {
+		return engineErr
 	}
-	return nil
+	return engine.CheckAvailable()
 }
 
 // UserHomeDir returns the current user's home directory or '.'
@@ -438,63 +451,64 @@ func UserHomeDir() string {
 }
 
 func getExposedPorts(config *RootCommandConfig) ([]string, error) {
-	// TODO cache this so the docker inspect command only runs once per cli invocation
-	var data []map[string]interface{}
-	var buildahData map[string]interface{}
-	var portValues []string
+	stackImage, inspectErr := inspectStackImage(config)
+	if inspectErr != nil {
+		return nil, inspectErr
+	}
+	return stackImage.exposedPorts(), nil
+}
+
+// inspectStackImage pulls the stack image of the project if needed and returns its configuration.
+// The result is kept in the image cache, so the image is only inspected again when its ID changes.
+func inspectStackImage(config *RootCommandConfig) (*ImageInspect, error) {
 	projectConfig, projectConfigErr := getProjectConfig(config)
 	if projectConfigErr != nil {
 		return nil, projectConfigErr
 	}
 	imageName := projectConfig.Platform
+	if config.stackImages == nil {
+		config.stackImages = make(map[string]*ImageInspect)
+	}
+	if stackImage, present := config.stackImages[imageName]; present {
+		return stackImage, nil
+	}
 	pullErrs := pullImage(imageName, config)
 	if pullErrs != nil {
 		return nil, pullErrs
 	}
-
-	cmdName := "docker"
-	cmdArgs := []string{"image", "inspect", imageName}
-	if config.Buildah {
-		cmdName = "buildah"
-		cmdArgs = []string{"inspect", "--format", "{{.Config}}", imageName}
+	engine, engineErr := getContainerEngine(config)
+	if engineErr != nil {
+		return nil, engineErr
 	}
-	Debug.Logf("About to run %s with args %s ", cmdName, cmdArgs)
-	inspectCmd := exec.Command(cmdName, cmdArgs...)
-	inspectOut, inspectErr := inspectCmd.Output()
-	if inspectErr != nil {
-		return portValues, errors.Errorf("Could not inspect the image: %v", inspectErr)
+	cacheFile := getImageCacheFile(config, engine)
+	cache := loadImageCache(cacheFile)
+	// the ID of the image is cheaper to get than its configuration
+	imageID, idErr := engine.ImageID(imageName)
+	if idErr != nil {
+		Debug.log("Could not get the ID of image ", imageName, ": ", idErr)
 	}
-	if config.Buildah {
-		err := json.Unmarshal([]byte(inspectOut), &buildahData)
-		if err != nil {
-			return portValues, errors.Errorf("Error unmarshaling data from inspect command - exiting %v", err)
-		}
-	} else {
-		err := json.Unmarshal([]byte(inspectOut), &data)
-		if err != nil {
-			return portValues, errors.Errorf("Error unmarshaling data from inspect command - exiting %v", err)
-		}
+	if stackImage := cache.lookup(imageName, imageID); stackImage != nil {
+		Debug.log("Using the cached configuration of image ", imageName, " ", stackImage.ID)
+		config.stackImages[imageName] = stackImage
+		return stackImage, nil
 	}
-	var containerConfig map[string]interface{}
-
-	if config.Buildah {
-		containerConfig = buildahData["config"].(map[string]interface{})
-		Debug.Log("Config inspected by buildah: ", config)
-	} else {
-		containerConfig = data[0]["Config"].(map[string]interface{})
+	stackImage, inspectErr := engine.InspectImage(imageName)
+	if inspectErr != nil {
+		return nil, inspectErr
 	}
-
-	if containerConfig["ExposedPorts"] != nil {
-		exposedPorts := containerConfig["ExposedPorts"].(map[string]interface{})
-
-		portValues = make([]string, 0, len(exposedPorts))
-		for k := range exposedPorts {
-			portValues = append(portValues, strings.Split(k, "/tcp")[0])
+	if stackImage.ID == "" {
+		// buildah does not return the ID with the configuration
+		stackImage.ID = imageID
+	}
+	if !config.Dryrun && stackImage.ID != "" {
+		cache.store(imageName, stackImage)
+		saveErr := cache.save(cacheFile)
+		if saveErr != nil {
+			Warning.log("Could not save the image cache: ", saveErr)
 		}
-
 	}
-	return portValues, nil
-
+	config.stackImages[imageName] = stackImage
+	return stackImage, nil
 }
 
 //GenKnativeYaml generates a simple yaml for KNative serving
@@ -588,8 +602,11 @@ func GenKnativeYaml(yamlTemplate string, deployPort int, serviceName string, dep
 	return yamlFile, nil
 }
 
-//GenDeploymentYaml generates a simple yaml for a plaing K8S deployment
-func GenDeploymentYaml(appName string, imageName string, ports []string, pdir string, projectLabel string, dryrun bool) (fileName string, err error) {
+//GenDeploymentYaml generates a simple yaml for a plaing K8S deployment, with the labels on the deployment and its pods.
+//The project is mounted in projectMount from the workspaceClaim volume claim, or from an empty directory the files are synced to if it is "".
+//Without a workspace claim, the controller is not read from the appsody-controller volume claim of the cluster either:
+//an init container waits for the CLI to copy it into an empty directory.
+func GenDeploymentYaml(appName string, imageName string, ports []string, pdir string, labels map[string]string, namespace string, workspaceClaim string, projectMount string, dryrun bool) (fileName string, err error) {
 	// KNative serving YAML representation in a struct
 	type Port struct {
 		Name          string `yaml:"name,omitempty"`
@@ -623,8 +640,8 @@ func GenDeploymentYaml(appName string, imageName string, ports []string, pdir st
 		PersistentVolumeClaim struct {
 			ClaimName string `yaml:"claimName"`
 		} `yaml:"persistentVolumeClaim,omitempty"`
-		EmptyDir struct {
-			Medium string `yaml:"medium"`
+		EmptyDir *struct {
+			Medium string `yaml:"medium,omitempty"`
 		} `yaml:"emptyDir,omitempty"`
 	}
 
@@ -632,8 +649,9 @@ func GenDeploymentYaml(appName string, imageName string, ports []string, pdir st
 		APIVersion string `yaml:"apiVersion"`
 		Kind       string `yaml:"kind"`
 		Metadata   struct {
-			Name      string `yaml:"name"`
-			Namespace string `yaml:"namespace,omitempty"`
+			Name      string            `yaml:"name"`
+			Namespace string            `yaml:"namespace,omitempty"`
+			Labels    map[string]string `yaml:"labels,omitempty"`
 		} `yaml:"metadata"`
 		Spec struct {
 			Selector struct {
@@ -646,6 +664,7 @@ func GenDeploymentYaml(appName string, imageName string, ports []string, pdir st
 				} `yaml:"metadata"`
 				Spec struct {
 					ServiceAccountName string       `yaml:"serviceAccountName,omitempty"`
+					InitContainers     []*Container `yaml:"initContainers,omitempty"`
 					Containers         []*Container `yaml:"containers"`
 					Volumes            []*Volume    `yaml:"volumes"`
 				} `yaml:"spec"`
@@ -662,6 +681,7 @@ func GenDeploymentYaml(appName string, imageName string, ports []string, pdir st
 	}
 	//Set the name
 	yamlMap.Metadata.Name = appName
+	yamlMap.Metadata.Namespace = namespace
 	//Set the image
 	yamlMap.Spec.PodTemplate.Spec.Containers[0].Name = appName
 	yamlMap.Spec.PodTemplate.Spec.Containers[0].Image = imageName
@@ -684,15 +704,45 @@ func GenDeploymentYaml(appName string, imageName string, ports []string, pdir st
 	//Set the workspace volume mount
 
 	subPath := filepath.Base(pdir)
-	workspaceMount := VolumeMount{"appsody-workspace", "/project/user-app", subPath}
+	if workspaceClaim == "" {
+		subPath = ""
+	}
+	for _, volume := range yamlMap.Spec.PodTemplate.Spec.Volumes {
+		if volume.Name == "appsody-workspace" {
+			volume.PersistentVolumeClaim.ClaimName = workspaceClaim
+		}
+		if workspaceClaim == "" {
+			volume.PersistentVolumeClaim.ClaimName = ""
+			volume.EmptyDir = &struct {
+				Medium string `yaml:"medium,omitempty"`
+			}{}
+		}
+	}
+	if workspaceClaim == "" {
+		// the appsody-sa service account is only set up in the clusters the CLI runs in
+		yamlMap.Spec.PodTemplate.Spec.ServiceAccountName = ""
+		initContainer := &Container{
+			Name:         kubeControllerInit,
+			Image:        imageName,
+			Command:      []string{"sh", "-c", "until [ -f " + kubeControllerReady + " ]; do sleep 1; done"},
+			VolumeMounts: []VolumeMount{{Name: "appsody-controller", MountPath: kubeControllerDir}},
+		}
+		yamlMap.Spec.PodTemplate.Spec.InitContainers = append(yamlMap.Spec.PodTemplate.Spec.InitContainers, initContainer)
+	}
+	workspaceMount := VolumeMount{"appsody-workspace", projectMount, subPath}
 	yamlMap.Spec.PodTemplate.Spec.Containers[0].VolumeMounts = append(yamlMap.Spec.PodTemplate.Spec.Containers[0].VolumeMounts, workspaceMount)
 	//Set the deployment selector and pod label
 
 	if err != nil {
 		return "", err
 	}
-	yamlMap.Spec.Selector.MatchLabels["app"] = projectLabel
-	yamlMap.Spec.PodTemplate.Metadata.Labels["app"] = projectLabel
+	yamlMap.Spec.Selector.MatchLabels["app"] = appName
+	yamlMap.Spec.PodTemplate.Metadata.Labels["app"] = appName
+	yamlMap.Metadata.Labels = map[string]string{"app": appName}
+	for key, value := range labels {
+		yamlMap.Metadata.Labels[key] = value
+		yamlMap.Spec.PodTemplate.Metadata.Labels[key] = value
+	}
 
 	Debug.logf("YAML map: \n%v\n", yamlMap)
 	yamlStr, err := yaml.Marshal(&yamlMap)
@@ -701,13 +751,7 @@ func GenDeploymentYaml(appName string, imageName string, ports []string, pdir st
 		return "", err
 	}
 	Debug.logf("Generated YAML: \n%s\n", yamlStr)
-	// Generate file based on supplied config, defaulting to app-deploy.yaml
-	yamlFile := filepath.Join(pdir, "app-deploy.yaml")
-	if dryrun {
-		Info.log("Skipping creation of yaml file with prefix: ", yamlFile)
-		return yamlFile, nil
-	}
-	err = ioutil.WriteFile(yamlFile, yamlStr, 0666)
+	yamlFile, err := writeKubeManifest(pdir, "deployment.yaml", yamlStr, dryrun)
 	if err != nil {
 		return "", fmt.Errorf("Could not create the yaml file for deployment %v", err)
 	}
@@ -753,7 +797,7 @@ spec:
 }
 
 //GenServiceYaml returns the file name of a generated K8S Service yaml
-func GenServiceYaml(appName string, ports []string, pdir string, dryrun bool) (fileName string, err error) {
+func GenServiceYaml(appName string, ports []string, pdir string, labels map[string]string, namespace string, dryrun bool) (fileName string, err error) {
 	type Port struct {
 		Name       string `yaml:"name,omitempty"`
 		Port       int    `yaml:"port"`
@@ -763,7 +807,9 @@ func GenServiceYaml(appName string, ports []string, pdir string, dryrun bool) (f
 		APIVersion string `yaml:"apiVersion"`
 		Kind       string `yaml:"kind"`
 		Metadata   struct {
-			Name string `yaml:"name"`
+			Name      string            `yaml:"name"`
+			Namespace string            `yaml:"namespace,omitempty"`
+			Labels    map[string]string `yaml:"labels,omitempty"`
 		} `yaml:"metadata"`
 		Spec struct {
 			Selector    map[string]string `yaml:"selector"`
@@ -776,6 +822,8 @@ func GenServiceYaml(appName string, ports []string, pdir string, dryrun bool) (f
 	service.APIVersion = "v1"
 	service.Kind = "Service"
 	service.Metadata.Name = fmt.Sprintf("%s-%s", appName, "service")
+	service.Metadata.Namespace = namespace
+	service.Metadata.Labels = labels
 	service.Spec.Selector = make(map[string]string, 1)
 	service.Spec.Selector["app"] = appName
 	service.Spec.ServiceType = "NodePort"
@@ -796,21 +844,15 @@ func GenServiceYaml(appName string, ports []string, pdir string, dryrun bool) (f
 		return "", err
 	}
 	Debug.logf("Generated YAML: \n%s\n", yamlStr)
-	// Generate file based on supplied config, defaulting to app-deploy.yaml
-	yamlFile := filepath.Join(pdir, "app-service.yaml")
-	if dryrun {
-		Info.log("Skipping creation of yaml file with prefix: ", yamlFile)
-		return yamlFile, nil
-	}
-	err = ioutil.WriteFile(yamlFile, yamlStr, 0666)
+	yamlFile, err := writeKubeManifest(pdir, "service.yaml", yamlStr, dryrun)
 	if err != nil {
 		return "", fmt.Errorf("Could not create the yaml file for the service %v", err)
 	}
 	return yamlFile, nil
 }
 
-//GenRouteYaml returns the file name of a generated K8S Service yaml
-func GenRouteYaml(appName string, pdir string, port int, dryrun bool) (fileName string, err error) {
+//GenRouteYaml returns the file name of a generated K8S Ingress yaml
+func GenRouteYaml(appName string, pdir string, port int, labels map[string]string, namespace string, dryrun bool) (fileName string, err error) {
 	type IngressPath struct {
 		Path    string `yaml:"path"`
 		Backend struct {
@@ -829,7 +871,9 @@ func GenRouteYaml(appName string, pdir string, port int, dryrun bool) (fileName
 		APIVersion string `yaml:"apiVersion"`
 		Kind       string `yaml:"kind"`
 		Metadata   struct {
-			Name string `yaml:"name"`
+			Name      string            `yaml:"name"`
+			Namespace string            `yaml:"namespace,omitempty"`
+			Labels    map[string]string `yaml:"labels,omitempty"`
 		} `yaml:"metadata"`
 		Spec struct {
 			Rules []IngressRule `yaml:"rules"`
@@ -840,6 +884,8 @@ func GenRouteYaml(appName string, pdir string, port int, dryrun bool) (fileName
 	ingress.APIVersion = "extensions/v1beta1"
 	ingress.Kind = "Ingress"
 	ingress.Metadata.Name = fmt.Sprintf("%s-%s", appName, "ingress")
+	ingress.Metadata.Namespace = namespace
+	ingress.Metadata.Labels = labels
 
 	ingress.Spec.Rules = make([]IngressRule, 1)
 	ingress.Spec.Rules[0].Host = fmt.Sprintf("%s.%s.%s", appName, getK8sMasterIP(dryrun), "nip.io")
@@ -854,13 +900,7 @@ func GenRouteYaml(appName string, pdir string, port int, dryrun bool) (fileName
 		return "", err
 	}
 	Debug.logf("Generated YAML: \n%s\n", yamlStr)
-	// Generate file based on supplied config, defaulting to app-deploy.yaml
-	yamlFile := filepath.Join(pdir, "app-ingress.yaml")
-	if dryrun {
-		Info.log("Skipping creation of yaml file with prefix: ", yamlFile)
-		return yamlFile, nil
-	}
-	err = ioutil.WriteFile(yamlFile, yamlStr, 0666)
+	yamlFile, err := writeKubeManifest(pdir, "ingress.yaml", yamlStr, dryrun)
 	if err != nil {
 		return "", fmt.Errorf("Could not create the yaml file for the route %v", err)
 	}
@@ -931,67 +971,20 @@ spec:
 	return yamltempl
 }
 
-// DockerTag tags a docker image
-func DockerTag(imageToTag string, tag string, dryrun bool) error {
-	Info.log("Tagging Docker image as ", tag)
-	cmdName := "docker"
-	cmdArgs := []string{"image", "tag", imageToTag, tag}
-	if dryrun {
-		Info.log("Dry run - skipping execution of: ", cmdName, " ", strings.Join(cmdArgs, " "))
-		return nil
-	}
-	tagCmd := exec.Command(cmdName, cmdArgs...)
-	tagOut, tagErr := tagCmd.Output()
-	if tagErr != nil {
-		Error.log("Could not inspect the image: ", tagErr, " ", string(tagOut[:]))
-		return tagErr
-	}
-	Debug.log("Docker tag command output: ", string(tagOut[:]))
-	return nil
-}
-
-//DockerPush pushes a docker image to a docker registry (assumes that the user has done docker login)
-func DockerPush(imageToPush string, dryrun bool) error {
-	Info.log("Pushing docker image ", imageToPush)
-	cmdName := "docker"
-	cmdArgs := []string{"push", imageToPush}
-	if dryrun {
-		Info.log("Dry run - skipping execution of: ", cmdName, " ", strings.Join(cmdArgs, " "))
-		return nil
-	}
-	pushCmd := exec.Command(cmdName, cmdArgs...)
-	pushOut, pushErr := pushCmd.Output()
-	if pushErr != nil {
-		Error.log("Could not push the image: ", pushErr, " ", string(pushOut[:]))
-		return pushErr
-	}
-	Debug.log("Docker push command output: ", string(pushOut[:]))
-	return nil
-}
-
-// DockerRunBashCmd issues a shell command in a docker image, overriding its entrypoint
+// DockerRunBashCmd issues a shell command in a container image, overriding its entrypoint
 func DockerRunBashCmd(options []string, image string, bashCmd string, config *RootCommandConfig) (cmdOutput string, err error) {
-	cmdName := "docker"
-	var cmdArgs []string
+	engine, engineErr := getContainerEngine(config)
+	if engineErr != nil {
+		return "", engineErr
+	}
 	pullErrs := pullImage(image, config)
 	if pullErrs != nil {
 		return "", pullErrs
 	}
-	if len(options) >= 0 {
-		cmdArgs = append([]string{"run"}, options...)
-	} else {
-		cmdArgs = []string{"run"}
-	}
+	var cmdArgs []string
+	cmdArgs = append(cmdArgs, options...)
 	cmdArgs = append(cmdArgs, "--entrypoint", "/bin/bash", image, "-c", bashCmd)
-	Info.log("Running command: ", cmdName, " ", strings.Join(cmdArgs, " "))
-	dockerCmd := exec.Command(cmdName, cmdArgs...)
-	dockerOutBytes, err := dockerCmd.Output()
-	if err != nil {
-		Error.log("Could not run the docker image: ", err)
-		return "", err
-	}
-	dockerOut := strings.TrimSpace(string(dockerOutBytes))
-	return dockerOut, nil
+	return engine.RunOutput(cmdArgs)
 }
 
 //KubeGet issues kubectl get <arg>
@@ -1133,91 +1126,6 @@ func KubeGetDeploymentURL(service string, namespace string, dryrun bool) (url st
 	return "", err
 }
 
-//pullCmd
-// enable extract to use `buildah` sequences for image extraction.
-// Pull the given docker image
-func pullCmd(imageToPull string, buildah bool, dryrun bool) error {
-	cmdName := "docker"
-	if buildah {
-		cmdName = "buildah"
-	}
-	pullArgs := []string{"pull", imageToPull}
-	if dryrun {
-		Info.log("Dry run - skipping execution of: ", cmdName, " ", strings.Join(pullArgs, " "))
-		return nil
-	}
-	Info.log("Pulling docker image ", imageToPull)
-	err := execAndWaitReturnErr(cmdName, pullArgs, Info, dryrun)
-	if err != nil {
-		Warning.log("Docker image pull failed: ", err)
-		return err
-	}
-	return nil
-}
-
-func checkDockerImageExistsLocally(imageToPull string) bool {
-	cmdName := "docker"
-	cmdArgs := []string{"image", "ls", "-q", imageToPull}
-	imagelsCmd := exec.Command(cmdName, cmdArgs...)
-	imagelsOut, imagelsErr := imagelsCmd.Output()
-	imagelsOutStr := strings.TrimSpace(string(imagelsOut))
-	Debug.log("Docker image ls command output: ", imagelsOutStr)
-
-	if imagelsErr != nil {
-		Warning.log("Could not run docker image ls -q for the image: ", imageToPull, " error: ", imagelsErr, " Check to make sure docker is available.")
-		return false
-	}
-	if imagelsOutStr != "" {
-		return true
-	}
-	return false
-}
-
-//pullImage
-// pulls buildah / docker image, if APPSODY_PULL_POLICY set to IFNOTPRESENT
-//it checks for image in local repo and pulls if not in the repo
-func pullImage(imageToPull string, config *RootCommandConfig) error {
-	if config.imagePulled == nil {
-		config.imagePulled = make(map[string]bool)
-	}
-	Debug.logf("%s image pulled status: %t", imageToPull, config.imagePulled[imageToPull])
-	if config.imagePulled[imageToPull] {
-		Debug.log("Image has been pulled already: ", imageToPull)
-		return nil
-	}
-	config.imagePulled[imageToPull] = true
-
-	localImageFound := false
-	pullPolicyAlways := true
-	pullPolicy := os.Getenv("APPSODY_PULL_POLICY") // Always or IfNotPresent
-	if pullPolicy == "" || strings.ToUpper(pullPolicy) == "ALWAYS" {
-		Debug.log("Pull policy Always")
-	} else if strings.ToUpper(pullPolicy) == "IFNOTPRESENT" {
-		Debug.log("Pull policy IfNotPresent, checking for local image")
-		pullPolicyAlways = false
-	}
-	if !pullPolicyAlways {
-		localImageFound = checkDockerImageExistsLocally(imageToPull)
-	}
-
-	if pullPolicyAlways || (!pullPolicyAlways && !localImageFound) {
-		err := pullCmd(imageToPull, config.Buildah, config.Dryrun)
-		if err != nil {
-			if pullPolicyAlways {
-				localImageFound = checkDockerImageExistsLocally(imageToPull)
-			}
-			if !localImageFound {
-				return errors.Errorf("Could not find the image either in docker hub or locally: %s", imageToPull)
-
-			}
-		}
-	}
-	if localImageFound {
-		Info.log("Using local cache for image ", imageToPull)
-	}
-	return nil
-}
-
 func execAndListenWithWorkDirReturnErr(command string, args []string, logger appsodylogger, workdir string, dryrun bool) (*exec.Cmd, error) {
 	var execCmd *exec.Cmd
 	var err error
@@ -1472,3 +1380,17 @@ func Targz(source, target string) error {
 			return err
 		})
 }
+
+// formatBytes formats a size in bytes with a binary unit, such as 1.5GB
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
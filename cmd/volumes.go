@@ -0,0 +1,334 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Labels of the dependency volumes created by appsody
+const (
+	volumeLabel        = "dev.appsody.volume"
+	volumeProjectLabel = "dev.appsody.project.dir"
+	volumeStackLabel   = "dev.appsody.stack"
+	depsVolumeType     = "deps"
+)
+
+// volumeUsage records which project last used a dependency volume, and when
+type volumeUsage struct {
+	ProjectDir string    `json:"projectDir"`
+	Stack      string    `json:"stack"`
+	LastUsed   time.Time `json:"lastUsed"`
+}
+
+// depsVolume is a dependency volume with what is known about its use
+type depsVolume struct {
+	name       string
+	projectDir string
+	stack      string
+	lastUsed   time.Time
+}
+
+type volumesPruneCommandConfig struct {
+	*RootCommandConfig
+	olderThan string
+}
+
+func newVolumesCmd(rootConfig *RootCommandConfig) *cobra.Command {
+	// volumesCmd represents the volumes command
+	var volumesCmd = &cobra.Command{
+		Use:   "volumes",
+		Short: "Manage the dependency volumes of your Appsody projects",
+		Long: `Manage the volumes appsody run, debug and test create to cache the dependencies of your projects (see the --deps-volume flag).
+
+Volumes created by older versions of the CLI are found by their <project>-deps name, when they were last used is unknown until a project uses them again.`,
+	}
+	volumesCmd.AddCommand(
+		newVolumesListCmd(rootConfig),
+		newVolumesPruneCmd(rootConfig),
+	)
+	return volumesCmd
+}
+
+func newVolumesListCmd(config *RootCommandConfig) *cobra.Command {
+	var volumesListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the dependency volumes",
+		Long:  `List the dependency volumes with the project that owns them, their stack, size and when they were last used.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			volumes, err := listDepsVolumes(config)
+			if err != nil {
+				return err
+			}
+			if len(volumes) == 0 {
+				Info.log("There are no appsody dependency volumes")
+				return nil
+			}
+			engine, err := getContainerEngine(config)
+			if err != nil {
+				return err
+			}
+			sizes, err := engine.VolumeSizes()
+			if err != nil {
+				Warning.log("Could not get the size of the volumes: ", err)
+			}
+
+			table := uitable.New()
+			table.MaxColWidth = 60
+			table.AddRow("VOLUME", "PROJECT", "STACK", "SIZE", "LAST USED")
+			for _, volume := range volumes {
+				projectDir := volume.projectDir
+				if projectDir != "" && !projectDirExists(projectDir) {
+					projectDir += " (missing)"
+				}
+				lastUsed := "unknown"
+				if !volume.lastUsed.IsZero() {
+					lastUsed = volume.lastUsed.Format("2006-01-02 15:04")
+				}
+				size := sizes[volume.name]
+				if size == "" {
+					size = "unknown"
+				}
+				table.AddRow(volume.name, projectDir, volume.stack, size, lastUsed)
+			}
+			Info.log("\n", table)
+			return nil
+		},
+	}
+	return volumesListCmd
+}
+
+func newVolumesPruneCmd(rootConfig *RootCommandConfig) *cobra.Command {
+	config := &volumesPruneCommandConfig{RootCommandConfig: rootConfig}
+	var volumesPruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Remove unused dependency volumes",
+		Long: `Remove the dependency volumes whose project directory no longer exists.
+
+With --older-than, also remove the volumes that have not been used for that long, for example 30d or 72h. Volumes in use by a running container are never removed.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var maxAge time.Duration
+			if config.olderThan != "" {
+				var err error
+				maxAge, err = parseAge(config.olderThan)
+				if err != nil {
+					return err
+				}
+			}
+			volumes, err := listDepsVolumes(config.RootCommandConfig)
+			if err != nil {
+				return err
+			}
+			engine, err := getContainerEngine(config.RootCommandConfig)
+			if err != nil {
+				return err
+			}
+			usage, err := loadVolumeUsage(config.RootCommandConfig)
+			if err != nil {
+				return err
+			}
+			removed := 0
+			for _, volume := range volumes {
+				reason := ""
+				if volume.projectDir != "" && !projectDirExists(volume.projectDir) {
+					reason = "its project directory " + volume.projectDir + " no longer exists"
+				} else if config.olderThan != "" && volume.lastUsed.IsZero() {
+					reason = "it has no recorded use"
+				} else if config.olderThan != "" && time.Since(volume.lastUsed) > maxAge {
+					reason = "it was last used on " + volume.lastUsed.Format("2006-01-02")
+				}
+				if reason == "" {
+					continue
+				}
+				err = engine.RemoveVolume(volume.name, config.Dryrun)
+				if err != nil {
+					Warning.logf("Could not remove the volume %s, it may be in use by a container: %v", volume.name, err)
+					continue
+				}
+				Info.logf("Removed the volume %s: %s", volume.name, reason)
+				delete(usage, volume.name)
+				removed++
+			}
+			if removed == 0 {
+				Info.log("There are no dependency volumes to remove")
+				return nil
+			}
+			if config.Dryrun {
+				return nil
+			}
+			return saveVolumeUsage(config.RootCommandConfig, usage)
+		},
+	}
+	volumesPruneCmd.PersistentFlags().StringVar(&config.olderThan, "older-than", "", "Also remove the volumes not used for this long, for example 30d or 72h")
+	return volumesPruneCmd
+}
+
+// parseAge parses a duration that may be given in days, such as 30d, or as a Go duration
+func parseAge(age string) (time.Duration, error) {
+	if strings.HasSuffix(age, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(age, "d"))
+		if err == nil && days >= 0 {
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+	} else if duration, err := time.ParseDuration(age); err == nil && duration >= 0 {
+		return duration, nil
+	}
+	return 0, errors.Errorf("Invalid age %s, use a number of days such as 30d or a duration such as 72h", age)
+}
+
+func projectDirExists(projectDir string) bool {
+	exists, err := Exists(projectDir)
+	return err != nil || exists
+}
+
+func getVolumeUsageFile(config *RootCommandConfig) string {
+	return filepath.Join(getHome(config), "volumes.json")
+}
+
+func loadVolumeUsage(config *RootCommandConfig) (map[string]volumeUsage, error) {
+	usage := map[string]volumeUsage{}
+	usageBytes, err := ioutil.ReadFile(getVolumeUsageFile(config))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return usage, nil
+		}
+		return nil, errors.Errorf("Could not read the volume usage file: %v", err)
+	}
+	err = json.Unmarshal(usageBytes, &usage)
+	if err != nil {
+		return nil, errors.Errorf("Could not parse the volume usage file %s: %v", getVolumeUsageFile(config), err)
+	}
+	return usage, nil
+}
+
+func saveVolumeUsage(config *RootCommandConfig, usage map[string]volumeUsage) error {
+	usageBytes, err := json.MarshalIndent(usage, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(getVolumeUsageFile(config), usageBytes, 0644)
+	if err != nil {
+		return errors.Errorf("Could not write the volume usage file: %v", err)
+	}
+	return nil
+}
+
+// listDepsVolumes returns the existing volumes that carry the appsody label or have a recorded use,
+// and the volumes named like the default dependency volume, which older versions of the CLI created without labels
+func listDepsVolumes(config *RootCommandConfig) ([]depsVolume, error) {
+	engine, err := getContainerEngine(config)
+	if err != nil {
+		return nil, err
+	}
+	allVolumes, err := engine.ListVolumes()
+	if err != nil {
+		return nil, err
+	}
+	usage, err := loadVolumeUsage(config)
+	if err != nil {
+		return nil, err
+	}
+	var volumes []depsVolume
+	for _, volume := range allVolumes {
+		used, hasUsage := usage[volume.Name]
+		if volume.Labels[volumeLabel] != depsVolumeType && !hasUsage && !strings.HasSuffix(volume.Name, "-deps") {
+			continue
+		}
+		depsVolume := depsVolume{
+			name:       volume.Name,
+			projectDir: volume.Labels[volumeProjectLabel],
+			stack:      volume.Labels[volumeStackLabel],
+		}
+		if hasUsage {
+			depsVolume.projectDir = used.ProjectDir
+			depsVolume.stack = used.Stack
+			depsVolume.lastUsed = used.LastUsed
+		}
+		volumes = append(volumes, depsVolume)
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].name < volumes[j].name })
+	return volumes, nil
+}
+
+// prepareDepsVolume creates the dependency volume with the appsody labels if it does not exist,
+// recreates it if resetDeps is set, and records that the project uses it. When the engine cannot
+// inspect the volume, it is left to docker run to create, without the labels.
+func prepareDepsVolume(config *devCommonConfig) error {
+	engine, err := getContainerEngine(config.RootCommandConfig)
+	if err != nil {
+		return err
+	}
+	projectDir, err := getProjectDir(config.RootCommandConfig)
+	if err != nil {
+		return err
+	}
+	projectConfig, err := getProjectConfig(config.RootCommandConfig)
+	if err != nil {
+		return err
+	}
+	volume, err := engine.InspectVolume(config.depsVolumeName)
+	if err != nil {
+		if config.resetDeps {
+			return errors.Errorf("Could not reset the dependency volume %s: %v", config.depsVolumeName, err)
+		}
+		Warning.logf("Could not inspect the dependency volume %s, it is not labelled for appsody volumes: %v", config.depsVolumeName, err)
+		return nil
+	}
+	exists := volume != nil
+	if exists && config.resetDeps {
+		Info.log("Removing the dependency volume ", config.depsVolumeName)
+		err = engine.RemoveVolume(config.depsVolumeName, config.Dryrun)
+		if err != nil {
+			return errors.Errorf("Could not remove the dependency volume %s, stop the containers that use it and try again: %v", config.depsVolumeName, err)
+		}
+		exists = false
+	}
+	if !exists {
+		labels := map[string]string{
+			volumeLabel:        depsVolumeType,
+			volumeProjectLabel: projectDir,
+			volumeStackLabel:   projectConfig.Platform,
+		}
+		err = engine.CreateVolume(config.depsVolumeName, labels, config.Dryrun)
+		if err != nil {
+			return errors.Errorf("Could not create the dependency volume %s: %v", config.depsVolumeName, err)
+		}
+	}
+	if config.Dryrun {
+		return nil
+	}
+	usage, err := loadVolumeUsage(config.RootCommandConfig)
+	if err != nil {
+		Warning.log(err)
+		usage = map[string]volumeUsage{}
+	}
+	usage[config.depsVolumeName] = volumeUsage{ProjectDir: projectDir, Stack: projectConfig.Platform, LastUsed: time.Now()}
+	err = saveVolumeUsage(config.RootCommandConfig, usage)
+	if err != nil {
+		Warning.log(err)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/appsody/appsody/cmd/cmdtest"
+)
+
+func TestVolumesPrune(t *testing.T) {
+	home, err := ioutil.TempDir("", "appsody-volumes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	configFile := filepath.Join(home, "config.yaml")
+	// the home directory does not exist yet, the volume usage file is written with it
+	err = ioutil.WriteFile(configFile, []byte("home: "+filepath.Join(home, "appsody")+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	missingDir := filepath.Join(home, "deleted-project")
+
+	var lock sync.Mutex
+	var removed []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/volumes", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Volumes": [
+			{"Name": "deleted-project-deps", "Mountpoint": "/var/lib/docker/volumes/deleted-project-deps/_data",
+				"Labels": {"dev.appsody.volume": "deps", "dev.appsody.project.dir": "` + missingDir + `", "dev.appsody.stack": "appsody/nodejs:0.3"}},
+			{"Name": "live-project-deps", "Mountpoint": "/var/lib/docker/volumes/live-project-deps/_data",
+				"Labels": {"dev.appsody.volume": "deps", "dev.appsody.project.dir": "` + home + `", "dev.appsody.stack": "appsody/nodejs:0.3"}},
+			{"Name": "legacy-project-deps", "Mountpoint": "/var/lib/docker/volumes/legacy-project-deps/_data", "Labels": null},
+			{"Name": "unrelated", "Mountpoint": "/var/lib/docker/volumes/unrelated/_data", "Labels": null}
+		]}`))
+	})
+	mux.HandleFunc("/volumes/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		lock.Lock()
+		removed = append(removed, strings.TrimPrefix(r.URL.Path, "/volumes/"))
+		lock.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	dockerHost, cleanup := startFakeDockerDaemon(t, mux)
+	defer cleanup()
+	oldDockerHost := os.Getenv("DOCKER_HOST")
+	os.Setenv("DOCKER_HOST", dockerHost)
+	defer os.Setenv("DOCKER_HOST", oldDockerHost)
+
+	output, err := cmdtest.RunAppsodyCmd([]string{"volumes", "prune", "--engine", "docker-api", "--config", configFile}, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Lock()
+	if len(removed) != 1 || removed[0] != "deleted-project-deps" {
+		t.Errorf("Expected only the volume of the deleted project to be removed, but removed %v. CLI output:\n%s", removed, output)
+	}
+	if !strings.Contains(output, "Removed the volume deleted-project-deps") {
+		t.Errorf("Expected the removal to be reported. CLI output:\n%s", output)
+	}
+	if _, err = os.Stat(filepath.Join(home, "appsody", "volumes.json")); err != nil {
+		t.Errorf("Expected the volume usage file to be written: %v", err)
+	}
+	lock.Unlock()
+
+	// the volumes of older versions of the CLI have no labels and no recorded use
+	output, err = cmdtest.RunAppsodyCmd([]string{"volumes", "list", "--engine", "docker-api", "--config", configFile}, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyListed := false
+	for _, line := range strings.Split(output, "\n") {
+		if strings.Contains(line, "legacy-project-deps") && strings.HasSuffix(strings.TrimSpace(line), "unknown") {
+			legacyListed = true
+		}
+	}
+	if !legacyListed || strings.Contains(output, "unrelated") {
+		t.Errorf("Expected the unlabelled volume legacy-project-deps to be listed as last used unknown, and not the unrelated volume. CLI output:\n%s", output)
+	}
+
+	lock.Lock()
+	removed = nil
+	lock.Unlock()
+	output, err = cmdtest.RunAppsodyCmd([]string{"volumes", "prune", "--older-than", "30d", "--engine", "docker-api", "--config", configFile}, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	// the fake daemon still lists the volume of the deleted project
+	if strings.Join(removed, " ") != "deleted-project-deps legacy-project-deps live-project-deps" {
+		t.Errorf("Expected the volumes without a recorded use to be removed, but removed %v. CLI output:\n%s", removed, output)
+	}
+}
+
+func TestRunDepsVolume(t *testing.T) {
+	var tests = []struct {
+		testName string
+		// the status of the inspect of the volume
+		status   int
+		expected []string
+		excluded []string
+	}{
+		{"missing volume", http.StatusNotFound, []string{"Dry run - skipping creation of volume test-deps"}, nil},
+		{"existing volume", http.StatusOK, nil, []string{"creation of volume", "Could not inspect"}},
+		{"inspect failure", http.StatusInternalServerError, []string{"Could not inspect the dependency volume test-deps"}, []string{"creation of volume"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			project, cleanup := newTestProject(t, "deps-project", "test/deps-stack:0.1.0",
+				`{"Id": "sha256:5678", "Config": {"Env": ["APPSODY_MOUNTS=.:/project/user-app", "APPSODY_DEPS=/project/deps"], "ExposedPorts": {}}}`)
+			defer cleanup()
+			project.mux.HandleFunc("/volumes", func(w http.ResponseWriter, r *http.Request) {
+				t.Error("Expected only the dependency volume to be inspected, not all the volumes to be listed")
+				_, _ = w.Write([]byte(`{"Volumes": []}`))
+			})
+			project.mux.HandleFunc("/volumes/test-deps", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				if tt.status == http.StatusOK {
+					_, _ = w.Write([]byte(`{"Name": "test-deps", "Labels": {"dev.appsody.volume": "deps"}}`))
+				} else {
+					_, _ = w.Write([]byte(`{"message": "inspect failed"}`))
+				}
+			})
+			output, err := cmdtest.RunAppsodyCmd(project.appsodyArgs("run", "--dryrun", "--deps-volume", "test-deps"), project.dir)
+			if err != nil {
+				t.Fatalf("%v. CLI output:\n%s", err, output)
+			}
+			if !strings.Contains(output, "-v test-deps:/project/deps") {
+				t.Errorf("Expected the dependency volume to be mounted. CLI output:\n%s", output)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(output, expected) {
+					t.Errorf("Expected %s in the output. CLI output:\n%s", expected, output)
+				}
+			}
+			for _, excluded := range tt.excluded {
+				if strings.Contains(output, excluded) {
+					t.Errorf("Did not expect %s in the output. CLI output:\n%s", excluded, output)
+				}
+			}
+		})
+	}
+}
@@ -54,7 +54,8 @@ func TestRunWithDockerOptionsRegex(t *testing.T) {
 		"--tty",
 		"--rm",
 		"--entrypoint",
-		"-v", "--volume"}
+		"-v", "--volume",
+		"--mount"}
 
 	for _, value := range testOptions {
 		fmt.Println("Option is", value)
@@ -73,3 +74,36 @@ func TestRunWithDockerOptionsRegex(t *testing.T) {
 
 	}
 }
+
+// This test checks that quoted values in --docker-options are kept as a single docker argument
+func TestRunWithQuotedDockerOptions(t *testing.T) {
+
+	// create a temporary dir to create the project and run the test
+	projectDir, err := ioutil.TempDir("", "appsody-docker-options-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(projectDir)
+
+	log.Println("Created project dir: " + projectDir)
+
+	// appsody init nodejs-express
+	_, err = cmdtest.RunAppsodyCmdExec([]string{"init", "nodejs-express"}, projectDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runOutput, err := cmdtest.RunAppsodyCmdExec([]string{"run", "--docker-options", "-e \"JAVA_OPTS=-Xmx1g -Xms512m\" -m 4g", "--dryrun"}, projectDir)
+	if err != nil {
+		t.Fatal("Error running appsody run: ", err)
+	}
+	if !strings.Contains(runOutput, "-e JAVA_OPTS=-Xmx1g -Xms512m -m 4g") {
+		t.Fatal("Quoted docker-options value is not found in docker run command")
+	}
+
+	runOutput, _ = cmdtest.RunAppsodyCmdExec([]string{"run", "--docker-options", "--not-a-docker-flag", "--dryrun"}, projectDir)
+	if !strings.Contains(runOutput, "--not-a-docker-flag is not allowed in --docker-options") {
+		t.Fatal("Error message not found: --not-a-docker-flag is not allowed in --docker-options")
+	}
+}